@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/config"
+	"github.com/vnestcc/dashboard/db"
+	"github.com/vnestcc/dashboard/limiter"
+	"github.com/vnestcc/dashboard/mailer"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/oidc"
+	"github.com/vnestcc/dashboard/rbac"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+type command struct {
+	args string
+	help string
+	run  func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"serve":        {"", "start the API server (default)", runServe},
+		"migrate":      {"", "create and update the database tables, then exit", runMigrate},
+		"create-admin": {"-email <email> [-name <name>]", "create an admin account, the password is read from stdin", runCreateAdmin},
+		"reset-2fa":    {"<email>", "turn off 2FA for an account, replacing its TOTP secret and backup codes", runResetTwoFactor},
+		"approve-vc":   {"<email>", "approve a VC account and queue the approval email", runApproveVC},
+		"run-cleanup":  {"", "run the scheduled cleanup jobs once", runCleanup},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [-config <path>] [arguments]\n\ncommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(os.Stderr, "  %-14s %-32s %s\n", name, cmd.args, cmd.help)
+	}
+}
+
+// setup parses the flags of a command, adding -config, then loads the config
+// and connects to the database the same way for every command. The returned
+// function flushes the audit log and must run before the command exits.
+func setup(fs *flag.FlagSet, args []string) (*config.Config, func(), error) {
+	path := fs.String("config", "/config.toml", "path to the config file")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	cfg, err := config.LoadConfig(*path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := rbac.Load(cfg.Roles); err != nil {
+		return nil, nil, err
+	}
+	values.SetConfig(&cfg)
+	db.InitDB(&cfg)
+	values.SetDB(db.DB)
+	utils.NewLogger(cfg.Server.Prod)
+	audit := utils.NewAuditHook(db.DB)
+	utils.Logger.AddHook(audit)
+	return &cfg, audit.Close, nil
+}
+
+// cliLog is the audit logger of operator commands, they have no client IP.
+func cliLog(event string) *logrus.Entry {
+	return utils.Logger.WithFields(logrus.Fields{
+		"type":   "audit",
+		"event":  event,
+		"source": "cli",
+	})
+}
+
+func emailArg(fs *flag.FlagSet) (string, error) {
+	if fs.NArg() != 1 {
+		return "", errors.New("expected exactly one email")
+	}
+	return strings.TrimSpace(fs.Arg(0)), nil
+}
+
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func runServe(args []string) error {
+	cfg, done, err := setup(flag.NewFlagSet("serve", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return serve(cfg)
+}
+
+func runMigrate(args []string) error {
+	_, done, err := setup(flag.NewFlagSet("migrate", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+	defer done()
+	utils.Logger.Info("Database is up to date")
+	return nil
+}
+
+func runCreateAdmin(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := fs.String("email", "", "email of the new admin")
+	name := fs.String("name", "Admin", "name of the new admin")
+	_, done, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	if len(password) < 8 {
+		return errors.New("the password must be at least 8 characters")
+	}
+	now := time.Now()
+	user := models.User{
+		Name:       *name,
+		Email:      strings.TrimSpace(*email),
+		Password:   password,
+		Role:       "admin",
+		Approved:   true,
+		VerifiedAt: &now,
+	}
+	if err := db.DB.Create(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			err = fmt.Errorf("an account with the email %s already exists", user.Email)
+		}
+		cliLog("cli_create_admin").WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_create_failed",
+			"email":  user.Email,
+			"error":  err.Error(),
+		}).Error("Failed to create admin")
+		return err
+	}
+	cliLog("cli_create_admin").WithFields(logrus.Fields{
+		"status":  "success",
+		"user_id": user.ID,
+		"email":   user.Email,
+	}).Info("Admin created")
+	return nil
+}
+
+func runResetTwoFactor(args []string) error {
+	fs := flag.NewFlagSet("reset-2fa", flag.ExitOnError)
+	_, done, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	defer done()
+	email, err := emailArg(fs)
+	if err != nil {
+		return err
+	}
+	var user models.User
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ?", email).First(&user).Error; err != nil {
+			return err
+		}
+		if err := user.NewTOTPSecret(); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Updates(map[string]any{"totp_secret": user.TOTPSecret, "two_factor": false}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.BackupCode{}).Error; err != nil {
+			return err
+		}
+		// a stolen device or a login waiting for the old code must not outlive the reset
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.LoginChallenge{}).Error; err != nil {
+			return err
+		}
+		return models.RevokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		cliLog("cli_reset_two_factor").WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"email":  email,
+			"error":  err.Error(),
+		}).Error("Failed to reset two factor")
+		return err
+	}
+	cliLog("cli_reset_two_factor").WithFields(logrus.Fields{
+		"status":  "success",
+		"user_id": user.ID,
+		"email":   user.Email,
+	}).Info("Two factor reset, the account has to set it up again")
+	return nil
+}
+
+func runApproveVC(args []string) error {
+	fs := flag.NewFlagSet("approve-vc", flag.ExitOnError)
+	cfg, done, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	defer done()
+	email, err := emailArg(fs)
+	if err != nil {
+		return err
+	}
+	result := db.DB.Model(&models.User{}).Where("email = ? AND role = ?", email, "vc").Update("approved", true)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = fmt.Errorf("no VC with the email %s", email)
+	}
+	if result.Error != nil {
+		cliLog("cli_approve_vc").WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"email":  email,
+			"error":  result.Error.Error(),
+		}).Error("Failed to approve VC")
+		return result.Error
+	}
+	cliLog("cli_approve_vc").WithFields(logrus.Fields{
+		"status": "success",
+		"email":  email,
+	}).Info("VC approved")
+	var vc models.User
+	if err := db.DB.Where("email = ? AND role = ?", email, "vc").First(&vc).Error; err != nil {
+		return err
+	}
+	// queued only, the running server delivers it
+	mail, err := mailer.New(cfg.Mail, cfg.Server.Prod, db.DB)
+	if err != nil {
+		return err
+	}
+	return mail.Enqueue(context.Background(), vc.Email, mailer.TemplateVCApproved, mailer.VCApprovedData{
+		Name: vc.Name,
+		Link: mail.Link(""),
+	})
+}
+
+func runCleanup(args []string) error {
+	cfg, done, err := setup(flag.NewFlagSet("run-cleanup", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+	defer done()
+	// only a shared limiter store has anything to prune from another process
+	if attempts, err := limiter.New(cfg.Limiter, db.DB); err != nil {
+		return err
+	} else {
+		values.SetLimiter(attempts)
+	}
+	if mail, err := mailer.New(cfg.Mail, cfg.Server.Prod, db.DB); err != nil {
+		return err
+	} else {
+		values.SetMailer(mail)
+	}
+	if sso, err := oidc.New(cfg.SSO, db.DB); err != nil {
+		return err
+	} else {
+		values.SetSSO(sso)
+	}
+	utils.UserCleanUp()
+	utils.SessionCleanUp()
+	utils.SSOCleanUp()
+	utils.VerificationCleanUp()
+	utils.ChallengeCleanUp()
+	utils.JoinCodeCleanUp()
+	utils.AttemptCleanUp()
+	utils.MailCleanUp()
+	utils.Logger.Info("Cleanup finished")
+	return nil
+}
@@ -14,6 +14,13 @@ type ServerConfig struct {
 	JWTSecret   string   `toml:"jwt-secret"`
 	TOTPIssuer  string   `toml:"totp-issuer"`
 	TokenExpiry int      `toml:"token-expiry"`
+	Currency    string   `toml:"currency"`
+	// TrustedProxies are the addresses or CIDRs of the reverse proxies whose
+	// X-Forwarded-For header is believed. None are trusted by default.
+	TrustedProxies []string `toml:"trusted-proxies"`
+
+	AccessTokenExpiry  int `toml:"access-token-expiry"`
+	RefreshTokenExpiry int `toml:"refresh-token-expiry"`
 }
 
 type DBConfig struct {
@@ -25,9 +32,94 @@ type DBConfig struct {
 	SSL      bool   `toml:"ssl"`
 }
 
+type StorageConfig struct {
+	Backend   string `toml:"backend"`
+	Path      string `toml:"path"`
+	MaxSize   int64  `toml:"max-size"`
+	Endpoint  string `toml:"endpoint"`
+	Bucket    string `toml:"bucket"`
+	Region    string `toml:"region"`
+	AccessKey string `toml:"access-key"`
+	SecretKey string `toml:"secret-key"`
+}
+
+// LimiterConfig controls how failed sign in attempts are counted. The memory
+// backend only works for a single instance, use database when running several.
+type LimiterConfig struct {
+	Backend     string `toml:"backend"`
+	MaxAttempts int    `toml:"max-attempts"`
+	Lockout     int    `toml:"lockout"`
+}
+
+// MailConfig is the SMTP server used for outgoing mail. Without a host mails
+// are only logged. BaseURL is the address of the frontend used in links.
+type MailConfig struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	Security string `toml:"security"`
+	From     string `toml:"from"`
+	BaseURL  string `toml:"base-url"`
+}
+
+// SSOConfig lists the OpenID Connect providers accounts can sign in with.
+type SSOConfig struct {
+	Providers []OIDCProviderConfig `toml:"providers"`
+}
+
+// OIDCProviderConfig is one identity provider. Name is used in the URLs and
+// RedirectURL is the frontend page that passes the code back to the API.
+// Roles limits which accounts may use the provider and defaults to vc. With
+// Signup, unknown but verified emails get a pending VC account, which is
+// approved right away when its domain is in AutoApproveDomains. Existing
+// accounts are never approved by their domain.
+type OIDCProviderConfig struct {
+	Name               string   `toml:"name"`
+	DisplayName        string   `toml:"display-name"`
+	Issuer             string   `toml:"issuer"`
+	ClientID           string   `toml:"client-id"`
+	ClientSecret       string   `toml:"client-secret"`
+	RedirectURL        string   `toml:"redirect-url"`
+	Scopes             []string `toml:"scopes"`
+	Roles              []string `toml:"roles"`
+	Signup             bool     `toml:"signup"`
+	AutoApproveDomains []string `toml:"auto-approve-domains"`
+	TrustEmail         bool     `toml:"trust-email"`
+}
+
+// RoleConfig replaces the permissions of a built in role or adds a new one.
+// New staff roles sign in through the admin login and are handed out with
+// staff invites.
+type RoleConfig struct {
+	Staff       bool     `toml:"staff"`
+	Permissions []string `toml:"permissions"`
+}
+
+// ReportingConfig is the reporting calendar. When enabled, reporting on a
+// quarter opens for every company on OpenDay of the month after it ended and
+// closes DeadlineDays later. Timezone is where those days start. Founders of
+// quarters still in draft are reminded RemindDays before any deadline, a
+// negative value turns reminders off.
+type ReportingConfig struct {
+	Enabled      bool   `toml:"enabled"`
+	OpenDay      int    `toml:"open-day"`
+	DeadlineDays int    `toml:"deadline-days"`
+	Timezone     string `toml:"timezone"`
+	RemindDays   int    `toml:"remind-days"`
+}
+
 type Config struct {
-	Server ServerConfig `toml:"server"`
-	DB     DBConfig     `toml:"db"`
+	Server  ServerConfig  `toml:"server"`
+	DB      DBConfig      `toml:"db"`
+	Storage StorageConfig `toml:"storage"`
+	Limiter LimiterConfig `toml:"limiter"`
+	Mail    MailConfig    `toml:"mail"`
+	SSO     SSOConfig     `toml:"sso"`
+
+	Reporting ReportingConfig `toml:"reporting"`
+
+	Roles map[string]RoleConfig `toml:"roles"`
 }
 
 func LoadConfig(path string) (Config, error) {
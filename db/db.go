@@ -44,7 +44,15 @@ func InitDB(cfg *config.Config) {
 		logrus.Fatalf("failed to connect to database: %v", err)
 	}
 	logrus.Println("Database connection established")
-	DB.AutoMigrate(
+	if cfg.Server.Currency != "" {
+		models.DefaultCurrency = cfg.Server.Currency
+	}
+	renameLegacyColumns(DB)
+	unverified := !DB.Migrator().HasColumn(&models.User{}, "verified_at")
+	unfounded := !DB.Migrator().HasColumn(&models.Company{}, "founder_id")
+	unjoined := !DB.Migrator().HasColumn(&models.User{}, "joined_at")
+	untagged := !DB.Migrator().HasColumn(&models.Company{}, "tags")
+	err = DB.AutoMigrate(
 		&models.Company{},
 		&models.User{},
 		&models.Quarter{},
@@ -60,8 +68,40 @@ func InitDB(cfg *config.Config) {
 		&models.ProductDevelopment{},
 		&models.SelfAssessment{},
 		&models.Attachment{},
+		&models.VCAssignment{},
+		&models.VersionLog{},
+		&models.AuditLog{},
+		&models.Session{},
+		&models.TwoFactorPolicy{},
+		&models.LoginChallenge{},
+		&models.BackupCode{},
+		&models.ModeratorInvite{},
+		&models.EmailVerification{},
+		&models.ServiceAccount{},
+		&models.APIToken{},
+		&models.JoinCode{},
+		&models.QuarterTransition{},
+		&models.ReportingPeriod{},
 
 		&models.MarketingBreakdown{},
 		&models.RevenueBreakdown{},
 	)
+	if err != nil {
+		logrus.Fatalf("failed to migrate database: %v", err)
+	}
+	migrateLegacyColumns(DB)
+	migrateBackupCodes(DB)
+	if unverified {
+		markUsersVerified(DB)
+	}
+	if unfounded {
+		assignFounders(DB)
+	}
+	if unjoined {
+		markUsersJoined(DB)
+	}
+	migrateSecretCodes(DB)
+	if untagged {
+		migrateSectors(DB)
+	}
 }
@@ -0,0 +1,395 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type numericKind int
+
+const (
+	kindNumber numericKind = iota
+	kindPercent
+	kindMonths
+	kindMoney
+)
+
+type numericColumn struct {
+	table  string
+	column string
+	kind   numericKind
+}
+
+// numericColumns used to be free text. They are parsed into typed columns the
+// first time the server starts with the typed models.
+var numericColumns = []numericColumn{
+	{"finance", "cash_balance", kindMoney},
+	{"finance", "burn_rate", kindMoney},
+	{"finance", "cash_runway", kindMonths},
+	{"finance", "burn_rate_change", kindPercent},
+	{"finance", "quarterly_revenue", kindMoney},
+	{"finance", "revenue_growth", kindPercent},
+	{"finance", "gross_margin", kindPercent},
+	{"finance", "net_margin", kindPercent},
+	{"revenue_breakdowns", "revenue", kindMoney},
+	{"revenue_breakdowns", "percentage", kindPercent},
+	{"market", "new_customers", kindNumber},
+	{"market", "total_customers", kindNumber},
+	{"market", "customer_growth", kindPercent},
+	{"market", "retention_rate", kindPercent},
+	{"market", "churn_rate", kindPercent},
+	{"market", "pipeline_value", kindMoney},
+	{"market", "conversion_rate", kindPercent},
+	{"market", "market_share", kindPercent},
+	{"market", "market_share_change", kindPercent},
+	{"economics", "cac", kindMoney},
+	{"economics", "cac_change", kindPercent},
+	{"economics", "ltv", kindMoney},
+	{"economics", "ltv_ratio", kindNumber},
+	{"economics", "cac_payback", kindMonths},
+	{"economics", "arpu", kindMoney},
+	{"marketing_breakdowns", "spend", kindMoney},
+	{"marketing_breakdowns", "budget", kindMoney},
+	{"marketing_breakdowns", "cac", kindMoney},
+}
+
+// legacyColumn is where the old text value waits to be parsed.
+func legacyColumn(column string) string {
+	return column + "_legacy"
+}
+
+// migratedColumn is where the old text value is kept once it was parsed. It is
+// never dropped so values the parser could not understand can still be fixed
+// by hand.
+func migratedColumn(column string) string {
+	return column + "_legacy_migrated"
+}
+
+// renameLegacyColumns moves text columns out of the way before AutoMigrate
+// creates their typed replacements.
+func renameLegacyColumns(db *gorm.DB) {
+	for _, col := range numericColumns {
+		var dataType string
+		err := db.Raw(`
+			SELECT data_type FROM information_schema.columns
+			WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?
+		`, col.table, col.column).Scan(&dataType).Error
+		if err != nil {
+			logrus.Errorf("failed to inspect %s.%s: %v", col.table, col.column, err)
+			continue
+		}
+		if dataType != "text" && dataType != "character varying" {
+			continue
+		}
+		if err := db.Migrator().RenameColumn(col.table, col.column, legacyColumn(col.column)); err != nil {
+			logrus.Errorf("failed to rename %s.%s: %v", col.table, col.column, err)
+		}
+	}
+}
+
+// migrateLegacyColumns fills the typed columns from every renamed text column
+// that was not parsed yet, so a migration cut short is finished on the next
+// start. Each column is parsed in a transaction that marks it done.
+func migrateLegacyColumns(db *gorm.DB) {
+	for _, col := range numericColumns {
+		if !db.Migrator().HasColumn(col.table, legacyColumn(col.column)) {
+			continue
+		}
+		var migrated, skipped int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			migrated, skipped, err = migrateLegacyColumn(tx, col)
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().RenameColumn(col.table, legacyColumn(col.column), migratedColumn(col.column))
+		})
+		if err != nil {
+			logrus.Errorf("failed to migrate legacy %s.%s: %v", col.table, col.column, err)
+			continue
+		}
+		logrus.Printf("Migrated %s.%s to typed values: %d converted, %d left empty", col.table, col.column, migrated, skipped)
+	}
+}
+
+// migrateLegacyColumn parses the text values of the column into its typed
+// column. Values that cannot be parsed are left empty.
+func migrateLegacyColumn(tx *gorm.DB, col numericColumn) (int, int, error) {
+	type legacyRow struct {
+		ID    uint
+		Value string
+	}
+	var rows []legacyRow
+	err := tx.Raw(fmt.Sprintf(
+		`SELECT id, %s AS value FROM %s WHERE %s IS NOT NULL AND %s <> ''`,
+		legacyColumn(col.column), col.table, legacyColumn(col.column), legacyColumn(col.column),
+	)).Scan(&rows).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	migrated, skipped := 0, 0
+	for _, row := range rows {
+		value, currency, ok := parseLegacyNumber(row.Value, col.kind)
+		if !ok {
+			skipped++
+			logrus.WithFields(logrus.Fields{
+				"table":  col.table,
+				"column": col.column,
+				"id":     row.ID,
+				"value":  row.Value,
+			}).Warn("Could not parse legacy value, left empty")
+			continue
+		}
+		amount := models.NewDecimal(value)
+		if col.kind == kindMoney {
+			err = tx.Exec(fmt.Sprintf(
+				`UPDATE %s SET %s_amount = ?, %s_currency = ? WHERE id = ?`,
+				col.table, col.column, col.column,
+			), amount, currency, row.ID).Error
+		} else {
+			err = tx.Exec(fmt.Sprintf(
+				`UPDATE %s SET %s = ? WHERE id = ?`,
+				col.table, col.column,
+			), amount, row.ID).Error
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("id %d: %w", row.ID, err)
+		}
+		migrated++
+	}
+	return migrated, skipped, nil
+}
+
+var (
+	legacyNumberPattern = regexp.MustCompile(`(-?\d+(?:\.\d+)?)\s*([a-z]*)`)
+
+	legacyCurrencyPattern = regexp.MustCompile(`us\$|\$|₹|€|£|\b(?:usd|inr|rs|eur|gbp)\b\.?`)
+
+	legacyCurrencies = map[string]string{
+		"us$": "USD",
+		"$":   "USD",
+		"usd": "USD",
+		"₹":   "INR",
+		"inr": "INR",
+		"rs":  "INR",
+		"€":   "EUR",
+		"eur": "EUR",
+		"£":   "GBP",
+		"gbp": "GBP",
+	}
+
+	legacyScales = map[string]float64{
+		"k":        1e3,
+		"thousand": 1e3,
+		"l":        1e5,
+		"lac":      1e5,
+		"lakh":     1e5,
+		"lakhs":    1e5,
+		"m":        1e6,
+		"mn":       1e6,
+		"mil":      1e6,
+		"million":  1e6,
+		"cr":       1e7,
+		"crore":    1e7,
+		"crores":   1e7,
+		"b":        1e9,
+		"bn":       1e9,
+		"billion":  1e9,
+	}
+)
+
+// parseLegacyNumber makes a best effort to read what founders typed into the
+// old text fields, e.g. "$1.2M", "₹ 45 lakh", "12.5%", "18 months" or "1,200".
+// Ranges like "12-18" keep the first number.
+func parseLegacyNumber(raw string, kind numericKind) (float64, string, bool) {
+	s := strings.ToLower(strings.TrimSpace(raw))
+	currency := models.DefaultCurrency
+	if kind == kindMoney {
+		if token := legacyCurrencyPattern.FindString(s); token != "" {
+			currency = legacyCurrencies[strings.TrimSuffix(token, ".")]
+			s = legacyCurrencyPattern.ReplaceAllString(s, " ")
+		}
+	}
+	s = strings.ReplaceAll(s, ",", "")
+	s = strings.ReplaceAll(s, "- ", "-")
+	match := legacyNumberPattern.FindStringSubmatch(s)
+	if match == nil {
+		return 0, "", false
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, "", false
+	}
+	// a trailing "m" is million for amounts but months for durations
+	if kind == kindNumber || kind == kindMoney {
+		if scale, ok := legacyScales[match[2]]; ok {
+			value *= scale
+		}
+	}
+	if math.Abs(value) >= 1e14 {
+		return 0, "", false
+	}
+	return value, currency, true
+}
+
+// migrateBackupCodes moves the single plain text backup code users used to have
+// into the hashed backup_codes table, then drops the old column and its index.
+func migrateBackupCodes(db *gorm.DB) {
+	if !db.Migrator().HasColumn("users", "backup_code") {
+		return
+	}
+	type legacyCode struct {
+		ID         uint
+		BackupCode string
+	}
+	var rows []legacyCode
+	err := db.Raw(`SELECT id, backup_code FROM users WHERE backup_code IS NOT NULL AND backup_code <> ''`).Scan(&rows).Error
+	if err != nil {
+		logrus.Errorf("failed to read legacy backup codes: %v", err)
+		return
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			code := models.BackupCode{UserID: row.ID, CodeHash: models.HashBackupCode(row.BackupCode)}
+			if err := tx.Create(&code).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn("users", "backup_code")
+	})
+	if err != nil {
+		logrus.Errorf("failed to migrate legacy backup codes: %v", err)
+		return
+	}
+	logrus.Printf("Migrated %d backup codes to hashed single-use codes", len(rows))
+}
+
+// markUsersVerified trusts the addresses of accounts that existed before email
+// verification was added, they were never sent a link.
+func markUsersVerified(db *gorm.DB) {
+	result := db.Exec(`UPDATE users SET verified_at = created_at WHERE verified_at IS NULL`)
+	if result.Error != nil {
+		logrus.Errorf("failed to mark existing users as verified: %v", result.Error)
+		return
+	}
+	logrus.Printf("Marked %d existing users as verified", result.RowsAffected)
+}
+
+// markUsersJoined records that the current members of companies joined one,
+// using their signup time as the best guess.
+func markUsersJoined(db *gorm.DB) {
+	result := db.Exec(`UPDATE users SET joined_at = created_at WHERE startup_id IS NOT NULL AND joined_at IS NULL`)
+	if result.Error != nil {
+		logrus.Errorf("failed to mark existing members as joined: %v", result.Error)
+		return
+	}
+	logrus.Printf("Marked %d existing members as joined", result.RowsAffected)
+}
+
+// assignFounders makes the first member of every existing company its founder.
+func assignFounders(db *gorm.DB) {
+	result := db.Exec(`
+		UPDATE companies SET founder_id = (
+			SELECT MIN(id) FROM users WHERE users.startup_id = companies.id AND users.deleted_at IS NULL
+		) WHERE founder_id IS NULL
+	`)
+	if result.Error != nil {
+		logrus.Errorf("failed to assign company founders: %v", result.Error)
+		return
+	}
+	logrus.Printf("Assigned founders to %d existing companies", result.RowsAffected)
+}
+
+// legacyCodeExpiry is how long the secret codes companies used to have keep
+// working as join codes, founders should hand out new ones before that.
+const legacyCodeExpiry = 30 * 24 * time.Hour
+
+// migrateSecretCodes moves the permanent secret code of every company into the
+// hashed join_codes table with an expiry, then drops the old column.
+func migrateSecretCodes(db *gorm.DB) {
+	if !db.Migrator().HasColumn("companies", "secret_code") {
+		return
+	}
+	type legacyCode struct {
+		ID         uint
+		FounderID  *uint
+		SecretCode string
+	}
+	var rows []legacyCode
+	err := db.Raw(`
+		SELECT id, founder_id, secret_code FROM companies
+		WHERE deleted_at IS NULL AND secret_code IS NOT NULL AND secret_code <> ''
+	`).Scan(&rows).Error
+	if err != nil {
+		logrus.Errorf("failed to read legacy secret codes: %v", err)
+		return
+	}
+	expiresAt := time.Now().Add(legacyCodeExpiry)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			code := models.JoinCode{
+				CompanyID: row.ID,
+				CodeHash:  models.HashJoinCode(row.SecretCode),
+				Prefix:    row.SecretCode[:min(4, len(row.SecretCode))],
+				ExpiresAt: expiresAt,
+			}
+			if row.FounderID != nil {
+				code.CreatedBy = *row.FounderID
+			}
+			if err := tx.Create(&code).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn("companies", "secret_code")
+	})
+	if err != nil {
+		logrus.Errorf("failed to migrate legacy secret codes: %v", err)
+		return
+	}
+	logrus.Printf("Migrated %d company secret codes to join codes expiring in %d days", len(rows), int(legacyCodeExpiry.Hours()/24))
+}
+
+// migrateSectors files companies with a free text sector under the sector
+// taxonomy. Sectors that match none of it become other and are kept as a tag.
+func migrateSectors(db *gorm.DB) {
+	var companies []models.Company
+	if err := db.Unscoped().Select("id", "sector").Find(&companies).Error; err != nil {
+		logrus.Errorf("failed to read company sectors: %v", err)
+		return
+	}
+	moved := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, company := range companies {
+			sector, ok := models.NormalizeSector(company.Sector)
+			tags := datatypes.JSONSlice[string]{}
+			if !ok {
+				if sector != "" {
+					tags = append(tags, sector)
+				}
+				sector = models.SectorOther
+				moved++
+			}
+			if err := tx.Unscoped().Model(&models.Company{}).Where("id = ?", company.ID).Updates(map[string]any{
+				"sector": sector,
+				"tags":   tags,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("failed to migrate company sectors: %v", err)
+		return
+	}
+	logrus.Printf("Filed %d companies under the sector taxonomy, %d moved to other", len(companies), moved)
+}
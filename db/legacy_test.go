@@ -0,0 +1,55 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/vnestcc/dashboard/models"
+)
+
+func TestParseLegacyNumber(t *testing.T) {
+	tests := []struct {
+		raw          string
+		kind         numericKind
+		want         float64
+		wantCurrency string
+		wantOK       bool
+	}{
+		{"1,200", kindNumber, 1200, models.DefaultCurrency, true},
+		{"  42 ", kindNumber, 42, models.DefaultCurrency, true},
+		{"3.5x", kindNumber, 3.5, models.DefaultCurrency, true},
+		{"2k", kindNumber, 2000, models.DefaultCurrency, true},
+		{"12.5%", kindPercent, 12.5, models.DefaultCurrency, true},
+		{"-3 %", kindPercent, -3, models.DefaultCurrency, true},
+		{"- 4%", kindPercent, -4, models.DefaultCurrency, true},
+		{"18 months", kindMonths, 18, models.DefaultCurrency, true},
+		{"6m", kindMonths, 6, models.DefaultCurrency, true},
+		{"12-18", kindMonths, 12, models.DefaultCurrency, true},
+		{"$1.2M", kindMoney, 1.2e6, "USD", true},
+		{"US$ 500k", kindMoney, 500e3, "USD", true},
+		{"₹ 45 lakh", kindMoney, 45e5, "INR", true},
+		{"Rs. 2 cr", kindMoney, 2e7, "INR", true},
+		{"INR 1,50,000", kindMoney, 150000, "INR", true},
+		{"€3bn", kindMoney, 3e9, "EUR", true},
+		{"£250", kindMoney, 250, "GBP", true},
+		{"75000", kindMoney, 75000, models.DefaultCurrency, true},
+		{"-20k", kindMoney, -20e3, models.DefaultCurrency, true},
+		{"", kindNumber, 0, "", false},
+		{"n/a", kindPercent, 0, "", false},
+		{"TBD", kindMoney, 0, "", false},
+		{"$", kindMoney, 0, "", false},
+		{"100000 billion", kindMoney, 0, "", false},
+	}
+	for _, tt := range tests {
+		got, currency, ok := parseLegacyNumber(tt.raw, tt.kind)
+		if ok != tt.wantOK {
+			t.Errorf("parseLegacyNumber(%q) ok = %v, want %v", tt.raw, ok, tt.wantOK)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got != tt.want || currency != tt.wantCurrency {
+			t.Errorf("parseLegacyNumber(%q) = %v %s, want %v %s", tt.raw, got, currency, tt.want, tt.wantCurrency)
+		}
+	}
+}
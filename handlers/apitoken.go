@@ -0,0 +1,543 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTokenExpiryDays = 90
+	// tokenPrefixLength is how much of a token is kept to recognise it in lists
+	tokenPrefixLength = len(models.APITokenPrefix) + 8
+)
+
+type createAPITokenRequest struct {
+	Name          string   `json:"name" example:"metrics export" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" example:"metrics:read,company:read" binding:"required,min=1"`
+	ExpiresInDays *int     `json:"expires_in_days" example:"90" binding:"omitempty,min=1,max=365"`
+}
+
+type apiTokenModel struct {
+	ID               uint       `json:"id" example:"1"`
+	Name             string     `json:"name" example:"metrics export"`
+	Prefix           string     `json:"prefix" example:"vnt_1a2b3c4d"`
+	Scopes           []string   `json:"scopes" example:"metrics:read"`
+	UserID           *uint      `json:"user_id,omitempty" example:"4"`
+	ServiceAccountID *uint      `json:"service_account_id,omitempty"`
+	CreatedBy        uint       `json:"created_by" example:"4"`
+	CreatedAt        time.Time  `json:"created_at" example:"2025-04-01T00:00:00Z"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" example:"2025-06-30T00:00:00Z"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" example:"2025-04-02T09:30:00Z"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+}
+
+type createdAPITokenResponse struct {
+	apiTokenModel
+	Token string `json:"token" example:"vnt_1a2b3c4d5e6f..."`
+}
+
+type createServiceAccountRequest struct {
+	Name        string `json:"name" example:"data warehouse" binding:"required,max=100"`
+	Description string `json:"description" example:"Nightly metrics sync" binding:"max=500"`
+}
+
+type serviceAccountModel struct {
+	ID           uint      `json:"id" example:"1"`
+	Name         string    `json:"name" example:"data warehouse"`
+	Description  string    `json:"description" example:"Nightly metrics sync"`
+	CreatedBy    uint      `json:"created_by" example:"1"`
+	CreatedAt    time.Time `json:"created_at" example:"2025-04-01T00:00:00Z"`
+	ActiveTokens int64     `json:"active_tokens" example:"1"`
+}
+
+func toAPITokenModel(token models.APIToken) apiTokenModel {
+	return apiTokenModel{
+		ID:               token.ID,
+		Name:             token.Name,
+		Prefix:           token.Prefix,
+		Scopes:           token.Scopes,
+		UserID:           token.UserID,
+		ServiceAccountID: token.ServiceAccountID,
+		CreatedBy:        token.CreatedBy,
+		CreatedAt:        token.CreatedAt,
+		ExpiresAt:        token.ExpiresAt,
+		LastUsedAt:       token.LastUsedAt,
+		RevokedAt:        token.RevokedAt,
+	}
+}
+
+// validScopes reports whether every requested scope exists and drops duplicates.
+func validScopes(requested []string) (models.Scopes, bool) {
+	scopes := models.Scopes{}
+	for _, scope := range requested {
+		if !slices.Contains(models.APIScopes, scope) {
+			return nil, false
+		}
+		if !scopes.Has(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true
+}
+
+// issueAPIToken binds and validates the request, then stores a new token for
+// the owner set on token. The plain token is only ever returned here.
+func issueAPIToken(ctx *gin.Context, auditLog *logrus.Entry, token models.APIToken) {
+	db := values.GetDB()
+	var input createAPITokenRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid API token input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	scopes, ok := validScopes(input.Scopes)
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_scope",
+			"scopes": input.Scopes,
+		}).Warn("API token with an unknown scope")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope", "scopes": models.APIScopes})
+		return
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("Failed to generate API token")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create the token"})
+		return
+	}
+	plain := models.APITokenPrefix + hex.EncodeToString(random)
+	days := defaultTokenExpiryDays
+	if input.ExpiresInDays != nil {
+		days = *input.ExpiresInDays
+	}
+	expiresAt := time.Now().AddDate(0, 0, days)
+	token.Name = input.Name
+	token.TokenHash = models.HashAPIToken(plain)
+	token.Prefix = plain[:tokenPrefixLength]
+	token.Scopes = scopes
+	token.ExpiresAt = &expiresAt
+	if err := db.Create(&token).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_create_failed",
+			"error":  err.Error(),
+		}).Error("Failed to store API token")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create the token"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":   "success",
+		"token_id": token.ID,
+		"scopes":   []string(token.Scopes),
+	}).Info("API token created")
+	ctx.JSON(http.StatusOK, createdAPITokenResponse{apiTokenModel: toAPITokenModel(token), Token: plain})
+}
+
+// revokeAPIToken revokes the token with the id in the path if owned matches it.
+func revokeAPIToken(ctx *gin.Context, auditLog *logrus.Entry, owned func(*gorm.DB) *gorm.DB) {
+	db := values.GetDB()
+	idParam := ctx.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_id",
+			"id":     idParam,
+		}).Warn("Invalid API token ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	result := owned(db.Model(&models.APIToken{})).
+		Where("id = ? AND revoked_at IS NULL", uint(id)).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":   "failure",
+			"reason":   "db_update_failed",
+			"token_id": id,
+			"error":    result.Error.Error(),
+		}).Error("Failed to revoke API token")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke the token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		auditLog.WithFields(logrus.Fields{
+			"status":   "failure",
+			"reason":   "token_not_found",
+			"token_id": id,
+		}).Warn("API token does not exist or is already revoked")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Token does not exist"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":   "success",
+		"token_id": id,
+	}).Info("API token revoked")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+func listAPITokens(ctx *gin.Context, auditLog *logrus.Entry, query *gorm.DB) {
+	var tokens []models.APIToken
+	if err := query.Order("created_at DESC").Find(&tokens).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_fetch_failed",
+			"error":  err.Error(),
+		}).Error("Failed to list API tokens")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tokens"})
+		return
+	}
+	result := make([]apiTokenModel, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, toAPITokenModel(token))
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"count":  len(result),
+	}).Info("Listed API tokens")
+	ctx.JSON(http.StatusOK, result)
+}
+
+func tokenAuditLog(ctx *gin.Context, event string) (*logrus.Entry, *Claims, bool) {
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": event,
+	})
+	claims, ok := currentClaims(ctx)
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_claims",
+		}).Warn("API token request without valid claims")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return auditLog, nil, false
+	}
+	return auditLog.WithField("user_id", claims.ID), claims, true
+}
+
+// CreateAPIToken godoc
+// @Summary      Create an API token
+// @Description  Creates a token that acts as the current account on the endpoints that accept one of its scopes. Send it as "Bearer <token>". It is shown only in this response and expires after expires_in_days, 90 by default.
+// @Security     BearerAuth
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      createAPITokenRequest  true  "Token name, scopes and lifetime"
+// @Success      200      {object}  createdAPITokenResponse
+// @Failure      400      {object}  failedResponse
+// @Failure      401      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /tokens [post]
+func CreateAPIToken(ctx *gin.Context) {
+	auditLog, claims, ok := tokenAuditLog(ctx, "api_token_create")
+	if !ok {
+		return
+	}
+	issueAPIToken(ctx, auditLog, models.APIToken{UserID: &claims.ID, CreatedBy: claims.ID})
+}
+
+// ListAPITokens godoc
+// @Summary      List my API tokens
+// @Description  Lists the API tokens of the current account, revoked ones included
+// @Security     BearerAuth
+// @Tags         auth
+// @Produce      json
+// @Success      200  {array}   apiTokenModel
+// @Failure      401  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /tokens [get]
+func ListAPITokens(ctx *gin.Context) {
+	auditLog, claims, ok := tokenAuditLog(ctx, "api_token_list")
+	if !ok {
+		return
+	}
+	listAPITokens(ctx, auditLog, values.GetDB().Where("user_id = ?", claims.ID))
+}
+
+// RevokeAPIToken godoc
+// @Summary      Revoke one of my API tokens
+// @Security     BearerAuth
+// @Tags         auth
+// @Produce      json
+// @Param        id   path      int  true  "Token ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  failedResponse
+// @Failure      401  {object}  failedResponse
+// @Failure      404  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /tokens/{id} [delete]
+func RevokeAPIToken(ctx *gin.Context) {
+	auditLog, claims, ok := tokenAuditLog(ctx, "api_token_revoke")
+	if !ok {
+		return
+	}
+	revokeAPIToken(ctx, auditLog, func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", claims.ID)
+	})
+}
+
+// GetAllAPITokens godoc
+// @Summary      List all API tokens
+// @Description  Lists the API tokens of every user and service account
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        user_id             query     int  false  "Only tokens of this user"
+// @Param        service_account_id  query     int  false  "Only tokens of this service account"
+// @Success      200  {array}   apiTokenModel
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/tokens [get]
+func GetAllAPITokens(ctx *gin.Context) {
+	auditLog, _, ok := tokenAuditLog(ctx, "api_token_list_all")
+	if !ok {
+		return
+	}
+	query := values.GetDB().Model(&models.APIToken{})
+	if id, err := strconv.ParseUint(ctx.Query("user_id"), 10, 64); err == nil {
+		query = query.Where("user_id = ?", uint(id))
+	}
+	if id, err := strconv.ParseUint(ctx.Query("service_account_id"), 10, 64); err == nil {
+		query = query.Where("service_account_id = ?", uint(id))
+	}
+	listAPITokens(ctx, auditLog, query)
+}
+
+// RevokeAnyAPIToken godoc
+// @Summary      Revoke an API token
+// @Description  Revokes the token of any user or service account
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      int  true  "Token ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  failedResponse
+// @Failure      404  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/tokens/{id} [delete]
+func RevokeAnyAPIToken(ctx *gin.Context) {
+	auditLog, _, ok := tokenAuditLog(ctx, "api_token_revoke_any")
+	if !ok {
+		return
+	}
+	revokeAPIToken(ctx, auditLog, func(db *gorm.DB) *gorm.DB { return db })
+}
+
+// GetServiceAccounts godoc
+// @Summary      List service accounts
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Success      200  {array}   serviceAccountModel
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/service-accounts [get]
+func GetServiceAccounts(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog, _, ok := tokenAuditLog(ctx, "service_account_list")
+	if !ok {
+		return
+	}
+	var accounts []serviceAccountModel
+	err := db.Model(&models.ServiceAccount{}).
+		Select(`service_accounts.id, service_accounts.name, service_accounts.description,
+			service_accounts.created_by, service_accounts.created_at,
+			(SELECT COUNT(*) FROM api_tokens t WHERE t.service_account_id = service_accounts.id
+				AND t.revoked_at IS NULL AND t.deleted_at IS NULL
+				AND (t.expires_at IS NULL OR t.expires_at > ?)) AS active_tokens`, time.Now()).
+		Order("service_accounts.id").
+		Scan(&accounts).Error
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_fetch_failed",
+			"error":  err.Error(),
+		}).Error("Failed to list service accounts")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list service accounts"})
+		return
+	}
+	if accounts == nil {
+		accounts = []serviceAccountModel{}
+	}
+	ctx.JSON(http.StatusOK, accounts)
+}
+
+// CreateServiceAccount godoc
+// @Summary      Create a service account
+// @Description  Creates an account for automation that is not tied to a person. Give it tokens at /manage/service-accounts/{id}/tokens.
+// @Security     BearerAuth
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        request  body      createServiceAccountRequest  true  "Service account"
+// @Success      200      {object}  serviceAccountModel
+// @Failure      400      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /manage/service-accounts [post]
+func CreateServiceAccount(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog, claims, ok := tokenAuditLog(ctx, "service_account_create")
+	if !ok {
+		return
+	}
+	var input createServiceAccountRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid service account input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	account := models.ServiceAccount{Name: input.Name, Description: input.Description, CreatedBy: claims.ID}
+	if err := db.Create(&account).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_create_failed",
+			"error":  err.Error(),
+		}).Error("Failed to create service account")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create the service account"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":             "success",
+		"service_account_id": account.ID,
+		"name":               account.Name,
+	}).Info("Service account created")
+	ctx.JSON(http.StatusOK, serviceAccountModel{
+		ID:          account.ID,
+		Name:        account.Name,
+		Description: account.Description,
+		CreatedBy:   account.CreatedBy,
+		CreatedAt:   account.CreatedAt,
+	})
+}
+
+// DeleteServiceAccount godoc
+// @Summary      Delete a service account
+// @Description  Deletes the service account and revokes all of its tokens
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      int  true  "Service account ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  failedResponse
+// @Failure      404  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/service-accounts/{id} [delete]
+func DeleteServiceAccount(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog, _, ok := tokenAuditLog(ctx, "service_account_delete")
+	if !ok {
+		return
+	}
+	idParam := ctx.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_id",
+			"id":     idParam,
+		}).Warn("Invalid service account ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.ServiceAccount{}, uint(id))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return models.RevokeServiceAccountTokens(tx, uint(id))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		auditLog.WithFields(logrus.Fields{
+			"status":             "failure",
+			"reason":             "service_account_not_found",
+			"service_account_id": id,
+		}).Warn("Service account does not exist")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Service account does not exist"})
+		return
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":             "failure",
+			"reason":             "db_delete_failed",
+			"service_account_id": id,
+			"error":              err.Error(),
+		}).Error("Failed to delete service account")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete the service account"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":             "success",
+		"service_account_id": id,
+	}).Info("Service account deleted")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Service account deleted"})
+}
+
+// CreateServiceAccountToken godoc
+// @Summary      Create a service account token
+// @Description  Creates an API token for the service account. Service accounts see companies like a VC does, only the fields marked visible. The token is shown only in this response.
+// @Security     BearerAuth
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                    true  "Service account ID"
+// @Param        request  body      createAPITokenRequest  true  "Token name, scopes and lifetime"
+// @Success      200      {object}  createdAPITokenResponse
+// @Failure      400      {object}  failedResponse
+// @Failure      404      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /manage/service-accounts/{id}/tokens [post]
+func CreateServiceAccountToken(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog, claims, ok := tokenAuditLog(ctx, "service_account_token_create")
+	if !ok {
+		return
+	}
+	idParam := ctx.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_id",
+			"id":     idParam,
+		}).Warn("Invalid service account ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var account models.ServiceAccount
+	if err := db.First(&account, uint(id)).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":             "failure",
+			"reason":             "service_account_not_found",
+			"service_account_id": id,
+		}).Warn("Service account does not exist")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Service account does not exist"})
+		return
+	}
+	auditLog = auditLog.WithField("service_account_id", account.ID)
+	issueAPIToken(ctx, auditLog, models.APIToken{ServiceAccountID: &account.ID, CreatedBy: claims.ID})
+}
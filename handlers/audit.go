@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+	auditExportBatch  = 500
+)
+
+type auditEntry struct {
+	ID        uint            `json:"id" example:"1"`
+	Time      time.Time       `json:"time"`
+	Level     string          `json:"level" example:"info"`
+	Event     string          `json:"event" example:"get_company_by_id"`
+	Status    string          `json:"status" example:"success"`
+	Reason    string          `json:"reason,omitempty" example:"company_not_found"`
+	UserID    *uint           `json:"user_id" example:"3"`
+	Email     string          `json:"email,omitempty" example:"john@example.com"`
+	CompanyID *uint           `json:"company_id" example:"1"`
+	IP        string          `json:"ip" example:"10.0.0.1"`
+	Message   string          `json:"message" example:"Fetching company data section"`
+	Fields    json.RawMessage `json:"fields" swaggertype:"object"`
+}
+
+type auditListResponse struct {
+	Total   int64        `json:"total" example:"1"`
+	Limit   int          `json:"limit" example:"100"`
+	Offset  int          `json:"offset" example:"0"`
+	Entries []auditEntry `json:"entries"`
+}
+
+func newAuditEntry(l models.AuditLog) auditEntry {
+	return auditEntry{
+		ID:        l.ID,
+		Time:      l.LoggedAt,
+		Level:     l.Level,
+		Event:     l.Event,
+		Status:    l.Status,
+		Reason:    l.Reason,
+		UserID:    l.UserID,
+		Email:     l.Email,
+		CompanyID: l.CompanyID,
+		IP:        l.IP,
+		Message:   l.Message,
+		Fields:    json.RawMessage(l.Fields),
+	}
+}
+
+var auditCSVHeader = []string{"id", "time", "level", "event", "status", "reason", "user_id", "email", "company_id", "ip", "message", "fields"}
+
+// csvRecord is the row of the entry in the CSV export. Emails and messages
+// carry user input, so no cell may start a formula.
+func (e auditEntry) csvRecord() []string {
+	id := func(v *uint) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatUint(uint64(*v), 10)
+	}
+	return utils.CSVRecord([]string{
+		strconv.FormatUint(uint64(e.ID), 10),
+		e.Time.UTC().Format(time.RFC3339),
+		e.Level,
+		e.Event,
+		e.Status,
+		e.Reason,
+		id(e.UserID),
+		e.Email,
+		id(e.CompanyID),
+		e.IP,
+		e.Message,
+		string(e.Fields),
+	})
+}
+
+// parseAuditTime accepts an RFC 3339 timestamp or a plain date. A plain date
+// as the end of a range includes that whole day.
+func parseAuditTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", value)
+	}
+	if end {
+		t = t.Add(24 * time.Hour)
+	}
+	return t, nil
+}
+
+// auditQuery applies the filters of the request to the audit log table.
+func auditQuery(ctx *gin.Context, db *gorm.DB) (*gorm.DB, error) {
+	query := db.Model(&models.AuditLog{})
+	if actor := strings.TrimSpace(ctx.Query("actor")); actor != "" {
+		if id, err := strconv.ParseUint(actor, 10, 32); err == nil {
+			query = query.Where("user_id = ?", id)
+		} else {
+			query = query.Where("LOWER(email) = ?", strings.ToLower(actor))
+		}
+	}
+	if companyStr := ctx.Query("company_id"); companyStr != "" {
+		companyID, err := strconv.ParseUint(companyStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid company_id %q", companyStr)
+		}
+		query = query.Where("company_id = ?", companyID)
+	}
+	if events := ctx.QueryArray("event"); len(events) > 0 {
+		query = query.Where("event IN ?", events)
+	}
+	if status := ctx.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if data := ctx.Query("data"); data != "" {
+		query = query.Where("fields->>'data' = ?", data)
+	}
+	if fromStr := ctx.Query("from"); fromStr != "" {
+		from, err := parseAuditTime(fromStr, false)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("logged_at >= ?", from)
+	}
+	if toStr := ctx.Query("to"); toStr != "" {
+		to, err := parseAuditTime(toStr, true)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("logged_at < ?", to)
+	}
+	return query, nil
+}
+
+// GetAuditLog godoc
+// @Summary      Search the audit log
+// @Description  Returns stored audit events, newest first, filtered by actor (user ID or email), company, event name, status, section and time range. With format=csv or format=jsonl every matching event is exported as a file instead, ignoring limit and offset.
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Param        actor       query  string  false  "User ID or email of whoever triggered the event"
+// @Param        company_id  query  int     false  "Company ID"
+// @Param        event       query  []string  false  "Event name, may be repeated"  collectionFormat(multi)
+// @Param        status      query  string  false  "Status"  Enums(success, failure)
+// @Param        data        query  string  false  "Section the event was about, e.g. finance"
+// @Param        from        query  string  false  "Start of the range, RFC 3339 or YYYY-MM-DD"
+// @Param        to          query  string  false  "End of the range, RFC 3339 or YYYY-MM-DD (whole day included)"
+// @Param        format      query  string  false  "Response format"  Enums(json, csv, jsonl)
+// @Param        limit       query  int     false  "Page size, at most 1000"  default(100)
+// @Param        offset      query  int     false  "Number of events to skip"  default(0)
+// @Success      200  {object}  auditListResponse
+// @Failure      400  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/audit [get]
+func GetAuditLog(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "get_audit_log",
+	})
+	if claims, ok := ctx.Get("claims"); ok {
+		if c, ok := claims.(*Claims); ok {
+			auditLog = auditLog.WithField("user_id", c.ID)
+		}
+	}
+	query, err := auditQuery(ctx, db)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_filter",
+			"error":  err.Error(),
+		}).Warn("Invalid audit log filter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := ctx.DefaultQuery("format", "json")
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"format":  format,
+		"filters": ctx.Request.URL.RawQuery,
+	})
+	switch format {
+	case "json":
+	case "csv", "jsonl":
+		exportAuditLog(ctx, query, format, auditLog)
+		return
+	default:
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_format",
+		}).Warn("Invalid audit log format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(auditDefaultLimit)))
+	if err != nil || limit < 1 || limit > auditMaxLimit {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", auditMaxLimit)})
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error("Failed to count audit events")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get the audit log"})
+		return
+	}
+	var logs []models.AuditLog
+	if err := query.Order("logged_at DESC, id DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error("Failed to get audit events")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get the audit log"})
+		return
+	}
+	entries := make([]auditEntry, 0, len(logs))
+	for _, l := range logs {
+		entries = append(entries, newAuditEntry(l))
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"rows":   len(entries),
+	}).Info("Fetched audit log")
+	ctx.JSON(http.StatusOK, auditListResponse{
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+		Entries: entries,
+	})
+}
+
+// exportAuditLog streams every matching event, oldest first, in batches.
+func exportAuditLog(ctx *gin.Context, query *gorm.DB, format string, auditLog *logrus.Entry) {
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if format == "csv" {
+		ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		ctx.Header("Content-Type", "application/x-ndjson")
+	}
+	ctx.Status(http.StatusOK)
+	csvWriter := csv.NewWriter(ctx.Writer)
+	jsonWriter := json.NewEncoder(ctx.Writer)
+	if format == "csv" {
+		csvWriter.Write(auditCSVHeader)
+	}
+	rows := 0
+	var batch []models.AuditLog
+	err := query.Order("id").FindInBatches(&batch, auditExportBatch, func(tx *gorm.DB, _ int) error {
+		for _, l := range batch {
+			entry := newAuditEntry(l)
+			if format == "csv" {
+				if err := csvWriter.Write(entry.csvRecord()); err != nil {
+					return err
+				}
+			} else if err := jsonWriter.Encode(entry); err != nil {
+				return err
+			}
+			rows++
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	}).Error
+	csvWriter.Flush()
+	if err != nil {
+		// the status line is already sent, the file is cut short
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "export_failed",
+			"rows":   rows,
+			"error":  err.Error(),
+		}).Error("Audit log export failed")
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"rows":   rows,
+	}).Info("Exported audit log")
+}
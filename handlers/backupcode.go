@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+)
+
+type backupCodesStatus struct {
+	Remaining int64 `json:"remaining" example:"7"`
+	Total     int   `json:"total" example:"10"`
+}
+
+type regenerateBackupCodesRequest struct {
+	Password string `json:"password" example:"password123" binding:"required"`
+}
+
+type backupCodesResponse struct {
+	Codes []string `json:"codes" example:"1234-5678-9012,2345-6789-0123"`
+	backupCodesStatus
+}
+
+// GetBackupCodes godoc
+// @Summary      Count remaining backup codes
+// @Description  Returns how many unused backup codes the current user has left. The codes themselves are only shown when they are generated.
+// @Tags         auth
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  backupCodesStatus
+// @Failure      401  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /auth/2fa/backup-codes [get]
+func GetBackupCodes(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "backup_codes_status",
+	})
+	claims, ok := currentClaims(ctx)
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_claims",
+		}).Warn("Backup code status without valid claims")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	remaining, err := models.RemainingBackupCodes(db, claims.ID)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":  "failure",
+			"reason":  "db_fetch_failed",
+			"user_id": claims.ID,
+			"error":   err.Error(),
+		}).Error("Failed to count backup codes")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count backup codes"})
+		return
+	}
+	ctx.JSON(http.StatusOK, backupCodesStatus{Remaining: remaining, Total: models.BackupCodeCount})
+}
+
+// RegenerateBackupCodes godoc
+// @Summary      Generate new backup codes
+// @Description  Replaces the backup codes of the current user with a new set of single-use codes, which invalidates every old code. The password must be confirmed. The codes are returned only in this response, store them somewhere safe.
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      regenerateBackupCodesRequest  true  "Current password"
+// @Success      200      {object}  backupCodesResponse
+// @Failure      400      {object}  failedResponse
+// @Failure      401      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /auth/2fa/backup-codes [post]
+func RegenerateBackupCodes(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "backup_codes_regenerate",
+	})
+	claims, ok := currentClaims(ctx)
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_claims",
+		}).Warn("Backup code regeneration without valid claims")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	auditLog = auditLog.WithField("user_id", claims.ID)
+	var input regenerateBackupCodesRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid backup code regeneration input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	var user models.User
+	if err := db.First(&user, claims.ID).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_fetch_failed",
+			"error":  err.Error(),
+		}).Error("Failed to fetch user for backup codes")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	auditLog = auditLog.WithField("email", user.Email)
+	// an access token alone must not be enough to mint codes that can reset the password
+	if err := user.ComparePassword(input.Password); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_password",
+		}).Warn("Wrong password for backup code regeneration")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	codes, err := models.GenerateBackupCodes(db, user.ID)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_insert_failed",
+			"error":  err.Error(),
+		}).Error("Failed to generate backup codes")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate backup codes"})
+		return
+	}
+	auditLog.WithField("status", "success").Info("Backup codes regenerated")
+	ctx.JSON(http.StatusOK, backupCodesResponse{
+		Codes: codes,
+		backupCodesStatus: backupCodesStatus{
+			Remaining: int64(len(codes)),
+			Total:     models.BackupCodeCount,
+		},
+	})
+}
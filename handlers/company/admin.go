@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"reflect"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -34,7 +33,12 @@ func GetCompanyByIDAdmin(ctx *gin.Context) {
 	// dead function just a place holder for docs
 }
 
-func handleEditAdmin[T any](ctx *gin.Context, db *gorm.DB, quarterObj *models.Quarter, table string, auditLog *logrus.Entry) {
+// handleEditAdmin saves the fields set in the request on top of the latest
+// version as a new version. Admin edits are not limited by the edit mask.
+func handleEditAdmin[T historyModel](ctx *gin.Context, db *gorm.DB, quarterObj *models.Quarter, data, table string, auditLog *logrus.Entry) {
+	if !quarterEditable(ctx, db, quarterObj, false, auditLog) {
+		return
+	}
 	var req T
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		auditLog.WithFields(logrus.Fields{
@@ -45,8 +49,11 @@ func handleEditAdmin[T any](ctx *gin.Context, db *gorm.DB, quarterObj *models.Qu
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
-	var model T
-	if err := db.Model(&model).Where("quarter_id = ? AND company_id = ?", quarterObj.ID, quarterObj.CompanyID).Order("version DESC").First(&model).Error; err != nil {
+	if respondWithInputErrors(ctx, req, table, auditLog) {
+		return
+	}
+	model, err := loadLatest[T](db, quarterObj, data)
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			auditLog.WithFields(logrus.Fields{
 				"status": "failure",
@@ -64,7 +71,11 @@ func handleEditAdmin[T any](ctx *gin.Context, db *gorm.DB, quarterObj *models.Qu
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-	if err := db.Model(&model).Updates(req).Error; err != nil {
+	overlayFields(model, req)
+	visible, editable := sectionMasks(model)
+	version := sectionVersion(model) + 1
+	resetForInsert(model, version)
+	if err := insertVersion(db, model, visible, editable); err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
 			"error":  err.Error(),
@@ -73,31 +84,23 @@ func handleEditAdmin[T any](ctx *gin.Context, db *gorm.DB, quarterObj *models.Qu
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update record"})
 		return
 	}
-	v := reflect.ValueOf(model)
-	getID := func() uint {
-		if v.Kind() == reflect.Pointer {
-			v = v.Elem()
-		}
-		idField := v.FieldByName("ID")
-		if idField.IsValid() && idField.CanUint() {
-			return uint(idField.Uint())
-		}
-		return 0
-	}
+	recordVersion(ctx, db, model.TableName(), quarterObj.CompanyID, quarterObj.ID, version, recordID(model), "admin_edit")
 	auditLog.WithFields(logrus.Fields{
-		"status": "success",
-		"table":  table,
-		"id":     getID(),
-	}).Info("Record updated successfully")
+		"status":  "success",
+		"table":   table,
+		"version": version,
+		"id":      recordID(model),
+	}).Info("Record versioned and inserted")
 	ctx.JSON(http.StatusOK, gin.H{
 		"message": fmt.Sprintf("%s updated by admin", table),
-		"id":      getID(),
+		"version": version,
+		"id":      recordID(model),
 	})
 }
 
 // EditCompanyByID godoc
 // @Summary      Edit company details (Admin, versioned insert)
-// @Description  Allows admin to insert new versioned data for company or related quarter data. If `data=info` or omitted, updates company name, contact name, and contact email. Otherwise, allows versioned updates for specific company data types (such as finance, market, uniteconomics, etc) for a given quarter and year. The allowed types are: finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, attachements. All data modifications will insert a new version for the specified quarter and year.
+// @Description  Allows admin to insert new versioned data for company or related quarter data. If `data=info` or omitted, updates the company profile: name, contact, sector, description, stage, founding date, headquarters, website, logo, social links and tags; the quarter and year are not needed then. Otherwise, allows versioned updates for specific company data types (such as finance, market, uniteconomics, etc) for a given quarter and year. The allowed types are: finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, attachements. All data modifications will insert a new version for the specified quarter and year.
 // @Security     BearerAuth
 // @Tags         admin
 // @Accept       json
@@ -128,6 +131,9 @@ func EditCompanyByID(ctx *gin.Context) {
 		"event":      "edit_company",
 		"company_id": companyID,
 	})
+	if claims, ok := vcClaims(ctx); ok {
+		auditLog = auditLog.WithFields(actorFields(claims))
+	}
 	var company models.Company
 	if err := db.Where("id = ?", companyID).First(&company).Error; err != nil {
 		auditLog.WithFields(logrus.Fields{
@@ -152,17 +158,6 @@ func EditCompanyByID(ctx *gin.Context) {
 	}
 	quarter := ctx.Query("quarter")
 	yearStr := ctx.Query("year")
-	yearUint, err := strconv.ParseUint(yearStr, 10, 32)
-	if err != nil {
-		auditLog.WithFields(logrus.Fields{
-			"status": "failure",
-			"error":  "invalid_year",
-			"value":  yearStr,
-		}).Warn("Invalid year")
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
-		return
-	}
-	year := uint(yearUint)
 	allowedData := map[string]string{
 		"info":          "",
 		"finance":       "FinancialHealths",
@@ -189,11 +184,7 @@ func EditCompanyByID(ctx *gin.Context) {
 		}
 	}
 	if data == "" || data == "info" {
-		var req struct {
-			Name         *string `json:"name"`
-			ContactName  *string `json:"contact_name"`
-			ContactEmail *string `json:"contact_email"`
-		}
+		var req companyInfoRequest
 		infoLog := auditLog.WithField("table", "companies")
 		if err := ctx.ShouldBindJSON(&req); err != nil {
 			infoLog.WithFields(logrus.Fields{
@@ -201,17 +192,17 @@ func EditCompanyByID(ctx *gin.Context) {
 				"error":  "invalid_request_body",
 				"detail": err.Error(),
 			}).Warn("Failed to parse request body")
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
 			return
 		}
-		if req.Name != nil {
-			company.Name = *req.Name
-		}
-		if req.ContactName != nil {
-			company.ContactName = *req.ContactName
-		}
-		if req.ContactEmail != nil {
-			company.ContactEmail = *req.ContactEmail
+		if err := req.apply(&company); err != nil {
+			infoLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"error":  "invalid_profile",
+				"detail": err.Error(),
+			}).Warn("Invalid company info")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 		if err := db.Save(&company).Error; err != nil {
 			infoLog.WithFields(logrus.Fields{
@@ -221,6 +212,7 @@ func EditCompanyByID(ctx *gin.Context) {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update company"})
 			return
 		}
+		StartupCache.Set(company.ID, company)
 		infoLog.WithFields(logrus.Fields{
 			"status": "success",
 			"id":     company.ID,
@@ -231,6 +223,17 @@ func EditCompanyByID(ctx *gin.Context) {
 		})
 		return
 	}
+	yearUint, err := strconv.ParseUint(yearStr, 10, 32)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"error":  "invalid_year",
+			"value":  yearStr,
+		}).Warn("Invalid year")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+	year := uint(yearUint)
 	cacheKey := fmt.Sprintf("%d_%s_%d", companyID, quarter, year)
 	var quarterObj models.Quarter
 	if val, ok := QuarterCache.Get(cacheKey); ok {
@@ -264,27 +267,27 @@ func EditCompanyByID(ctx *gin.Context) {
 	})
 	switch data {
 	case "finance":
-		handleEditAdmin[*models.FinancialHealth](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.FinancialHealth](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "market":
-		handleEditAdmin[*models.MarketTraction](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.MarketTraction](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "uniteconomics":
-		handleEditAdmin[*models.UnitEconomics](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.UnitEconomics](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "teamperf":
-		handleEditAdmin[*models.TeamPerformance](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.TeamPerformance](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "product":
-		handleEditAdmin[*models.ProductDevelopment](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.ProductDevelopment](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "fund":
-		handleEditAdmin[*models.FundraisingStatus](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.FundraisingStatus](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "competitive":
-		handleEditAdmin[*models.CompetitiveLandscape](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.CompetitiveLandscape](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "operation":
-		handleEditAdmin[*models.OperationalEfficiency](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.OperationalEfficiency](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "risk":
-		handleEditAdmin[*models.RiskManagement](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.RiskManagement](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "additional":
-		handleEditAdmin[*models.AdditionalInfo](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.AdditionalInfo](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	case "self":
-		handleEditAdmin[*models.SelfAssessment](ctx, db, &quarterObj, preloadField, sectionLog)
+		handleEditAdmin[*models.SelfAssessment](ctx, db, &quarterObj, data, preloadField, sectionLog)
 	default:
 		sectionLog.WithField("status", "failure").Warn("Unexpected data type after validation")
 		// attachments comes under upload
@@ -325,18 +328,18 @@ func DeleteCompanyByID(ctx *gin.Context) {
 		return
 	}
 	companyID := uint(idUint)
-	tx := db.Delete(&models.Company{}, companyID)
-	if tx.Error != nil {
+	deleted, err := deleteCompany(db, companyID)
+	if err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status":     "failure",
 			"reason":     "company_delete_failed",
 			"company_id": companyID,
-			"error":      tx.Error.Error(),
+			"error":      err.Error(),
 		}).Error("Failed to delete company")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete company"})
 		return
 	}
-	if tx.RowsAffected == 0 {
+	if !deleted {
 		auditLog.WithFields(logrus.Fields{
 			"status":     "failure",
 			"reason":     "company_not_exist",
@@ -345,18 +348,6 @@ func DeleteCompanyByID(ctx *gin.Context) {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "Company does not exist"})
 		return
 	}
-	if err := db.Model(&models.User{}).
-		Where("startup_id = ?", companyID).
-		Update("startup_id", nil).Error; err != nil {
-		auditLog.WithFields(logrus.Fields{
-			"status":     "failure",
-			"reason":     "unlink_users_failed",
-			"company_id": companyID,
-			"error":      err.Error(),
-		}).Error("Failed to clear company from users")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear company from users"})
-		return
-	}
 	StartupCache.Delete(companyID)
 	auditLog.WithFields(logrus.Fields{
 		"status":     "success",
@@ -367,7 +358,7 @@ func DeleteCompanyByID(ctx *gin.Context) {
 
 // AllowQuarterByID godoc
 // @Summary      Set next allowed quarter/year for a company
-// @Description  Allows a moderator to define the next quarter and year that a company is allowed to create. This updates the `planned_quarter` and `planned_year` fields for the company.
+// @Description  Allows a moderator to define the next quarter and year that a company is allowed to create. This updates the `planned_quarter` and `planned_year` fields for the company and emails its founders. If the reporting calendar already created the quarter, its deadline is lifted so the founders can finish it late.
 // @Tags         admin
 // @Security     BearerAuth
 // @Accept       json
@@ -439,10 +430,19 @@ func AllowQuarterByID(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quarter. Must be one of Q1, Q2, Q3, Q4"})
 		return
 	}
-	if err := db.Model(&company).Updates(map[string]any{
-		"planned_quarter": &request.NextQuarter,
-		"planned_year":    &request.NextYear,
-	}).Error; err != nil {
+	// opening by hand also lifts the deadline the reporting calendar set
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&company).Updates(map[string]any{
+			"planned_quarter": &request.NextQuarter,
+			"planned_year":    &request.NextYear,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Quarter{}).
+			Where("company_id = ? AND quarter = ? AND year = ?", companyID, request.NextQuarter, request.NextYear).
+			Update("deadline", nil).Error
+	})
+	if err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status":     "failure",
 			"reason":     "db_update_failed",
@@ -453,12 +453,14 @@ func AllowQuarterByID(ctx *gin.Context) {
 		return
 	}
 	StartupCache.Set(companyID, company)
+	QuarterCache.Delete(fmt.Sprintf("%d_%s_%d", companyID, request.NextQuarter, request.NextYear))
 	auditLog.WithFields(logrus.Fields{
 		"status":          "success",
 		"company_id":      companyID,
 		"planned_quarter": request.NextQuarter,
 		"planned_year":    request.NextYear,
 	}).Info("Successfully updated company's next quarter and year")
+	notifyQuarterOpened(ctx, auditLog.WithField("company_id", companyID), request.NextQuarter, request.NextYear, companyID)
 	ctx.JSON(http.StatusOK, gin.H{"message": "Company updated with next quarter/year"})
 }
 
@@ -541,7 +543,7 @@ func RemoveQuarterByID(ctx *gin.Context) {
 
 // AllowQuarter godoc
 // @Summary      Set next allowed quarter/year for all companies
-// @Description  Allows a moderator to define the next quarter and year that all companies are allowed to create. This updates the `planned_quarter` and `planned_year` fields for all companies.
+// @Description  Allows a moderator to define the next quarter and year that all companies are allowed to create. This updates the `planned_quarter` and `planned_year` fields for all companies and emails their founders. Deadlines the reporting calendar set on the quarter are lifted.
 // @Tags         admin
 // @Security     BearerAuth
 // @Accept       json
@@ -575,10 +577,18 @@ func AllowQuarter(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quarter. Must be one of Q1, Q2, Q3, Q4"})
 		return
 	}
-	if err := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Model(&models.Company{}).Updates(map[string]any{
-		"planned_quarter": &request.NextQuarter,
-		"planned_year":    &request.NextYear,
-	}).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Model(&models.Company{}).Updates(map[string]any{
+			"planned_quarter": &request.NextQuarter,
+			"planned_year":    &request.NextYear,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Quarter{}).
+			Where("quarter = ? AND year = ?", request.NextQuarter, request.NextYear).
+			Update("deadline", nil).Error
+	})
+	if err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
 			"reason": "db_update_failed",
@@ -592,6 +602,7 @@ func AllowQuarter(ctx *gin.Context) {
 		"planned_quarter": request.NextQuarter,
 		"planned_year":    request.NextYear,
 	}).Info("Successfully updated all companies' next quarter and year")
+	notifyQuarterOpened(ctx, auditLog, request.NextQuarter, request.NextYear)
 	ctx.JSON(http.StatusOK, gin.H{"message": "All companies updated with next quarter/year"})
 }
 
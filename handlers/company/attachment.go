@@ -0,0 +1,415 @@
+package company
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/storage"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+const defaultMaxUploadSize = 20
+
+// attachmentFields maps the JSON name of an attachment to its struct field
+var attachmentFields = map[string]string{
+	"financial_statements":  "FinancialStatements",
+	"pitch_deck":            "PitchDeck",
+	"product_roadmap":       "ProductRoadmap",
+	"performance_dashboard": "PerformanceDashboard",
+	"org_chart":             "OrgChart",
+}
+
+// allowedUploads maps file extensions to the content type sniffed from the file.
+// Office documents are zip archives, csv files are plain text.
+var allowedUploads = map[string]string{
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".pptx": "application/zip",
+	".xlsx": "application/zip",
+	".docx": "application/zip",
+	".csv":  "text/plain",
+}
+
+func maxUploadSize() int64 {
+	size := values.GetConfig().Storage.MaxSize
+	if size <= 0 {
+		size = defaultMaxUploadSize
+	}
+	return size << 20
+}
+
+// queryQuarter resolves the quarter and year query parameters of a company.
+func queryQuarter(ctx *gin.Context, db *gorm.DB, companyID uint, auditLog *logrus.Entry) (*models.Quarter, bool) {
+	quarter := ctx.Query("quarter")
+	yearStr := ctx.Query("year")
+	yearUint, err := strconv.ParseUint(yearStr, 10, 32)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_year",
+			"year":   yearStr,
+		}).Warn("Invalid year")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return nil, false
+	}
+	year := uint(yearUint)
+	var quarterObj models.Quarter
+	cacheKey := fmt.Sprintf("%d_%s_%d", companyID, quarter, year)
+	if val, ok := QuarterCache.Get(cacheKey); ok {
+		quarterObj = val
+	} else {
+		if err := db.Where("company_id = ? AND quarter = ? AND year = ?", companyID, quarter, year).
+			First(&quarterObj).Error; err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status":  "failure",
+				"reason":  "quarter_not_found",
+				"quarter": quarter,
+				"year":    year,
+			}).Warn("Quarter not found")
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Quarter not found"})
+			return nil, false
+		}
+		QuarterCache.Set(cacheKey, quarterObj)
+	}
+	return &quarterObj, true
+}
+
+// UploadAttachment godoc
+// @Summary      Upload an attachment
+// @Description  Uploads a file for one attachment slot of the user's company and stores it as a new attachment version for the given quarter. Allowed files are pdf, png, jpg, pptx, xlsx, docx and csv.
+// @Tags         company
+// @Security     BearerAuth
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        field    path      string  true  "Attachment slot"  Enums(financial_statements, pitch_deck, product_roadmap, performance_dashboard, org_chart)
+// @Param        quarter  query     string  true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query     int     true  "Year"
+// @Param        file     formData  file    true  "File to upload"
+// @Success      200  {object}  map[string]any
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      413  {object}  map[string]string
+// @Failure      415  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/attachments/{field} [post]
+func UploadAttachment(ctx *gin.Context) {
+	db := values.GetDB()
+	store := values.GetStorage()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "upload_attachment",
+	})
+	field := ctx.Param("field")
+	structField, ok := attachmentFields[field]
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_field",
+			"field":  field,
+		}).Warn("Invalid attachment field")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment field"})
+		return
+	}
+	companyID, ok := permsCompanyID(ctx, db, auditLog)
+	if !ok {
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"company_id": companyID,
+		"field":      field,
+	})
+	quarterObj, ok := queryQuarter(ctx, db, companyID, auditLog)
+	if !ok || !quarterEditable(ctx, db, quarterObj, true, auditLog) {
+		return
+	}
+	var latest models.Attachment
+	exists := true
+	if err := db.Where("quarter_id = ? AND company_id = ?", quarterObj.ID, companyID).
+		Order("version DESC").First(&latest).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "db_error",
+				"error":  err.Error(),
+			}).Error("Failed to fetch latest attachment")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch latest attachment"})
+			return
+		}
+		exists = false
+	}
+	if exists && !slices.Contains(latest.EditableList(), field) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "edit_mask_restricted",
+		}).Warn("Upload not permitted by field-level mask")
+		ctx.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("fields not editable: [%s]", field)})
+		return
+	}
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxUploadSize())
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "file_too_large",
+			}).Warn("Uploaded file too large")
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds %d MB", maxUploadSize()>>20)})
+			return
+		}
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "missing_file",
+			"error":  err.Error(),
+		}).Warn("Missing upload file")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	expected, ok := allowedUploads[ext]
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status":    "failure",
+			"reason":    "unsupported_extension",
+			"extension": ext,
+		}).Warn("Unsupported file extension")
+		ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported file type"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "file_open_failed",
+			"error":  err.Error(),
+		}).Error("Failed to open uploaded file")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, _ := file.Read(head)
+	sniffed := http.DetectContentType(head[:n])
+	if !strings.HasPrefix(sniffed, expected) {
+		auditLog.WithFields(logrus.Fields{
+			"status":       "failure",
+			"reason":       "content_type_mismatch",
+			"extension":    ext,
+			"content_type": sniffed,
+		}).Warn("File content does not match extension")
+		ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "File content does not match its extension"})
+		return
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "file_seek_failed",
+			"error":  err.Error(),
+		}).Error("Failed to rewind uploaded file")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate file name"})
+		return
+	}
+	key := fmt.Sprintf("companies/%d/quarters/%d/%s/%s%s", companyID, quarterObj.ID, field, hex.EncodeToString(random), ext)
+	contentType := mime.TypeByExtension(ext)
+	if err := store.Put(ctx.Request.Context(), key, file, fileHeader.Size, contentType); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "storage_put_failed",
+			"error":  err.Error(),
+		}).Error("Failed to store attachment")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return
+	}
+	record := models.Attachment{
+		CompanyID:            companyID,
+		QuarterID:            quarterObj.ID,
+		Version:              1,
+		FinancialStatements:  latest.FinancialStatements,
+		PitchDeck:            latest.PitchDeck,
+		ProductRoadmap:       latest.ProductRoadmap,
+		PerformanceDashboard: latest.PerformanceDashboard,
+		OrgChart:             latest.OrgChart,
+		IsVisible:            latest.IsVisible,
+		IsEditable:           latest.IsEditable,
+	}
+	if exists {
+		record.Version = latest.Version + 1
+	}
+	reflect.ValueOf(&record).Elem().FieldByName(structField).SetString(key)
+	if exists {
+		err = insertVersion(db, &record, uint64(latest.IsVisible), uint64(latest.IsEditable))
+	} else {
+		err = db.Create(&record).Error
+	}
+	if err == nil {
+		recordVersion(ctx, db, record.TableName(), companyID, quarterObj.ID, record.Version, record.ID, "upload")
+	}
+	if err != nil {
+		store.Delete(ctx.Request.Context(), key)
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_create_failed",
+			"error":  err.Error(),
+		}).Error("Failed to insert attachment record")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add attachment"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":  "success",
+		"version": record.Version,
+		"id":      record.ID,
+		"size":    fileHeader.Size,
+	}).Info("Attachment uploaded")
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "attachment uploaded",
+		"field":   field,
+		"version": record.Version,
+		"id":      record.ID,
+	})
+}
+
+// DownloadAttachment godoc
+// @Summary      Download an attachment
+// @Description  Streams the latest file of an attachment slot for the given quarter. Users outside the company only get files allowed by the attachment's visibility mask.
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      octet-stream
+// @Param        id       path   int     true  "Company ID"
+// @Param        field    path   string  true  "Attachment slot"  Enums(financial_statements, pitch_deck, product_roadmap, performance_dashboard, org_chart)
+// @Param        quarter  query  string  true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int     true  "Year"
+// @Success      200  {file}    file
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/attachments/{id}/{field} [get]
+func DownloadAttachment(ctx *gin.Context) {
+	db := values.GetDB()
+	store := values.GetStorage()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "download_attachment",
+	})
+	field := ctx.Param("field")
+	structField, ok := attachmentFields[field]
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_field",
+			"field":  field,
+		}).Warn("Invalid attachment field")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment field"})
+		return
+	}
+	companyID, ok := permsCompanyID(ctx, db, auditLog)
+	if !ok {
+		return
+	}
+	claimsVal, exists := ctx.Get("claims")
+	if !exists {
+		auditLog.WithField("status", "failure").Warn("Unauthorized: no claims in context")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	claims, ok := claimsVal.(*Claims)
+	if !ok {
+		auditLog.WithField("status", "failure").Warn("Invalid claims format")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid claims format"})
+		return
+	}
+	auditLog = auditLog.WithFields(actorFields(claims)).WithFields(logrus.Fields{
+		"company_id": companyID,
+		"field":      field,
+	})
+	fullAccess, err := hasFullAccess(db, claims, companyID)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "not_authorized_or_not_found",
+		}).Warn("User not authorized or not found")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized or not found"})
+		return
+	}
+	quarterObj, ok := queryQuarter(ctx, db, companyID, auditLog)
+	if !ok {
+		return
+	}
+	var latest models.Attachment
+	err = db.Where("quarter_id = ? AND company_id = ?", quarterObj.ID, companyID).
+		Order("version DESC").First(&latest).Error
+	if respondWithErrorIfNeeded(ctx, err, "attachment") {
+		return
+	}
+	if !slices.Contains(latest.VisibilityList(fullAccess), field) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "not_visible",
+		}).Warn("Attachment hidden by visibility mask")
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Attachment is not visible"})
+		return
+	}
+	key := reflect.ValueOf(latest).FieldByName(structField).String()
+	if key == "" {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "not_uploaded",
+		}).Warn("Attachment not uploaded")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Attachment not uploaded"})
+		return
+	}
+	reader, size, err := store.Get(ctx.Request.Context(), key)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "storage_get_failed",
+			"error":  err.Error(),
+		}).Error("Failed to read attachment from storage")
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Attachment file missing"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attachment"})
+		return
+	}
+	defer reader.Close()
+	ext := filepath.Ext(key)
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":      "success",
+		"version":     latest.Version,
+		"full_access": fullAccess,
+	}).Info("Attachment downloaded")
+	ctx.DataFromReader(http.StatusOK, size, contentType, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s%s"`, field, ext),
+	})
+}
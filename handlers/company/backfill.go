@@ -0,0 +1,214 @@
+package company
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+// maxBackfillQuarters is how many past quarters can be opened at once.
+const maxBackfillQuarters = 12
+
+type backfillRequest struct {
+	FromQuarter string `json:"from_quarter" binding:"required" example:"Q1"`
+	FromYear    uint   `json:"from_year" binding:"required" example:"2024"`
+	ToQuarter   string `json:"to_quarter" binding:"required" example:"Q4"`
+	ToYear      uint   `json:"to_year" binding:"required" example:"2024"`
+	// Deadline is optional and must be in the future, backfilled quarters
+	// have none by default
+	Deadline *time.Time `json:"deadline,omitempty" example:"2025-06-30T00:00:00Z"`
+}
+
+type backfillResponse struct {
+	CompanyID uint              `json:"company_id" example:"1"`
+	Created   []quarterResponse `json:"created"`
+	// Skipped are the quarters of the range the company already had
+	Skipped []quarterResponse `json:"skipped"`
+}
+
+// quarterIndex numbers quarters in order, so Q4 2024 is followed by Q1 2025.
+func quarterIndex(quarter string, year uint) (int, bool) {
+	validQuarters := map[string]int{"Q1": 0, "Q2": 1, "Q3": 2, "Q4": 3}
+	q, ok := validQuarters[quarter]
+	return int(year)*4 + q, ok
+}
+
+// backfillRange lists the quarters of the request, which must have ended
+// already.
+func backfillRange(req backfillRequest, now time.Time) ([]quarterRequest, error) {
+	from, ok := quarterIndex(req.FromQuarter, req.FromYear)
+	if !ok {
+		return nil, errors.New("invalid from_quarter. Must be one of Q1, Q2, Q3, Q4")
+	}
+	to, ok := quarterIndex(req.ToQuarter, req.ToYear)
+	if !ok {
+		return nil, errors.New("invalid to_quarter. Must be one of Q1, Q2, Q3, Q4")
+	}
+	if from > to {
+		return nil, errors.New("the range must not end before it starts")
+	}
+	current := now.Year()*4 + (int(now.Month())-1)/3
+	if to >= current {
+		return nil, errors.New("only quarters that already ended can be backfilled")
+	}
+	if to-from+1 > maxBackfillQuarters {
+		return nil, fmt.Errorf("at most %d quarters can be backfilled at once", maxBackfillQuarters)
+	}
+	quarters := make([]quarterRequest, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		quarters = append(quarters, quarterRequest{Quarter: fmt.Sprintf("Q%d", i%4+1), Year: uint(i / 4)})
+	}
+	return quarters, nil
+}
+
+// BackfillQuarters godoc
+// @Summary      Open past quarters for a company
+// @Description  Lets the founders of a company that joined later report on a range of quarters that already ended, at most 12. The quarters are created as drafts flagged as backfilled and are filled in with the usual section editors. Quarters the company already has are skipped.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int              true  "Company ID"
+// @Param        body body      backfillRequest  true  "First and last quarter of the range and an optional deadline"
+// @Success      200  {object}  backfillResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/quarters/{id}/backfill [post]
+func BackfillQuarters(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "backfill_quarters",
+	})
+	companyID, ok := parseIDParam(ctx, auditLog)
+	if !ok {
+		return
+	}
+	auditLog = auditLog.WithField("company_id", companyID)
+	if claims, ok := vcClaims(ctx); ok {
+		auditLog = auditLog.WithField("user_id", claims.ID)
+	}
+	var req backfillRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_request_body",
+			"error":  err.Error(),
+		}).Warn("Failed to bind request JSON")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	now := time.Now()
+	if req.Deadline != nil && !req.Deadline.After(now) {
+		auditLog.WithFields(logrus.Fields{
+			"status":   "failure",
+			"reason":   "deadline_passed",
+			"deadline": req.Deadline.Format(time.RFC3339),
+		}).Warn("Backfill deadline is not in the future")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "The deadline must be in the future"})
+		return
+	}
+	quarters, err := backfillRange(req, now)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_range",
+			"error":  err.Error(),
+		}).Warn("Invalid backfill range")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var company models.Company
+	if err := db.Select("id").First(&company, companyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "company_not_found",
+			}).Warn("Company not found")
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Could not find company"})
+			return
+		}
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_error",
+			"error":  err.Error(),
+		}).Error("Failed to retrieve company")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve company"})
+		return
+	}
+	response := backfillResponse{CompanyID: companyID, Created: []quarterResponse{}, Skipped: []quarterResponse{}}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// deleted quarters still hold their place in the unique index
+		var existing []models.Quarter
+		if err := tx.Unscoped().Select("quarter", "year").Where("company_id = ?", companyID).Find(&existing).Error; err != nil {
+			return err
+		}
+		taken := make(map[quarterKey]bool, len(existing))
+		for _, q := range existing {
+			taken[quarterKey{q.Quarter, q.Year}] = true
+		}
+		rows := make([]models.Quarter, 0, len(quarters))
+		for _, q := range quarters {
+			if taken[quarterKey{q.Quarter, q.Year}] {
+				response.Skipped = append(response.Skipped, quarterResponse{Quarter: q.Quarter, Year: q.Year})
+				continue
+			}
+			rows = append(rows, models.Quarter{
+				CompanyID:  companyID,
+				Quarter:    q.Quarter,
+				Year:       q.Year,
+				Date:       now,
+				Status:     models.QuarterDraft,
+				Deadline:   req.Deadline,
+				Backfilled: true,
+			})
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			response.Created = append(response.Created, quarterResponse{
+				ID:         row.ID,
+				Quarter:    row.Quarter,
+				Year:       row.Year,
+				Date:       row.Date.String(),
+				Status:     row.Status,
+				Deadline:   row.Deadline,
+				Backfilled: true,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_error",
+			"error":  err.Error(),
+		}).Error("Failed to create backfilled quarters")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create quarters"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":  "success",
+		"from":    fmt.Sprintf("%s %d", req.FromQuarter, req.FromYear),
+		"to":      fmt.Sprintf("%s %d", req.ToQuarter, req.ToYear),
+		"created": len(response.Created),
+		"skipped": len(response.Skipped),
+	}).Info("Backfilled quarters opened")
+	ctx.JSON(http.StatusOK, response)
+}
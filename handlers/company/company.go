@@ -27,8 +27,9 @@ type createCompanyRequest struct {
 	Name         string `json:"name" binding:"required" example:"Acme Inc"`
 	ContactName  string `json:"contact_name" binding:"required" example:"John Doe"`
 	ContactEmail string `json:"contact_email" binding:"required,email" example:"john@acme.com"`
-	Sector       string `json:"sector" binding:"required" example:"xyz"`
-	Description  string `json:"description" binding:"required" example:"We do something xyz and make money"`
+	// Sector is one of GET /company/taxonomy
+	Sector      string `json:"sector" binding:"required" example:"fintech"`
+	Description string `json:"description" binding:"required" example:"We do something xyz and make money"`
 }
 
 type nextQuarter struct {
@@ -41,10 +42,15 @@ type quarterResponse struct {
 	Quarter string `json:"quarter" example:"Q1"`
 	Year    uint   `json:"year" example:"2025"`
 	Date    string `json:"date,omitempty" example:"2025-04-01T00:00:00Z"`
+	Status  string `json:"status" example:"draft"`
+	// Deadline is when founders can no longer change or submit the quarter
+	Deadline   *time.Time `json:"deadline,omitempty" example:"2025-05-01T00:00:00Z"`
+	Backfilled bool       `json:"backfilled" example:"false"`
 }
 
 type joinCompanyRequest struct {
-	SecretCode string `json:"secret_code" binding:"required" example:"random hex"`
+	// SecretCode is a join code handed out by the founder
+	SecretCode string `json:"secret_code" binding:"required" example:"3f2a9c0e5b7d1a4e6c8f0b2d"`
 }
 
 type quarterRequest struct {
@@ -58,38 +64,58 @@ type versionInfo struct {
 }
 
 type editableModel interface {
+	TableName() string
 	EditableFilter() error
 }
 
+type permsModel interface {
+	TableName() string
+	VisibilityList(bool) []string
+}
+
+type permsRequest struct {
+	Fields map[string]bool `json:"fields" binding:"required"`
+}
+
+type permsResponse struct {
+	CompanyID uint            `json:"company_id" example:"1"`
+	QuarterID uint            `json:"quarter_id" example:"1"`
+	Data      string          `json:"data" example:"finance"`
+	Fields    map[string]bool `json:"fields"`
+}
+
 type financeMetric struct {
-	QuarterlyRevenue string    `json:"quarterly_revenue"`
-	RevenueGrowth    string    `json:"revenue_growth"`
-	GrossMargin      string    `json:"gross_margin"`
-	NetMargin        string    `json:"net_margin"`
-	Quarter          string    `json:"quarter"`
-	Year             uint      `json:"year"`
-	Date             time.Time `json:"date"`
+	QuarterlyRevenue models.Money   `json:"quarterly_revenue" gorm:"embedded;embeddedPrefix:quarterly_revenue_"`
+	RevenueGrowth    models.Percent `json:"revenue_growth"`
+	GrossMargin      models.Percent `json:"gross_margin"`
+	NetMargin        models.Percent `json:"net_margin"`
+	Quarter          string         `json:"quarter"`
+	Year             uint           `json:"year"`
+	Date             time.Time      `json:"date"`
+	Backfilled       bool           `json:"backfilled"`
 }
 
 type marketMetric struct {
-	TotalCustomers string `json:"total_customers"`
-	CustomerGrowth string `json:"customer_growth"`
-	ConversionRate string `json:"conversion_rate"`
-	RetentionRate  string `json:"retention_rate"`
-	ChurnRate      string `json:"churn_rate"`
-	Quarter        string `json:"quarter"`
-	Year           string `json:"year"`
-	Date           string `json:"date"`
+	TotalCustomers models.Decimal `json:"total_customers"`
+	CustomerGrowth models.Percent `json:"customer_growth"`
+	ConversionRate models.Percent `json:"conversion_rate"`
+	RetentionRate  models.Percent `json:"retention_rate"`
+	ChurnRate      models.Percent `json:"churn_rate"`
+	Quarter        string         `json:"quarter"`
+	Year           string         `json:"year"`
+	Date           string         `json:"date"`
+	Backfilled     bool           `json:"backfilled"`
 }
 
 type economicsMetric struct {
-	CAC        string `json:"cac"`
-	CACPayback string `json:"cac_payback"`
-	ARPU       string `json:"arpu"`
-	LTV        string `json:"ltv"`
-	Quarter    string `json:"quarter"`
-	Year       string `json:"year"`
-	Date       string `json:"date"`
+	CAC        models.Money  `json:"cac" gorm:"embedded;embeddedPrefix:cac_"`
+	CACPayback models.Months `json:"cac_payback"`
+	ARPU       models.Money  `json:"arpu" gorm:"embedded;embeddedPrefix:arpu_"`
+	LTV        models.Money  `json:"ltv" gorm:"embedded;embeddedPrefix:ltv_"`
+	Quarter    string        `json:"quarter"`
+	Year       string        `json:"year"`
+	Date       string        `json:"date"`
+	Backfilled bool          `json:"backfilled"`
 }
 
 type productMetric struct {
@@ -103,6 +129,7 @@ type productMetric struct {
 	Quarter             string `json:"quarter"`
 	Year                string `json:"year"`
 	Date                string `json:"date"`
+	Backfilled          bool   `json:"backfilled"`
 }
 
 type teamperfMetric struct {
@@ -117,6 +144,7 @@ type teamperfMetric struct {
 	Quarter                string `json:"quarter"`
 	Year                   string `json:"year"`
 	Date                   string `json:"date"`
+	Backfilled             bool   `json:"backfilled"`
 }
 
 type fundMetric struct {
@@ -126,6 +154,7 @@ type fundMetric struct {
 	Quarter               string `json:"quarter"`
 	Year                  string `json:"year"`
 	Date                  string `json:"date"`
+	Backfilled            bool   `json:"backfilled"`
 }
 
 type operationalMetric struct {
@@ -136,6 +165,7 @@ type operationalMetric struct {
 	Quarter                string `json:"quarter"`
 	Year                   string `json:"year"`
 	Date                   string `json:"date"`
+	Backfilled             bool   `json:"backfilled"`
 }
 
 type riskMetric struct {
@@ -145,6 +175,7 @@ type riskMetric struct {
 	Quarter            string `json:"quarter"`
 	Year               string `json:"year"`
 	Date               string `json:"date"`
+	Backfilled         bool   `json:"backfilled"`
 }
 
 type additionalMetric struct {
@@ -154,6 +185,7 @@ type additionalMetric struct {
 	Quarter                  string `json:"quarter"`
 	Year                     string `json:"year"`
 	Date                     string `json:"date"`
+	Backfilled               bool   `json:"backfilled"`
 }
 
 type assessmentMetric struct {
@@ -163,4 +195,5 @@ type assessmentMetric struct {
 	Quarter         string `json:"quarter"`
 	Year            string `json:"year"`
 	Date            string `json:"date"`
+	Backfilled      bool   `json:"backfilled"`
 }
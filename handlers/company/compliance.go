@@ -0,0 +1,289 @@
+package company
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+type sectionCompliance struct {
+	Section      string     `json:"section" example:"finance"`
+	Filled       bool       `json:"filled" example:"true"`
+	LastEditedAt *time.Time `json:"last_edited_at,omitempty" example:"2025-04-12T09:30:00Z"`
+}
+
+type companyCompliance struct {
+	CompanyID   uint   `json:"company_id" example:"1"`
+	CompanyName string `json:"company_name" example:"Acme Inc"`
+	QuarterID   *uint  `json:"quarter_id,omitempty" example:"7"`
+	// Status is missing when the company has no such quarter
+	Status       string              `json:"status" example:"draft"`
+	Backfilled   bool                `json:"backfilled" example:"false"`
+	Deadline     *time.Time          `json:"deadline,omitempty" example:"2025-05-01T00:00:00Z"`
+	Overdue      bool                `json:"overdue" example:"false"`
+	Filled       int                 `json:"filled" example:"9"`
+	LastEditedAt *time.Time          `json:"last_edited_at,omitempty" example:"2025-04-12T09:30:00Z"`
+	Sections     []sectionCompliance `json:"sections"`
+}
+
+type complianceResponse struct {
+	Quarter   string              `json:"quarter" example:"Q1"`
+	Year      uint                `json:"year" example:"2025"`
+	Sections  int                 `json:"sections" example:"12"`
+	Overdue   int                 `json:"overdue" example:"2"`
+	Companies []companyCompliance `json:"companies"`
+}
+
+const quarterMissing = "missing"
+
+// csvRecord is the row of the company in the CSV export, a section column
+// holds its last edit time and is empty while it is not filled in. Founders
+// pick the company name, so no cell may start a formula.
+func (c companyCompliance) csvRecord() []string {
+	record := []string{
+		strconv.FormatUint(uint64(c.CompanyID), 10),
+		c.CompanyName,
+		c.Status,
+		strconv.FormatBool(c.Backfilled),
+		formatOptionalTime(c.Deadline),
+		strconv.FormatBool(c.Overdue),
+		strconv.Itoa(c.Filled),
+		formatOptionalTime(c.LastEditedAt),
+	}
+	for _, section := range c.Sections {
+		record = append(record, formatOptionalTime(section.LastEditedAt))
+	}
+	return utils.CSVRecord(record)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func complianceCSVHeader() []string {
+	header := []string{"company_id", "company_name", "status", "backfilled", "deadline", "overdue", "filled", "last_edited_at"}
+	for _, section := range models.QuarterSections {
+		header = append(header, section.Name)
+	}
+	return header
+}
+
+// complianceQuarter is the quarter asked for, or the one the reporting
+// calendar opened last.
+func complianceQuarter(ctx *gin.Context, db *gorm.DB) (string, uint, error) {
+	quarter := ctx.Query("quarter")
+	yearStr := ctx.Query("year")
+	if quarter == "" && yearStr == "" {
+		var period models.ReportingPeriod
+		err := db.Order("opens_at DESC").First(&period).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", 0, errors.New("quarter and year are required")
+		}
+		return period.Quarter, period.Year, err
+	}
+	validQuarters := map[string]bool{"Q1": true, "Q2": true, "Q3": true, "Q4": true}
+	if !validQuarters[quarter] {
+		return "", 0, errors.New("invalid quarter. Must be one of Q1, Q2, Q3, Q4")
+	}
+	year, err := strconv.ParseUint(yearStr, 10, 32)
+	if err != nil {
+		return "", 0, errors.New("invalid year")
+	}
+	return quarter, uint(year), nil
+}
+
+// GetCompliance godoc
+// @Summary      Report which companies filled in a quarter
+// @Description  Lists every company with the status and deadline of its quarter, whether it is overdue and, for each of the 12 sections, whether it is filled in and when it was last edited. Without quarter and year the quarter the reporting calendar opened last is used. With format=csv the report is exported as a file.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Produce      text/csv
+// @Param        quarter  query     string  false  "Quarter"  Enums(Q1, Q2, Q3, Q4)
+// @Param        year     query     int     false  "Year"
+// @Param        overdue  query     bool    false  "Only companies that are overdue"
+// @Param        format   query     string  false  "Response format"  Enums(json, csv)
+// @Success      200  {object}  complianceResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/compliance [get]
+func GetCompliance(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "get_compliance",
+	})
+	format := ctx.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_format",
+		}).Warn("Invalid compliance report format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+	onlyOverdue := ctx.Query("overdue") == "true"
+	quarter, year, err := complianceQuarter(ctx, db)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_quarter",
+			"error":  err.Error(),
+		}).Warn("Invalid compliance report quarter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"quarter": quarter,
+		"year":    year,
+		"format":  format,
+	})
+	fail := func(err error, message string) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error(message)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build the compliance report"})
+	}
+	var companies []models.Company
+	if err := db.Select("id", "name").Order("name, id").Find(&companies).Error; err != nil {
+		fail(err, "Failed to fetch companies")
+		return
+	}
+	var quarters []models.Quarter
+	if err := db.Where("quarter = ? AND year = ?", quarter, year).Find(&quarters).Error; err != nil {
+		fail(err, "Failed to fetch quarters")
+		return
+	}
+	byCompany := make(map[uint]*models.Quarter, len(quarters))
+	quarterIDs := make([]uint, 0, len(quarters))
+	for i := range quarters {
+		byCompany[quarters[i].CompanyID] = &quarters[i]
+		quarterIDs = append(quarterIDs, quarters[i].ID)
+	}
+	// one query per section, whatever the number of companies
+	lastEdits := make(map[string]map[uint]time.Time, len(models.QuarterSections))
+	for _, section := range models.QuarterSections {
+		lastEdits[section.Name] = map[uint]time.Time{}
+		if len(quarterIDs) == 0 {
+			continue
+		}
+		var rows []struct {
+			QuarterID    uint
+			LastEditedAt time.Time
+		}
+		if err := db.Table(section.Table).
+			Select("quarter_id, MAX(updated_at) AS last_edited_at").
+			Where("quarter_id IN ? AND deleted_at IS NULL", quarterIDs).
+			Group("quarter_id").
+			Scan(&rows).Error; err != nil {
+			fail(err, fmt.Sprintf("Failed to fetch %s edits", section.Name))
+			return
+		}
+		for _, row := range rows {
+			lastEdits[section.Name][row.QuarterID] = row.LastEditedAt
+		}
+	}
+	// companies without the quarter are overdue once the calendar closed it
+	var periodDeadline *time.Time
+	var period models.ReportingPeriod
+	if err := db.Where("quarter = ? AND year = ?", quarter, year).First(&period).Error; err == nil {
+		periodDeadline = &period.Deadline
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		fail(err, "Failed to fetch reporting period")
+		return
+	}
+	now := time.Now()
+	response := complianceResponse{
+		Quarter:   quarter,
+		Year:      year,
+		Sections:  len(models.QuarterSections),
+		Companies: make([]companyCompliance, 0, len(companies)),
+	}
+	for _, company := range companies {
+		row := companyCompliance{
+			CompanyID:   company.ID,
+			CompanyName: company.Name,
+			Status:      quarterMissing,
+			Sections:    make([]sectionCompliance, 0, len(models.QuarterSections)),
+		}
+		quarterObj, found := byCompany[company.ID]
+		if found {
+			row.QuarterID = &quarterObj.ID
+			row.Status = quarterObj.Status
+			if row.Status == "" {
+				row.Status = models.QuarterDraft
+			}
+			row.Backfilled = quarterObj.Backfilled
+			row.Deadline = quarterObj.Deadline
+			row.Overdue = quarterObj.Overdue(now)
+		} else if periodDeadline != nil {
+			row.Deadline = periodDeadline
+			row.Overdue = !now.Before(*periodDeadline)
+		}
+		for _, section := range models.QuarterSections {
+			status := sectionCompliance{Section: section.Name}
+			if found {
+				if edited, ok := lastEdits[section.Name][quarterObj.ID]; ok {
+					status.Filled = true
+					status.LastEditedAt = &edited
+					row.Filled++
+					if row.LastEditedAt == nil || edited.After(*row.LastEditedAt) {
+						row.LastEditedAt = &edited
+					}
+				}
+			}
+			row.Sections = append(row.Sections, status)
+		}
+		if row.Overdue {
+			response.Overdue++
+		}
+		if onlyOverdue && !row.Overdue {
+			continue
+		}
+		response.Companies = append(response.Companies, row)
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":    "success",
+		"companies": len(response.Companies),
+		"overdue":   response.Overdue,
+	}).Info("Built compliance report")
+	if format == "json" {
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+	filename := fmt.Sprintf("compliance-%s-%d.csv", quarter, year)
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Status(http.StatusOK)
+	writer := csv.NewWriter(ctx.Writer)
+	writer.Write(complianceCSVHeader())
+	for _, row := range response.Companies {
+		writer.Write(row.csvRecord())
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "write_failed",
+			"error":  err.Error(),
+		}).Error("Failed to write compliance report")
+	}
+}
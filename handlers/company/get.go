@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/rbac"
 	"github.com/vnestcc/dashboard/utils"
 	"github.com/vnestcc/dashboard/utils/values"
 	"gorm.io/gorm"
@@ -28,6 +29,43 @@ func extractQuarterID(item any) uint {
 	return 0
 }
 
+// actorFields are the audit fields naming the caller, with the token and
+// service account for requests made with an API token.
+func actorFields(claims *Claims) logrus.Fields {
+	fields := logrus.Fields{"user_id": claims.ID}
+	if claims.TokenID != 0 {
+		fields["token_id"] = claims.TokenID
+	}
+	if claims.ServiceAccountID != 0 {
+		fields["service_account_id"] = claims.ServiceAccountID
+	}
+	return fields
+}
+
+// hasFullAccess reports whether the caller may read every field of any company
+// or is a member of the company. Everyone else, service accounts included,
+// only gets the fields allowed by the IsVisible masks.
+func hasFullAccess(db *gorm.DB, claims *Claims, companyID uint) (bool, error) {
+	if rbac.Can(claims.Role, rbac.CompanyReadFull) {
+		return true, nil
+	}
+	if claims.ServiceAccountID != 0 {
+		return false, nil
+	}
+	var access sql.NullInt64
+	err := db.Raw(`
+		SELECT CASE WHEN startup_id = ? THEN 1 ELSE 0 END
+		FROM users WHERE id = ?
+	`, companyID, claims.ID).Scan(&access).Error
+	if err != nil {
+		return false, err
+	}
+	if !access.Valid {
+		return false, gorm.ErrRecordNotFound
+	}
+	return access.Int64 == 1, nil
+}
+
 func respondWithErrorIfNeeded(ctx *gin.Context, err error, label string) bool {
 	auditLog := utils.Logger.WithFields(logrus.Fields{
 		"ip":    ctx.ClientIP(),
@@ -390,7 +428,7 @@ func GetCompanyByID(ctx *gin.Context) {
 		"risk":          "risk",
 		"additional":    "additional",
 		"self":          "assessment",
-		"attachements":  "attachement",
+		"attachements":  "attachment",
 		"product":       "product",
 	}
 	if data != "" {
@@ -415,6 +453,7 @@ func GetCompanyByID(ctx *gin.Context) {
 			"company_name":          company.Name,
 			"company_contact_name":  company.ContactName,
 			"company_contact_email": company.ContactEmail,
+			"company_profile":       newCompanyProfile(&company),
 		})
 		return
 	}
@@ -447,22 +486,17 @@ func GetCompanyByID(ctx *gin.Context) {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid claims format"})
 		return
 	}
-	var access sql.NullInt64
-	err = db.Raw(`
-		SELECT CASE WHEN ? = 'admin' OR startup_id = ? THEN 1 ELSE 0 END 
-		FROM users WHERE id = ?
-	`, claims.Role, companyID, claims.ID).Scan(&access).Error
-	if err != nil || !access.Valid {
+	auditLog = auditLog.WithFields(actorFields(claims))
+	fullAccess, err := hasFullAccess(db, claims, companyID)
+	if err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status":     "failure",
 			"reason":     "not_authorized_or_not_found",
 			"company_id": companyID,
-			"user_id":    claims.ID,
 		}).Warn("User not authorized or not found")
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized or not found"})
 		return
 	}
-	fullAccess := access.Int64 == 1
 	table := allowedData[data]
 	auditLog.WithFields(logrus.Fields{
 		"status":      "success",
@@ -471,7 +505,6 @@ func GetCompanyByID(ctx *gin.Context) {
 		"quarter":     quarter,
 		"year":        year,
 		"full_access": fullAccess,
-		"user_id":     claims.ID,
 	}).Info("Fetching company data section")
 	handleDataSection(ctx, db, companyID, quarter, year, table, fullAccess)
 }
@@ -484,6 +517,7 @@ func GetCompanyByID(ctx *gin.Context) {
 // @Produce     json
 // @Param       id   path   int    true  "Company ID"
 // @Param       key  query  string true  "Metric key" Enums(finance, market, economics, teamperf, fund, operational, risk, additional, self, product)
+// @Param       derived  query  bool  false  "For finance, market and economics also return KPIs computed from the reported figures, flagging values that disagree. Without full access to the company, KPIs needing a hidden figure are left out and hidden reported values are null"
 // @Success     200  {object} map[string]any          "Success (company_id and metrics array/object)"
 // @Failure     400  {object} map[string]string       "Bad request (missing or invalid params)"
 // @Failure     404  {object} map[string]string       "Not found"
@@ -496,6 +530,9 @@ func CompanyMetrics(ctx *gin.Context) {
 		"type":  "audit",
 		"event": "get_company_metrics_by_id",
 	})
+	if claims, ok := vcClaims(ctx); ok {
+		auditLog = auditLog.WithFields(actorFields(claims))
+	}
 	idStr := ctx.Param("id")
 	idUint, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
@@ -544,13 +581,15 @@ func CompanyMetrics(ctx *gin.Context) {
 		var results []financeMetric
 		if err := db.Raw(`
 		SELECT
-    	fin.quarterly_revenue,
+    	fin.quarterly_revenue_amount,
+    	fin.quarterly_revenue_currency,
 	    fin.revenue_growth,
 			fin.gross_margin,
 			fin.net_margin,
   	  qua.quarter,
     	qua.year,
-	    qua.date
+	    qua.date,
+	    qua.backfilled
 		FROM (
   	  SELECT DISTINCT ON (quarter_id) *
     	FROM finance
@@ -590,10 +629,14 @@ func CompanyMetrics(ctx *gin.Context) {
 			"key":        key,
 			"rows":       len(results),
 		}).Info("Finance metrics retrieved successfully")
-		ctx.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"company_id": company.ID,
 			"metrics":    results,
-		})
+		}
+		if !addDerived(ctx, db, company.ID, "finance", response, auditLog) {
+			return
+		}
+		ctx.JSON(http.StatusOK, response)
 
 	case "market":
 		var metrics []marketMetric
@@ -606,7 +649,8 @@ func CompanyMetrics(ctx *gin.Context) {
             m.churn_rate, 
             q.quarter, 
             q.year, 
-            q.date
+            q.date,
+            q.backfilled
         FROM (
             SELECT DISTINCT ON (quarter_id) *
             FROM market
@@ -647,21 +691,29 @@ func CompanyMetrics(ctx *gin.Context) {
 			"key":        key,
 			"rows":       len(metrics),
 		}).Info("Market metrics retrieved successfully")
-		ctx.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"company_id": company.ID,
 			"metrics":    metrics,
-		})
+		}
+		if !addDerived(ctx, db, company.ID, "market", response, auditLog) {
+			return
+		}
+		ctx.JSON(http.StatusOK, response)
 	case "economics":
 		var metrics []economicsMetric
 		if err := db.Raw(`
         SELECT 
-            e.cac, 
+            e.cac_amount, 
+            e.cac_currency, 
             e.cac_payback, 
-            e.arpu, 
-            e.ltv, 
+            e.arpu_amount, 
+            e.arpu_currency, 
+            e.ltv_amount, 
+            e.ltv_currency, 
             q.quarter, 
             q.year, 
-            q.date
+            q.date,
+            q.backfilled
         FROM (
             SELECT DISTINCT ON (quarter_id) *
             FROM economics
@@ -702,10 +754,14 @@ func CompanyMetrics(ctx *gin.Context) {
 			"key":        key,
 			"rows":       len(metrics),
 		}).Info("Economics metrics retrieved successfully")
-		ctx.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"company_id": company.ID,
 			"metrics":    metrics,
-		})
+		}
+		if !addDerived(ctx, db, company.ID, "economics", response, auditLog) {
+			return
+		}
+		ctx.JSON(http.StatusOK, response)
 	case "product":
 		var metrics []productMetric
 		if err := db.Raw(`
@@ -719,7 +775,8 @@ func CompanyMetrics(ctx *gin.Context) {
             p.product_bottlenecks, 
             q.quarter, 
             q.year, 
-            q.date
+            q.date,
+            q.backfilled
         FROM (
             SELECT DISTINCT ON (quarter_id) *
             FROM product
@@ -778,7 +835,8 @@ func CompanyMetrics(ctx *gin.Context) {
 						t.skill_gaps,
 						q.quarter,
 						q.year,
-						q.date
+						q.date,
+						q.backfilled
 				FROM (
 						SELECT DISTINCT ON (quarter_id) *
 						FROM teamperf
@@ -832,7 +890,8 @@ func CompanyMetrics(ctx *gin.Context) {
             f.valuation_expectations,
             q.quarter,
             q.year,
-            q.date
+            q.date,
+            q.backfilled
         FROM (
             SELECT DISTINCT ON (quarter_id) *
             FROM fund
@@ -887,7 +946,8 @@ func CompanyMetrics(ctx *gin.Context) {
             o.scaling_plans,
             q.quarter,
             q.year,
-            q.date
+            q.date,
+            q.backfilled
         FROM (
             SELECT DISTINCT ON (quarter_id) *
             FROM operational
@@ -941,7 +1001,8 @@ func CompanyMetrics(ctx *gin.Context) {
 						r.regulatory_concerns,
             q.quarter,
             q.year,
-            q.date
+            q.date,
+            q.backfilled
         FROM (
             SELECT DISTINCT ON (quarter_id) *
             FROM risk
@@ -995,7 +1056,8 @@ func CompanyMetrics(ctx *gin.Context) {
             a.initiative_progress,
             q.quarter,
             q.year,
-            q.date
+            q.date,
+            q.backfilled
         FROM (
             SELECT DISTINCT ON (quarter_id) *
             FROM additional
@@ -1049,7 +1111,8 @@ func CompanyMetrics(ctx *gin.Context) {
 						a.overall_rating,
             q.quarter,
             q.year,
-            q.date
+            q.date,
+            q.backfilled
         FROM (
             SELECT DISTINCT ON (quarter_id) *
             FROM assessment
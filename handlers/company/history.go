@@ -0,0 +1,430 @@
+package company
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/rbac"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+type historyModel interface {
+	permsModel
+	VisibilityFilter(bool) map[string]any
+}
+
+type editorInfo struct {
+	ID    uint   `json:"id" example:"1"`
+	Name  string `json:"name" example:"John Doe"`
+	Email string `json:"email" example:"john@acme.com"`
+	Role  string `json:"role" example:"user"`
+}
+
+type versionEntry struct {
+	ID        uint        `json:"id" example:"1"`
+	Version   uint32      `json:"version" example:"2"`
+	CreatedAt time.Time   `json:"created_at"`
+	Action    string      `json:"action,omitempty" example:"edit"`
+	EditedBy  *editorInfo `json:"edited_by,omitempty"`
+}
+
+type versionListResponse struct {
+	CompanyID uint           `json:"company_id" example:"1"`
+	QuarterID uint           `json:"quarter_id" example:"1"`
+	Data      string         `json:"data" example:"finance"`
+	Versions  []versionEntry `json:"versions"`
+}
+
+type fieldChange struct {
+	Field string `json:"field" example:"cash_balance"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+type versionDiffResponse struct {
+	CompanyID uint          `json:"company_id" example:"1"`
+	QuarterID uint          `json:"quarter_id" example:"1"`
+	Data      string        `json:"data" example:"finance"`
+	From      uint32        `json:"from" example:"1"`
+	To        uint32        `json:"to" example:"2"`
+	Changes   []fieldChange `json:"changes"`
+}
+
+// sectionPreloads lists the child rows that belong to a version of a section.
+var sectionPreloads = map[string]string{
+	"finance":       "RevenueBreakdowns",
+	"uniteconomics": "MarketingBreakdowns",
+}
+
+// recordVersion notes who created a version of a section. A missing log only
+// hides the editor in the history, so failures are logged and ignored.
+func recordVersion(ctx *gin.Context, db *gorm.DB, section string, companyID, quarterID uint, version uint32, recordID uint, action string) {
+	entry := models.VersionLog{
+		Section:   section,
+		CompanyID: companyID,
+		QuarterID: quarterID,
+		Version:   version,
+		RecordID:  recordID,
+		Action:    action,
+	}
+	if claimsVal, ok := ctx.Get("claims"); ok {
+		if claims, ok := claimsVal.(*Claims); ok {
+			entry.UserID = claims.ID
+		}
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"type":       "audit",
+			"event":      "record_version",
+			"status":     "failure",
+			"section":    section,
+			"company_id": companyID,
+			"version":    version,
+			"error":      err.Error(),
+		}).Error("Failed to record version author")
+	}
+}
+
+// recordID reads the primary key of a section row.
+func recordID(model any) uint {
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	idField := v.FieldByName("ID")
+	if idField.IsValid() && idField.CanUint() {
+		return uint(idField.Uint())
+	}
+	return 0
+}
+
+func loadVersion[T historyModel](db *gorm.DB, quarterObj *models.Quarter, data string, version uint32) (T, error) {
+	var model T
+	query := db.Where("quarter_id = ? AND company_id = ? AND version = ?", quarterObj.ID, quarterObj.CompanyID, version)
+	if preload, ok := sectionPreloads[data]; ok {
+		query = query.Preload(preload)
+	}
+	err := query.First(&model).Error
+	return model, err
+}
+
+func listVersions[T historyModel](ctx *gin.Context, db *gorm.DB, quarterObj *models.Quarter, data string, showEditors bool, auditLog *logrus.Entry) {
+	var model T
+	var rows []struct {
+		ID        uint
+		Version   uint32
+		CreatedAt time.Time
+	}
+	err := db.Model(&model).
+		Select("id, version, created_at").
+		Where("quarter_id = ? AND company_id = ?", quarterObj.ID, quarterObj.CompanyID).
+		Order("version").
+		Scan(&rows).Error
+	if err == nil && len(rows) == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+	if respondWithErrorIfNeeded(ctx, err, data) {
+		return
+	}
+	var logs []models.VersionLog
+	if err := db.Where("section = ? AND company_id = ? AND quarter_id = ?", model.TableName(), quarterObj.CompanyID, quarterObj.ID).
+		Order("id").Find(&logs).Error; err != nil {
+		respondWithErrorIfNeeded(ctx, err, data)
+		return
+	}
+	// the last log of a version wins, so admin edits show up over the original author
+	logByVersion := make(map[uint32]models.VersionLog, len(logs))
+	userIDs := []uint{}
+	for _, l := range logs {
+		logByVersion[l.Version] = l
+		userIDs = append(userIDs, l.UserID)
+	}
+	editors := map[uint]*editorInfo{}
+	if showEditors && len(userIDs) > 0 {
+		var users []models.User
+		if err := db.Unscoped().Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			respondWithErrorIfNeeded(ctx, err, data)
+			return
+		}
+		for _, u := range users {
+			editors[u.ID] = &editorInfo{ID: u.ID, Name: u.Name, Email: u.Email, Role: u.Role}
+		}
+	}
+	versions := make([]versionEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := versionEntry{ID: row.ID, Version: row.Version, CreatedAt: row.CreatedAt}
+		if l, ok := logByVersion[row.Version]; ok {
+			entry.Action = l.Action
+			entry.EditedBy = editors[l.UserID]
+		}
+		versions = append(versions, entry)
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":   "success",
+		"versions": len(versions),
+	}).Info("Listed section versions")
+	ctx.JSON(http.StatusOK, versionListResponse{
+		CompanyID: quarterObj.CompanyID,
+		QuarterID: quarterObj.ID,
+		Data:      data,
+		Versions:  versions,
+	})
+}
+
+func getVersion[T historyModel](ctx *gin.Context, db *gorm.DB, quarterObj *models.Quarter, data string, version uint32, fullAccess bool, auditLog *logrus.Entry) {
+	model, err := loadVersion[T](db, quarterObj, data, version)
+	if respondWithErrorIfNeeded(ctx, err, data) {
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":  "success",
+		"version": version,
+	}).Info("Fetched section version")
+	ctx.JSON(http.StatusOK, gin.H{
+		"quarter_id": quarterObj.ID,
+		"data":       model.VisibilityFilter(fullAccess),
+	})
+}
+
+func diffVersions[T historyModel](ctx *gin.Context, db *gorm.DB, quarterObj *models.Quarter, data string, from, to uint32, fullAccess bool, auditLog *logrus.Entry) {
+	before, err := loadVersion[T](db, quarterObj, data, from)
+	if respondWithErrorIfNeeded(ctx, err, data) {
+		return
+	}
+	after, err := loadVersion[T](db, quarterObj, data, to)
+	if respondWithErrorIfNeeded(ctx, err, data) {
+		return
+	}
+	beforeFields := before.VisibilityFilter(fullAccess)
+	afterFields := after.VisibilityFilter(fullAccess)
+	changes := []fieldChange{}
+	for _, field := range after.VisibilityList(true) {
+		oldValue, inBefore := beforeFields[field]
+		newValue, inAfter := afterFields[field]
+		if !inBefore || !inAfter {
+			continue
+		}
+		// compare the serialized form, breakdown rows get new IDs every version
+		oldJSON, _ := json.Marshal(oldValue)
+		newJSON, _ := json.Marshal(newValue)
+		if string(oldJSON) != string(newJSON) {
+			changes = append(changes, fieldChange{Field: field, From: oldValue, To: newValue})
+		}
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":  "success",
+		"from":    from,
+		"to":      to,
+		"changes": len(changes),
+	}).Info("Diffed section versions")
+	ctx.JSON(http.StatusOK, versionDiffResponse{
+		CompanyID: quarterObj.CompanyID,
+		QuarterID: quarterObj.ID,
+		Data:      data,
+		From:      from,
+		To:        to,
+		Changes:   changes,
+	})
+}
+
+func parseVersion(value string) (uint32, error) {
+	v, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || v == 0 {
+		return 0, fmt.Errorf("invalid version %q", value)
+	}
+	return uint32(v), nil
+}
+
+func handleHistory(ctx *gin.Context, mode string) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "section_history_" + mode,
+	})
+	idStr := ctx.Param("id")
+	idUint, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "invalid_company_id",
+			"company_id": idStr,
+		}).Warn("Invalid company ID")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+	companyID := uint(idUint)
+	auditLog = auditLog.WithField("company_id", companyID)
+	claims, ok := vcClaims(ctx)
+	if !ok {
+		auditLog.WithField("status", "failure").Warn("Unauthorized: no claims in context")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	auditLog = auditLog.WithField("user_id", claims.ID)
+	fullAccess, err := hasFullAccess(db, claims, companyID)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "not_authorized_or_not_found",
+		}).Warn("User not authorized or not found")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized or not found"})
+		return
+	}
+	data := ctx.Query("data")
+	if !permsSections[data] {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_data_param",
+			"data":   data,
+		}).Warn("Invalid data query parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data query parameter"})
+		return
+	}
+	var version, from, to uint32
+	switch mode {
+	case "get":
+		version, err = parseVersion(ctx.Param("version"))
+	case "diff":
+		from, err = parseVersion(ctx.Query("from"))
+		if err == nil {
+			to, err = parseVersion(ctx.Query("to"))
+		}
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_version",
+			"error":  err.Error(),
+		}).Warn("Invalid version")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+	quarterObj, ok := queryQuarter(ctx, db, companyID, auditLog)
+	if !ok {
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"quarter_id": quarterObj.ID,
+		"data":       data,
+	})
+	// editors are shown to the company itself and to the investment team
+	showEditors := fullAccess || rbac.Can(claims.Role, rbac.CompanyHistoryEditors)
+	switch data {
+	case "finance":
+		dispatchHistory[*models.FinancialHealth](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "market":
+		dispatchHistory[*models.MarketTraction](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "uniteconomics":
+		dispatchHistory[*models.UnitEconomics](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "teamperf":
+		dispatchHistory[*models.TeamPerformance](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "fund":
+		dispatchHistory[*models.FundraisingStatus](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "competitive":
+		dispatchHistory[*models.CompetitiveLandscape](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "operation":
+		dispatchHistory[*models.OperationalEfficiency](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "risk":
+		dispatchHistory[*models.RiskManagement](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "additional":
+		dispatchHistory[*models.AdditionalInfo](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "self":
+		dispatchHistory[*models.SelfAssessment](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "product":
+		dispatchHistory[*models.ProductDevelopment](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	case "attachments":
+		dispatchHistory[*models.Attachment](ctx, db, quarterObj, data, mode, version, from, to, fullAccess, showEditors, auditLog)
+	}
+}
+
+func dispatchHistory[T historyModel](
+	ctx *gin.Context,
+	db *gorm.DB,
+	quarterObj *models.Quarter,
+	data, mode string,
+	version, from, to uint32,
+	fullAccess, showEditors bool,
+	auditLog *logrus.Entry,
+) {
+	switch mode {
+	case "list":
+		listVersions[T](ctx, db, quarterObj, data, showEditors, auditLog)
+	case "get":
+		getVersion[T](ctx, db, quarterObj, data, version, fullAccess, auditLog)
+	case "diff":
+		diffVersions[T](ctx, db, quarterObj, data, from, to, fullAccess, auditLog)
+	}
+}
+
+// ListVersions godoc
+// @Summary      List versions of a section
+// @Description  Lists every saved version of a company's section for the given quarter, oldest first, with who saved it and when. Editors are only shown to the company itself, moderators and admins.
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path   int     true  "Company ID"
+// @Param        data     query  string  true  "Section"  Enums(finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, product, attachments)
+// @Param        quarter  query  string  true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int     true  "Year"
+// @Success      200  {object}  versionListResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/history/{id} [get]
+func ListVersions(ctx *gin.Context) {
+	handleHistory(ctx, "list")
+}
+
+// GetVersion godoc
+// @Summary      Get one version of a section
+// @Description  Returns a section exactly as it was saved in the given version, filtered by the visibility mask for non-owners.
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path   int     true  "Company ID"
+// @Param        version  path   int     true  "Version"
+// @Param        data     query  string  true  "Section"  Enums(finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, product, attachments)
+// @Param        quarter  query  string  true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int     true  "Year"
+// @Success      200  {object}  map[string]any
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/history/{id}/version/{version} [get]
+func GetVersion(ctx *gin.Context) {
+	handleHistory(ctx, "get")
+}
+
+// DiffVersions godoc
+// @Summary      Diff two versions of a section
+// @Description  Returns the fields that differ between two versions of a section, in field order. Hidden fields are left out for non-owners.
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path   int     true  "Company ID"
+// @Param        data     query  string  true  "Section"  Enums(finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, product, attachments)
+// @Param        quarter  query  string  true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int     true  "Year"
+// @Param        from     query  int     true  "Older version"
+// @Param        to       query  int     true  "Newer version"
+// @Success      200  {object}  versionDiffResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/history/{id}/diff [get]
+func DiffVersions(ctx *gin.Context) {
+	handleHistory(ctx, "diff")
+}
@@ -0,0 +1,181 @@
+package company
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/kpi"
+	"github.com/vnestcc/dashboard/models"
+	"gorm.io/gorm"
+)
+
+type derivedQuarter struct {
+	Quarter    string      `json:"quarter" example:"Q1"`
+	Year       uint        `json:"year" example:"2025"`
+	Date       time.Time   `json:"date"`
+	Backfilled bool        `json:"backfilled" example:"false"`
+	Values     []kpi.Value `json:"values"`
+}
+
+type quarterKey struct {
+	quarter string
+	year    uint
+}
+
+// latestVersions loads the latest version of a section for every quarter of a company, keyed by quarter ID.
+func latestVersions[T any](db *gorm.DB, companyID uint, table string, preload string) (map[uint]*T, error) {
+	var ids []uint
+	if err := db.Raw(`
+		SELECT DISTINCT ON (quarter_id) id
+		FROM `+table+`
+		WHERE company_id = ? AND deleted_at IS NULL
+		ORDER BY quarter_id, version DESC
+	`, companyID).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint]*T, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	var rows []*T
+	query := db
+	if preload != "" {
+		query = query.Preload(preload)
+	}
+	if err := query.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[extractQuarterID(row)] = row
+	}
+	return result, nil
+}
+
+// hideFields clears the fields of a section version its IsVisible mask hides.
+func hideFields(model interface{ VisibilityList(bool) []string }) {
+	visible := map[string]bool{}
+	for _, field := range model.VisibilityList(false) {
+		visible[field] = true
+	}
+	v := reflect.ValueOf(model).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" && !visible[name] {
+			v.Field(i).SetZero()
+		}
+	}
+}
+
+// derivedSeries computes the KPIs of every quarter of a company from its
+// reported figures, keeping only the values belonging to section. Without
+// full access the hidden figures of each quarter are left out, so KPIs
+// needing them are skipped and hidden reported values are not returned.
+func derivedSeries(db *gorm.DB, companyID uint, section string, fullAccess bool) ([]derivedQuarter, error) {
+	var quarters []models.Quarter
+	if err := db.Where("company_id = ?", companyID).Order("year, quarter").Find(&quarters).Error; err != nil {
+		return nil, err
+	}
+	finance, err := latestVersions[models.FinancialHealth](db, companyID, "finance", "")
+	if err != nil {
+		return nil, err
+	}
+	market, err := latestVersions[models.MarketTraction](db, companyID, "market", "")
+	if err != nil {
+		return nil, err
+	}
+	economics, err := latestVersions[models.UnitEconomics](db, companyID, "economics", "")
+	if err != nil {
+		return nil, err
+	}
+	if !fullAccess {
+		for _, f := range finance {
+			hideFields(f)
+		}
+		for _, m := range market {
+			hideFields(m)
+		}
+		for _, e := range economics {
+			hideFields(e)
+		}
+	}
+	snapshots := make(map[quarterKey]*kpi.Snapshot, len(quarters))
+	for _, q := range quarters {
+		snapshots[quarterKey{q.Quarter, q.Year}] = &kpi.Snapshot{
+			Quarter:   q.Quarter,
+			Year:      q.Year,
+			Finance:   finance[q.ID],
+			Market:    market[q.ID],
+			Economics: economics[q.ID],
+		}
+	}
+	series := make([]derivedQuarter, 0, len(quarters))
+	for _, q := range quarters {
+		var previous *kpi.Snapshot
+		if prevQuarter, prevYear, err := kpi.PreviousQuarter(q.Quarter, q.Year); err == nil {
+			previous = snapshots[quarterKey{prevQuarter, prevYear}]
+		}
+		values := []kpi.Value{}
+		for _, v := range kpi.Compute(*snapshots[quarterKey{q.Quarter, q.Year}], previous) {
+			if v.Section == section {
+				values = append(values, v)
+			}
+		}
+		series = append(series, derivedQuarter{
+			Quarter:    q.Quarter,
+			Year:       q.Year,
+			Date:       q.Date,
+			Backfilled: q.Backfilled,
+			Values:     values,
+		})
+	}
+	return series, nil
+}
+
+// addDerived puts the computed series next to the reported metrics when the
+// caller asked for it with derived=true. It reports false after writing an error response.
+func addDerived(ctx *gin.Context, db *gorm.DB, companyID uint, section string, response gin.H, auditLog *logrus.Entry) bool {
+	if ctx.Query("derived") != "true" {
+		return true
+	}
+	fullAccess := false
+	if claims, ok := vcClaims(ctx); ok {
+		var err error
+		if fullAccess, err = hasFullAccess(db, claims, companyID); err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status":     "failure",
+				"reason":     "access_check_failed",
+				"company_id": companyID,
+				"error":      err.Error(),
+			}).Error("Failed to check access to derived metrics")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server issue"})
+			return false
+		}
+	}
+	series, err := derivedSeries(db, companyID, section, fullAccess)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "derive_failed",
+			"company_id": companyID,
+			"key":        section,
+			"error":      err.Error(),
+		}).Error("Failed to compute derived metrics")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server issue"})
+		return false
+	}
+	mismatches := 0
+	for _, q := range series {
+		for _, v := range q.Values {
+			if v.Mismatch {
+				mismatches++
+			}
+		}
+	}
+	response["derived"] = series
+	response["mismatches"] = mismatches
+	return true
+}
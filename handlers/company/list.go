@@ -81,10 +81,13 @@ func ListQuater(ctx *gin.Context) {
 	result := make([]quarterResponse, 0, len(company.Quarters))
 	for _, quarter := range company.Quarters {
 		result = append(result, quarterResponse{
-			ID:      quarter.ID,
-			Quarter: quarter.Quarter,
-			Year:    quarter.Year,
-			Date:    quarter.Date.String(),
+			ID:         quarter.ID,
+			Quarter:    quarter.Quarter,
+			Year:       quarter.Year,
+			Date:       quarter.Date.String(),
+			Status:     quarter.Status,
+			Deadline:   quarter.Deadline,
+			Backfilled: quarter.Backfilled,
 		})
 	}
 	ctx.JSON(http.StatusOK, result)
@@ -103,10 +106,10 @@ func ListCompanyAdmin(ctx *gin.Context) {
 
 // ListCompany godoc
 // @Summary      List all companies
-// @Description  Retrieves a list of all companies available in the system
+// @Description  Retrieves every company with its profile, keyed by company ID
 // @Tags         company
 // @Produce      json
-// @Success      200  {object}  map[string]string
+// @Success      200  {object}  map[string]companyListItem
 // @Router       /company/list [get]
 func ListCompany(ctx *gin.Context) {
 	db := values.GetDB()
@@ -124,13 +127,12 @@ func ListCompany(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve the company list"})
 		return
 	}
-	result := make(map[uint]any, len(companies))
+	result := make(map[uint]companyListItem, len(companies))
 	for i := range companies {
 		StartupCache.Set(companies[i].ID, companies[i])
-		result[companies[i].ID] = map[string]any{
-			"name":        companies[i].Name,
-			"sector":      companies[i].Sector,
-			"description": companies[i].Description,
+		result[companies[i].ID] = companyListItem{
+			Name:           companies[i].Name,
+			companyProfile: newCompanyProfile(&companies[i]),
 		}
 	}
 	auditLog.WithFields(logrus.Fields{
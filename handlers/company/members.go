@@ -0,0 +1,517 @@
+package company
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/handlers"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultJoinCodeExpiry = 7 * 24 * time.Hour
+	// joinCodePrefixLength is how much of a code is kept to recognise it in lists
+	joinCodePrefixLength = 4
+)
+
+var (
+	errInvalidJoinCode = errors.New("invalid, expired or used up join code")
+	errAlreadyMember   = errors.New("user already belongs to a company")
+)
+
+type createJoinCodeRequest struct {
+	ExpiresInHours *int   `json:"expires_in_hours" example:"168" binding:"omitempty,min=1,max=720"`
+	MaxUses        uint   `json:"max_uses" example:"1" binding:"max=1000"`
+	Email          string `json:"email" example:"cto@acme.com" binding:"omitempty,email"`
+}
+
+type joinCodeModel struct {
+	ID        uint       `json:"id" example:"1"`
+	Prefix    string     `json:"prefix" example:"3f2a"`
+	Email     string     `json:"email,omitempty" example:"cto@acme.com"`
+	MaxUses   uint       `json:"max_uses" example:"1"`
+	Uses      uint       `json:"uses" example:"0"`
+	Active    bool       `json:"active" example:"true"`
+	CreatedBy uint       `json:"created_by" example:"4"`
+	CreatedAt time.Time  `json:"created_at" example:"2025-04-01T00:00:00Z"`
+	ExpiresAt time.Time  `json:"expires_at" example:"2025-04-08T00:00:00Z"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type createdJoinCodeResponse struct {
+	joinCodeModel
+	Code string `json:"code" example:"3f2a9c0e5b7d1a4e6c8f0b2d"`
+}
+
+type memberModel struct {
+	ID       uint   `json:"id" example:"4"`
+	Name     string `json:"name" example:"John Doe"`
+	Email    string `json:"email" example:"john@acme.com"`
+	Position string `json:"position" example:"CTO"`
+	Founder  bool   `json:"founder" example:"false"`
+}
+
+func newJoinCodeModel(code models.JoinCode, now time.Time) joinCodeModel {
+	return joinCodeModel{
+		ID:        code.ID,
+		Prefix:    code.Prefix,
+		Email:     code.Email,
+		MaxUses:   code.MaxUses,
+		Uses:      code.Uses,
+		Active:    code.Active(now),
+		CreatedBy: code.CreatedBy,
+		CreatedAt: code.CreatedAt,
+		ExpiresAt: code.ExpiresAt,
+		RevokedAt: code.RevokedAt,
+	}
+}
+
+// memberCompany returns the caller and their company. With founderOnly the
+// request fails unless the caller is the founder of the company.
+func memberCompany(ctx *gin.Context, db *gorm.DB, founderOnly bool, auditLog *logrus.Entry) (*models.User, *models.Company, bool) {
+	claimsVal, exists := ctx.Get("claims")
+	if !exists {
+		auditLog.WithField("status", "failure").Warn("Unauthorized: no claims in context")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, nil, false
+	}
+	claims, ok := claimsVal.(*Claims)
+	if !ok {
+		auditLog.WithField("status", "failure").Warn("Invalid claims format")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid claims format"})
+		return nil, nil, false
+	}
+	var user models.User
+	if err := db.Preload("StartUp").First(&user, claims.ID).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":  "failure",
+			"user_id": claims.ID,
+			"error":   err.Error(),
+		}).Error("Failed to fetch user")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return nil, nil, false
+	}
+	if user.StartUp == nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":  "failure",
+			"user_id": user.ID,
+			"reason":  "no_company",
+		}).Warn("User does not belong to a company")
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "User does not belong to a company"})
+		return nil, nil, false
+	}
+	if founderOnly && (user.StartUp.FounderID == nil || *user.StartUp.FounderID != user.ID) {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"user_id":    user.ID,
+			"company_id": user.StartUp.ID,
+			"reason":     "not_founder",
+		}).Warn("Only the founder can manage the company members")
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the founder of the company can do this"})
+		return nil, nil, false
+	}
+	return &user, user.StartUp, true
+}
+
+// issueJoinCode stores a new code for the company and returns it with the
+// code in clear, which is never shown again.
+func issueJoinCode(tx *gorm.DB, companyID, createdBy uint, email string, maxUses uint, expiresAt time.Time) (createdJoinCodeResponse, error) {
+	code, hash, err := models.NewJoinCode()
+	if err != nil {
+		return createdJoinCodeResponse{}, err
+	}
+	joinCode := models.JoinCode{
+		CompanyID: companyID,
+		CodeHash:  hash,
+		Prefix:    code[:joinCodePrefixLength],
+		Email:     email,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+		CreatedBy: createdBy,
+	}
+	if err := tx.Create(&joinCode).Error; err != nil {
+		return createdJoinCodeResponse{}, err
+	}
+	return createdJoinCodeResponse{joinCodeModel: newJoinCodeModel(joinCode, time.Now()), Code: code}, nil
+}
+
+func parseIDParam(ctx *gin.Context, auditLog *logrus.Entry) (uint, bool) {
+	idParam := ctx.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_id",
+			"id":     idParam,
+		}).Warn("Invalid ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ListJoinCodes godoc
+// @Summary      List join codes
+// @Description  Returns every join code of the founder's company, newest first. Codes are only shown in full when they are created.
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  []joinCodeModel
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/codes [get]
+func ListJoinCodes(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "list_join_codes",
+	})
+	user, company, ok := memberCompany(ctx, db, true, auditLog)
+	if !ok {
+		return
+	}
+	var codes []models.JoinCode
+	if err := db.Where("company_id = ?", company.ID).Order("id DESC").Find(&codes).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "db_query_failed",
+			"company_id": company.ID,
+			"error":      err.Error(),
+		}).Error("Failed to list join codes")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list join codes"})
+		return
+	}
+	now := time.Now()
+	result := make([]joinCodeModel, 0, len(codes))
+	for _, code := range codes {
+		result = append(result, newJoinCodeModel(code, now))
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":     "success",
+		"user_id":    user.ID,
+		"company_id": company.ID,
+		"count":      len(result),
+	}).Info("Listed join codes")
+	ctx.JSON(http.StatusOK, result)
+}
+
+// CreateJoinCode godoc
+// @Summary      Create a join code
+// @Description  Creates a code others use at /company/join/{id} to join the founder's company. It expires after expires_in_hours, 168 by default and at most 720, works max_uses times, or without a limit when 0, and only for the account with the email when one is given. The code is returned once.
+// @Tags         company
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body body      createJoinCodeRequest  true  "Code limits"
+// @Success      201  {object}  createdJoinCodeResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/codes [post]
+func CreateJoinCode(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "create_join_code",
+	})
+	var req createJoinCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":  "failure",
+			"reason":  "invalid_input",
+			"details": err.Error(),
+		}).Warn("Invalid input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	user, company, ok := memberCompany(ctx, db, true, auditLog)
+	if !ok {
+		return
+	}
+	expiry := defaultJoinCodeExpiry
+	if req.ExpiresInHours != nil {
+		expiry = time.Duration(*req.ExpiresInHours) * time.Hour
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	created, err := issueJoinCode(db, company.ID, user.ID, email, req.MaxUses, time.Now().Add(expiry))
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "db_insert_failed",
+			"company_id": company.ID,
+			"error":      err.Error(),
+		}).Error("Failed to create join code")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create join code"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":     "success",
+		"user_id":    user.ID,
+		"company_id": company.ID,
+		"code_id":    created.ID,
+		"max_uses":   created.MaxUses,
+		"email_lock": created.Email,
+	}).Info("Join code created")
+	ctx.JSON(http.StatusCreated, created)
+}
+
+// RotateJoinCode godoc
+// @Summary      Rotate a join code
+// @Description  Revokes the code and returns a new one with the same email lock and use limit, valid for as long as the old one was when it was created. Use it when a code leaked.
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Join code ID"
+// @Success      201  {object}  createdJoinCodeResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/codes/{id}/rotate [post]
+func RotateJoinCode(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "rotate_join_code",
+	})
+	id, ok := parseIDParam(ctx, auditLog)
+	if !ok {
+		return
+	}
+	user, company, ok := memberCompany(ctx, db, true, auditLog)
+	if !ok {
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"company_id": company.ID,
+		"code_id":    id,
+	})
+	var created createdJoinCodeResponse
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var old models.JoinCode
+		if err := tx.Where("id = ? AND company_id = ? AND revoked_at IS NULL", id, company.ID).First(&old).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&old).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		var err error
+		created, err = issueJoinCode(tx, company.ID, user.ID, old.Email, old.MaxUses, now.Add(old.ExpiresAt.Sub(old.CreatedAt)))
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "code_not_found",
+		}).Warn("Join code does not exist or was revoked")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Join code does not exist or was revoked"})
+		return
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  err.Error(),
+		}).Error("Failed to rotate join code")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate join code"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":      "success",
+		"new_code_id": created.ID,
+	}).Info("Join code rotated")
+	ctx.JSON(http.StatusCreated, created)
+}
+
+// RevokeJoinCode godoc
+// @Summary      Revoke a join code
+// @Description  Stops the code from working, members who already joined with it stay
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Join code ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/codes/{id} [delete]
+func RevokeJoinCode(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "revoke_join_code",
+	})
+	id, ok := parseIDParam(ctx, auditLog)
+	if !ok {
+		return
+	}
+	user, company, ok := memberCompany(ctx, db, true, auditLog)
+	if !ok {
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"company_id": company.ID,
+		"code_id":    id,
+	})
+	result := db.Model(&models.JoinCode{}).
+		Where("id = ? AND company_id = ? AND revoked_at IS NULL", id, company.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  result.Error.Error(),
+		}).Error("Failed to revoke join code")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke join code"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "code_not_found",
+		}).Warn("Join code does not exist or was revoked")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Join code does not exist or was revoked"})
+		return
+	}
+	auditLog.WithField("status", "success").Info("Join code revoked")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Join code revoked"})
+}
+
+// ListMembers godoc
+// @Summary      List company members
+// @Description  Returns the founders of the caller's company, marking the one who manages join codes and members
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  []memberModel
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/members [get]
+func ListMembers(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "list_company_members",
+	})
+	user, company, ok := memberCompany(ctx, db, false, auditLog)
+	if !ok {
+		return
+	}
+	var members []models.User
+	if err := db.Where("startup_id = ?", company.ID).Order("id").Find(&members).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "db_query_failed",
+			"company_id": company.ID,
+			"error":      err.Error(),
+		}).Error("Failed to list company members")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list company members"})
+		return
+	}
+	result := make([]memberModel, 0, len(members))
+	for _, member := range members {
+		result = append(result, memberModel{
+			ID:       member.ID,
+			Name:     member.Name,
+			Email:    member.Email,
+			Position: member.Position,
+			Founder:  company.FounderID != nil && *company.FounderID == member.ID,
+		})
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":     "success",
+		"user_id":    user.ID,
+		"company_id": company.ID,
+		"count":      len(result),
+	}).Info("Listed company members")
+	ctx.JSON(http.StatusOK, result)
+}
+
+// RemoveMember godoc
+// @Summary      Remove a company member
+// @Description  Takes a member out of the founder's company. The founder cannot remove themselves. Like any founder account without a company, the removed account is deleted by the periodic cleanup unless it joins or creates a company first.
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "User ID of the member"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/members/{id} [delete]
+func RemoveMember(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "remove_company_member",
+	})
+	id, ok := parseIDParam(ctx, auditLog)
+	if !ok {
+		return
+	}
+	user, company, ok := memberCompany(ctx, db, true, auditLog)
+	if !ok {
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"company_id": company.ID,
+		"member_id":  id,
+	})
+	if id == user.ID {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "remove_self",
+		}).Warn("Founder tried to remove themselves")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "The founder cannot be removed"})
+		return
+	}
+	result := db.Model(&models.User{}).
+		Where("id = ? AND startup_id = ?", id, company.ID).
+		Update("startup_id", nil)
+	if result.Error != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  result.Error.Error(),
+		}).Error("Failed to remove company member")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "member_not_found",
+		}).Warn("User is not a member of the company")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of the company"})
+		return
+	}
+	handlers.UserCache.Delete(id)
+	auditLog.WithField("status", "success").Info("Company member removed")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
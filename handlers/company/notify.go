@@ -0,0 +1,14 @@
+package company
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/reporting"
+	"github.com/vnestcc/dashboard/utils/values"
+)
+
+// notifyQuarterOpened mails the founders about a quarter a moderator opened.
+// Quarters opened by hand have no deadline.
+func notifyQuarterOpened(ctx *gin.Context, auditLog *logrus.Entry, quarter string, year uint, companyIDs ...uint) {
+	reporting.NotifyQuarterOpened(ctx.Request.Context(), values.GetDB(), values.GetMailer(), auditLog, quarter, year, nil, companyIDs...)
+}
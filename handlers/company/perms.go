@@ -1,13 +1,370 @@
 package company
 
-import "github.com/gin-gonic/gin"
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
 
-func GetVisiblePerms(ctx *gin.Context) {
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/handlers"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+var permsSections = map[string]bool{
+	"finance":       true,
+	"market":        true,
+	"uniteconomics": true,
+	"teamperf":      true,
+	"fund":          true,
+	"competitive":   true,
+	"operation":     true,
+	"risk":          true,
+	"additional":    true,
+	"self":          true,
+	"product":       true,
+	"attachments":   true,
+}
+
+var permsColumns = map[string]string{
+	"visible":  "IsVisible",
+	"editable": "IsEditable",
+}
 
+func maskToFields(fields []string, mask uint64) map[string]bool {
+	result := make(map[string]bool, len(fields))
+	for i, field := range fields {
+		result[field] = mask&(1<<i) != 0
+	}
+	return result
 }
+
+func fieldsToMask(fields []string, mask uint64, changes map[string]bool) (uint64, error) {
+	index := make(map[string]int, len(fields))
+	for i, field := range fields {
+		index[field] = i
+	}
+	var unknown []string
+	for field, enabled := range changes {
+		i, ok := index[field]
+		if !ok {
+			unknown = append(unknown, field)
+			continue
+		}
+		if enabled {
+			mask |= 1 << i
+		} else {
+			mask &^= 1 << i
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return 0, fmt.Errorf("unknown fields: %v", unknown)
+	}
+	return mask, nil
+}
+
+func permsCompanyID(ctx *gin.Context, db *gorm.DB, auditLog *logrus.Entry) (uint, bool) {
+	if idStr := ctx.Param("id"); idStr != "" {
+		idUint, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status":     "failure",
+				"reason":     "invalid_company_id",
+				"company_id": idStr,
+			}).Warn("Invalid company ID")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return 0, false
+		}
+		return uint(idUint), true
+	}
+	claimsVal, exists := ctx.Get("claims")
+	if !exists {
+		auditLog.WithField("status", "failure").Warn("Unauthorized: no claims in context")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, false
+	}
+	claims, ok := claimsVal.(*Claims)
+	if !ok {
+		auditLog.WithField("status", "failure").Warn("Invalid claims format")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid claims format"})
+		return 0, false
+	}
+	var user models.User
+	if val, found := handlers.UserCache.Get(claims.ID); found {
+		user = val
+	} else {
+		if err := db.First(&user, claims.ID).Error; err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status":  "failure",
+				"user_id": claims.ID,
+				"error":   err.Error(),
+			}).Error("Failed to fetch user")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return 0, false
+		}
+		handlers.UserCache.Set(claims.ID, user)
+	}
+	if user.StartupID == nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":  "failure",
+			"user_id": user.ID,
+			"reason":  "no_company",
+		}).Warn("User does not belong to a company")
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "User does not belong to a company"})
+		return 0, false
+	}
+	return *user.StartupID, true
+}
+
+func handlePermsSection[T permsModel](
+	ctx *gin.Context,
+	db *gorm.DB,
+	quarterObj *models.Quarter,
+	data string,
+	kind string,
+	changes map[string]bool,
+	auditLog *logrus.Entry,
+) {
+	var model T
+	err := db.
+		Where("quarter_id = ? AND company_id = ?", quarterObj.ID, quarterObj.CompanyID).
+		Order("version DESC").
+		First(&model).Error
+	if respondWithErrorIfNeeded(ctx, err, data) {
+		return
+	}
+	fields := model.VisibilityList(true)
+	mask := reflect.ValueOf(model).Elem().FieldByName(permsColumns[kind]).Uint()
+	if changes != nil {
+		newMask, err := fieldsToMask(fields, mask, changes)
+		if err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "unknown_fields",
+				"error":  err.Error(),
+			}).Warn("Unknown fields in permission update")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// every version of the quarter is filtered with its own mask, so all of them are updated
+		if err := db.Table(model.TableName()).
+			Where("quarter_id = ? AND company_id = ?", quarterObj.ID, quarterObj.CompanyID).
+			UpdateColumn("is_"+kind, newMask).Error; err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "db_update_failed",
+				"error":  err.Error(),
+			}).Error("Failed to update permission mask")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permissions"})
+			return
+		}
+		mask = newMask
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"mask":   mask,
+	}).Info("Permission mask processed")
+	ctx.JSON(http.StatusOK, permsResponse{
+		CompanyID: quarterObj.CompanyID,
+		QuarterID: quarterObj.ID,
+		Data:      data,
+		Fields:    maskToFields(fields, mask),
+	})
+}
+
+func handlePerms(ctx *gin.Context, kind string, write bool) {
+	db := values.GetDB()
+	action := "get"
+	if write {
+		action = "set"
+	}
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": fmt.Sprintf("%s_%s_perms", action, kind),
+	})
+	companyID, ok := permsCompanyID(ctx, db, auditLog)
+	if !ok {
+		return
+	}
+	auditLog = auditLog.WithField("company_id", companyID)
+	data := ctx.Query("data")
+	if !permsSections[data] {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_data_param",
+			"data":   data,
+		}).Warn("Invalid data query parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data query parameter"})
+		return
+	}
+	quarter := ctx.Query("quarter")
+	yearStr := ctx.Query("year")
+	yearUint, err := strconv.ParseUint(yearStr, 10, 32)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_year",
+			"year":   yearStr,
+		}).Warn("Invalid year")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+	year := uint(yearUint)
+	var changes map[string]bool
+	if write {
+		var req permsRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "invalid_request_body",
+				"error":  err.Error(),
+			}).Warn("Invalid permission request body")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		changes = req.Fields
+	}
+	var quarterObj models.Quarter
+	cacheKey := fmt.Sprintf("%d_%s_%d", companyID, quarter, year)
+	if val, ok := QuarterCache.Get(cacheKey); ok {
+		quarterObj = val
+	} else {
+		if err := db.Where("company_id = ? AND quarter = ? AND year = ?", companyID, quarter, year).
+			First(&quarterObj).Error; err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status":  "failure",
+				"reason":  "quarter_not_found",
+				"quarter": quarter,
+				"year":    year,
+			}).Warn("Quarter not found")
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Quarter not found"})
+			return
+		}
+		QuarterCache.Set(cacheKey, quarterObj)
+	}
+	sectionLog := auditLog.WithFields(logrus.Fields{
+		"quarter": quarter,
+		"year":    year,
+		"data":    data,
+	})
+	switch data {
+	case "finance":
+		handlePermsSection[*models.FinancialHealth](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "market":
+		handlePermsSection[*models.MarketTraction](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "uniteconomics":
+		handlePermsSection[*models.UnitEconomics](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "teamperf":
+		handlePermsSection[*models.TeamPerformance](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "fund":
+		handlePermsSection[*models.FundraisingStatus](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "competitive":
+		handlePermsSection[*models.CompetitiveLandscape](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "operation":
+		handlePermsSection[*models.OperationalEfficiency](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "risk":
+		handlePermsSection[*models.RiskManagement](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "additional":
+		handlePermsSection[*models.AdditionalInfo](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "self":
+		handlePermsSection[*models.SelfAssessment](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "product":
+		handlePermsSection[*models.ProductDevelopment](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	case "attachments":
+		handlePermsSection[*models.Attachment](ctx, db, &quarterObj, data, kind, changes, sectionLog)
+	}
+}
+
+// GetVisiblePerms godoc
+// @Summary      Get visible fields of a section
+// @Description  Returns which fields of a company's section are visible to non-owners for the given quarter and year. Field names match the JSON keys of the section.
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path   int     true  "Company ID"
+// @Param        data     query  string  true  "Section"  Enums(finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, product, attachments)
+// @Param        quarter  query  string  true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int     true  "Year"
+// @Success      200  {object}  permsResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/perms/{id}/visible [get]
+// @Router       /manage/company/perms/{id}/visible [get]
+func GetVisiblePerms(ctx *gin.Context) {
+	handlePerms(ctx, "visible", false)
+}
+
+// GetEditablePerms godoc
+// @Summary      Get editable fields of a section
+// @Description  Returns which fields of a section can still be edited for the given quarter and year. Without a company ID the authenticated founder's company is used.
+// @Tags         company
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path   int     false "Company ID (manage route only)"
+// @Param        data     query  string  true  "Section"  Enums(finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, product, attachments)
+// @Param        quarter  query  string  true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int     true  "Year"
+// @Success      200  {object}  permsResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/perms/editable [get]
+// @Router       /manage/company/perms/{id}/editable [get]
 func GetEditablePerms(ctx *gin.Context) {
+	handlePerms(ctx, "editable", false)
+}
 
+// SetVisiblePerms godoc
+// @Summary      Set visible fields of a section
+// @Description  Toggles the visibility of the listed fields for every version of a section in the given quarter. Fields that are not listed keep their current value.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path   int           true  "Company ID"
+// @Param        data     query  string        true  "Section"  Enums(finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, product, attachments)
+// @Param        quarter  query  string        true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int           true  "Year"
+// @Param        body     body   permsRequest  true  "Field name to visibility"
+// @Success      200  {object}  permsResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/perms/{id}/visible [post]
+func SetVisiblePerms(ctx *gin.Context) {
+	handlePerms(ctx, "visible", true)
 }
 
-func SetVisiblePerms(ctx *gin.Context)  {}
-func SetEditablePerms(ctx *gin.Context) {}
+// SetEditablePerms godoc
+// @Summary      Set editable fields of a section
+// @Description  Toggles whether the founder may edit the listed fields for every version of a section in the given quarter. Fields that are not listed keep their current value.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path   int           true  "Company ID"
+// @Param        data     query  string        true  "Section"  Enums(finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, product, attachments)
+// @Param        quarter  query  string        true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int           true  "Year"
+// @Param        body     body   permsRequest  true  "Field name to editability"
+// @Success      200  {object}  permsResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/perms/{id}/editable [post]
+func SetEditablePerms(ctx *gin.Context) {
+	handlePerms(ctx, "editable", true)
+}
@@ -0,0 +1,185 @@
+package company
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnestcc/dashboard/models"
+)
+
+const foundedOnFormat = "2006-01-02"
+
+// socialLinksRequest edits the social links, links left out keep their value.
+type socialLinksRequest struct {
+	LinkedIn   *string `json:"linkedin" binding:"omitempty,max=255,eq=|http_url" example:"https://www.linkedin.com/company/acme"`
+	Twitter    *string `json:"twitter" binding:"omitempty,max=255,eq=|http_url" example:"https://x.com/acme"`
+	GitHub     *string `json:"github" binding:"omitempty,max=255,eq=|http_url" example:"https://github.com/acme"`
+	Crunchbase *string `json:"crunchbase" binding:"omitempty,max=255,eq=|http_url" example:"https://www.crunchbase.com/organization/acme"`
+}
+
+// companyInfoRequest edits the profile of a company. Fields left out keep
+// their value and an empty string clears one.
+type companyInfoRequest struct {
+	Name         *string `json:"name" binding:"omitempty,min=1,max=200" example:"Acme Inc"`
+	ContactName  *string `json:"contact_name" binding:"omitempty,max=200" example:"John Doe"`
+	ContactEmail *string `json:"contact_email" binding:"omitempty,email" example:"john@acme.com"`
+	// Sector is one of GET /company/taxonomy
+	Sector      *string `json:"sector" example:"fintech"`
+	Description *string `json:"description" binding:"omitempty,max=2000" example:"We do something xyz and make money"`
+	Stage       *string `json:"stage" binding:"omitempty,eq=|oneof=pre_seed seed series_a series_b_plus" example:"seed"`
+	FoundedOn   *string `json:"founded_on" binding:"omitempty,eq=|datetime=2006-01-02" example:"2021-03-15"`
+	HQCity      *string `json:"hq_city" binding:"omitempty,max=100" example:"Berlin"`
+	// HQCountry is an ISO 3166-1 alpha-2 code
+	HQCountry *string             `json:"hq_country" binding:"omitempty,eq=|iso3166_1_alpha2" example:"DE"`
+	Website   *string             `json:"website" binding:"omitempty,max=255,eq=|http_url" example:"https://acme.com"`
+	LogoURL   *string             `json:"logo_url" binding:"omitempty,max=255,eq=|http_url" example:"https://acme.com/logo.png"`
+	Social    *socialLinksRequest `json:"social"`
+	Tags      *[]string           `json:"tags" binding:"omitempty,max=20,dive,max=40" example:"b2b,payments"`
+}
+
+// apply validates what the binding tags cannot and copies the set fields to
+// the company.
+func (r *companyInfoRequest) apply(company *models.Company) error {
+	var sector string
+	if r.Sector != nil {
+		var ok bool
+		if sector, ok = models.NormalizeSector(*r.Sector); !ok {
+			return fmt.Errorf("unknown sector %q, see /company/taxonomy", *r.Sector)
+		}
+	}
+	var foundedOn *time.Time
+	if r.FoundedOn != nil && *r.FoundedOn != "" {
+		date, err := time.Parse(foundedOnFormat, *r.FoundedOn)
+		if err != nil {
+			return errors.New("founded_on must be a date like 2021-03-15")
+		}
+		if date.After(time.Now()) {
+			return errors.New("founded_on cannot be in the future")
+		}
+		foundedOn = &date
+	}
+	if r.Name != nil {
+		company.Name = *r.Name
+	}
+	if r.ContactName != nil {
+		company.ContactName = *r.ContactName
+	}
+	if r.ContactEmail != nil {
+		company.ContactEmail = *r.ContactEmail
+	}
+	if r.Sector != nil {
+		company.Sector = sector
+	}
+	if r.Description != nil {
+		company.Description = *r.Description
+	}
+	if r.Stage != nil {
+		company.Stage = *r.Stage
+	}
+	if r.FoundedOn != nil {
+		company.FoundedOn = foundedOn
+	}
+	if r.HQCity != nil {
+		company.HQCity = strings.TrimSpace(*r.HQCity)
+	}
+	if r.HQCountry != nil {
+		company.HQCountry = *r.HQCountry
+	}
+	if r.Website != nil {
+		company.Website = *r.Website
+	}
+	if r.LogoURL != nil {
+		company.LogoURL = *r.LogoURL
+	}
+	if r.Social != nil {
+		if r.Social.LinkedIn != nil {
+			company.Social.LinkedIn = *r.Social.LinkedIn
+		}
+		if r.Social.Twitter != nil {
+			company.Social.Twitter = *r.Social.Twitter
+		}
+		if r.Social.GitHub != nil {
+			company.Social.GitHub = *r.Social.GitHub
+		}
+		if r.Social.Crunchbase != nil {
+			company.Social.Crunchbase = *r.Social.Crunchbase
+		}
+	}
+	if r.Tags != nil {
+		company.Tags = normalizeTags(*r.Tags)
+	}
+	return nil
+}
+
+// normalizeTags lower cases the tags and drops empty and repeated ones.
+func normalizeTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// companyProfile is the public profile of a company.
+type companyProfile struct {
+	Sector      string             `json:"sector" example:"fintech"`
+	Description string             `json:"description" example:"We do something xyz and make money"`
+	Stage       string             `json:"stage,omitempty" example:"seed"`
+	FoundedOn   string             `json:"founded_on,omitempty" example:"2021-03-15"`
+	HQCity      string             `json:"hq_city,omitempty" example:"Berlin"`
+	HQCountry   string             `json:"hq_country,omitempty" example:"DE"`
+	Website     string             `json:"website,omitempty" example:"https://acme.com"`
+	LogoURL     string             `json:"logo_url,omitempty" example:"https://acme.com/logo.png"`
+	Social      models.SocialLinks `json:"social"`
+	Tags        []string           `json:"tags"`
+}
+
+func newCompanyProfile(company *models.Company) companyProfile {
+	profile := companyProfile{
+		Sector:      company.Sector,
+		Description: company.Description,
+		Stage:       company.Stage,
+		HQCity:      company.HQCity,
+		HQCountry:   company.HQCountry,
+		Website:     company.Website,
+		LogoURL:     company.LogoURL,
+		Social:      company.Social,
+		Tags:        []string(company.Tags),
+	}
+	if company.FoundedOn != nil {
+		profile.FoundedOn = company.FoundedOn.Format(foundedOnFormat)
+	}
+	if profile.Tags == nil {
+		profile.Tags = []string{}
+	}
+	return profile
+}
+
+type companyListItem struct {
+	Name string `json:"name" example:"Acme Inc"`
+	companyProfile
+}
+
+type taxonomyResponse struct {
+	Sectors []string `json:"sectors" example:"fintech,healthtech,other"`
+	Stages  []string `json:"stages" example:"pre_seed,seed,series_a,series_b_plus"`
+}
+
+// GetTaxonomy godoc
+// @Summary      List sectors and stages
+// @Description  Returns the sectors and funding stages a company profile can have
+// @Tags         company
+// @Produce      json
+// @Success      200  {object}  taxonomyResponse
+// @Router       /company/taxonomy [get]
+func GetTaxonomy(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, taxonomyResponse{Sectors: models.Sectors, Stages: models.CompanyStages})
+}
@@ -0,0 +1,189 @@
+package company
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/reporting"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+type reportingPeriodModel struct {
+	Quarter  string     `json:"quarter" example:"Q1"`
+	Year     uint       `json:"year" example:"2025"`
+	OpensAt  time.Time  `json:"opens_at" example:"2025-04-01T00:00:00Z"`
+	Deadline time.Time  `json:"deadline" example:"2025-05-01T00:00:00Z"`
+	OpenedAt *time.Time `json:"opened_at,omitempty" example:"2025-04-01T00:12:00Z"`
+	ClosedAt *time.Time `json:"closed_at,omitempty" example:"2025-05-01T00:12:00Z"`
+}
+
+type reportingCalendarResponse struct {
+	Enabled bool                   `json:"enabled" example:"true"`
+	Next    *reportingPeriodModel  `json:"next,omitempty"`
+	Periods []reportingPeriodModel `json:"periods"`
+}
+
+// GetReportingCalendar godoc
+// @Summary      Show the reporting calendar
+// @Description  Returns whether quarters are opened on a schedule, the next quarter the calendar opens and the quarters it opened so far, newest first
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  reportingCalendarResponse
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/reporting [get]
+func GetReportingCalendar(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "get_reporting_calendar",
+	})
+	cfg := values.GetConfig().Reporting
+	response := reportingCalendarResponse{Enabled: cfg.Enabled, Periods: []reportingPeriodModel{}}
+	if cfg.Enabled {
+		cal, err := reporting.NewCalendar(cfg)
+		if err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "invalid_config",
+				"error":  err.Error(),
+			}).Error("Invalid reporting calendar")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid reporting calendar"})
+			return
+		}
+		next := cal.Next(time.Now())
+		response.Next = &reportingPeriodModel{Quarter: next.Quarter, Year: next.Year, OpensAt: next.OpensAt, Deadline: next.Deadline}
+	}
+	var periods []models.ReportingPeriod
+	if err := db.Order("year DESC, quarter DESC").Find(&periods).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_error",
+			"error":  err.Error(),
+		}).Error("Failed to fetch reporting periods")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reporting periods"})
+		return
+	}
+	for _, period := range periods {
+		response.Periods = append(response.Periods, reportingPeriodModel{
+			Quarter:  period.Quarter,
+			Year:     period.Year,
+			OpensAt:  period.OpensAt,
+			Deadline: period.Deadline,
+			OpenedAt: &period.OpenedAt,
+			ClosedAt: period.ClosedAt,
+		})
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":  "success",
+		"periods": len(periods),
+	}).Info("Fetched reporting calendar")
+	ctx.JSON(http.StatusOK, response)
+}
+
+type quarterDeadlineRequest struct {
+	Quarter  string    `json:"quarter" binding:"required" example:"Q1"`
+	Year     uint      `json:"year" binding:"required" example:"2025"`
+	Deadline time.Time `json:"deadline" binding:"required" example:"2025-05-01T00:00:00Z"`
+	// CompanyID limits the deadline to one company
+	CompanyID *uint `json:"company_id,omitempty" example:"1"`
+}
+
+// SetQuarterDeadline godoc
+// @Summary      Set the deadline of a quarter
+// @Description  Sets when founders can no longer change or submit the quarter, for every company or only the given one. For every company it also moves the deadline of the reporting calendar. Founders are reminded again before the new deadline.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body body      quarterDeadlineRequest  true  "Quarter, year, deadline and an optional company"
+// @Success      200  {object}  map[string]any
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/quarters/deadline [put]
+func SetQuarterDeadline(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "set_quarter_deadline",
+	})
+	var req quarterDeadlineRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_request_body",
+			"error":  err.Error(),
+		}).Warn("Failed to bind request JSON")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	validQuarters := map[string]bool{"Q1": true, "Q2": true, "Q3": true, "Q4": true}
+	if !validQuarters[req.Quarter] {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quarter. Must be one of Q1, Q2, Q3, Q4"})
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"quarter":  req.Quarter,
+		"year":     req.Year,
+		"deadline": req.Deadline.Format(time.RFC3339),
+	})
+	if req.CompanyID != nil {
+		auditLog = auditLog.WithField("company_id", *req.CompanyID)
+	}
+	var updated int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.Quarter{}).Where("quarter = ? AND year = ?", req.Quarter, req.Year)
+		if req.CompanyID != nil {
+			query = query.Where("company_id = ?", *req.CompanyID)
+		}
+		result := query.Updates(map[string]any{
+			"deadline":         req.Deadline,
+			"reminder_sent_at": nil,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		updated = result.RowsAffected
+		if req.CompanyID != nil {
+			return nil
+		}
+		// the calendar closes the period again once the new deadline passed
+		return tx.Model(&models.ReportingPeriod{}).
+			Where("quarter = ? AND year = ?", req.Quarter, req.Year).
+			Updates(map[string]any{"deadline": req.Deadline, "closed_at": nil}).Error
+	})
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  err.Error(),
+		}).Error("Failed to set quarter deadline")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set the deadline"})
+		return
+	}
+	if updated == 0 && req.CompanyID != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "quarter_not_found",
+		}).Warn("Quarter not found")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Quarter not found"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":   "success",
+		"quarters": updated,
+	}).Info("Quarter deadline set")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Deadline set", "quarters": updated})
+}
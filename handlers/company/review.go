@@ -0,0 +1,389 @@
+package company
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+var errPastDeadline = errors.New("quarter is past its deadline")
+
+type quarterTransitionRequest struct {
+	Quarter string `json:"quarter" binding:"required" example:"Q1"`
+	Year    uint   `json:"year" binding:"required" example:"2025"`
+	Note    string `json:"note" binding:"max=2000" example:"The burn rate does not match the bank statement"`
+}
+
+type quarterStatusResponse struct {
+	ID              uint       `json:"id" example:"1"`
+	CompanyID       uint       `json:"company_id" example:"1"`
+	Quarter         string     `json:"quarter" example:"Q1"`
+	Year            uint       `json:"year" example:"2025"`
+	Status          string     `json:"status" example:"submitted"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty" example:"2025-04-10T00:00:00Z"`
+	StatusChangedBy *uint      `json:"status_changed_by,omitempty" example:"4"`
+}
+
+type quarterTransitionModel struct {
+	Action    string    `json:"action" example:"request_changes"`
+	From      string    `json:"from" example:"under_review"`
+	To        string    `json:"to" example:"changes_requested"`
+	ActorID   uint      `json:"actor_id" example:"2"`
+	Note      string    `json:"note,omitempty" example:"The burn rate does not match the bank statement"`
+	CreatedAt time.Time `json:"created_at" example:"2025-04-12T00:00:00Z"`
+}
+
+// quarterEditable fails the request when the quarter takes no edits. Founders
+// only edit drafts and quarters sent back to them before the deadline, staff
+// anything not approved. The status is read again since cached quarters may
+// be stale.
+func quarterEditable(ctx *gin.Context, db *gorm.DB, quarterObj *models.Quarter, founder bool, auditLog *logrus.Entry) bool {
+	var current models.Quarter
+	if err := db.Select("id", "status", "deadline").First(&current, quarterObj.ID).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_error",
+			"error":  err.Error(),
+		}).Error("Failed to fetch quarter status")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quarter"})
+		return false
+	}
+	quarterObj.Status = current.Status
+	if current.Locked() || (founder && !current.FounderEditable()) {
+		auditLog.WithFields(logrus.Fields{
+			"status":         "failure",
+			"reason":         "quarter_locked",
+			"quarter_status": current.Status,
+		}).Warn("Edit of a quarter that takes no edits")
+		message := "The quarter is approved and locked"
+		if !current.Locked() {
+			message = "The quarter is submitted for review and cannot be changed until changes are requested"
+		}
+		ctx.JSON(http.StatusConflict, gin.H{"error": message, "quarter_status": current.Status})
+		return false
+	}
+	if founder && current.PastDeadline(time.Now()) {
+		pastDeadline(ctx, &current, auditLog)
+		return false
+	}
+	return true
+}
+
+// pastDeadline responds that the founders missed the deadline of the quarter.
+func pastDeadline(ctx *gin.Context, quarterObj *models.Quarter, auditLog *logrus.Entry) {
+	auditLog.WithFields(logrus.Fields{
+		"status":   "failure",
+		"reason":   "past_deadline",
+		"deadline": quarterObj.Deadline.Format(time.RFC3339),
+	}).Warn("Change of a quarter past its deadline")
+	ctx.JSON(http.StatusConflict, gin.H{
+		"error":    "The deadline of the quarter has passed, ask a moderator to reopen it",
+		"deadline": quarterObj.Deadline,
+	})
+}
+
+// transitionQuarter applies the action to the quarter of the request and responds
+// with the new status.
+func transitionQuarter(ctx *gin.Context, db *gorm.DB, companyID, actorID uint, action models.QuarterAction, req quarterTransitionRequest, auditLog *logrus.Entry) {
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"company_id": companyID,
+		"user_id":    actorID,
+		"quarter":    req.Quarter,
+		"year":       req.Year,
+		"action":     action.Name,
+	})
+	var quarterObj models.Quarter
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("company_id = ? AND quarter = ? AND year = ?", companyID, req.Quarter, req.Year).First(&quarterObj).Error; err != nil {
+			return err
+		}
+		if action.Name == models.ActionSubmit.Name && quarterObj.PastDeadline(time.Now()) {
+			return errPastDeadline
+		}
+		return models.TransitionQuarter(tx, &quarterObj, action, actorID, req.Note)
+	})
+	if errors.Is(err, errPastDeadline) {
+		pastDeadline(ctx, &quarterObj, auditLog)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "quarter_not_found",
+		}).Warn("Quarter not found")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Quarter not found"})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidTransition) {
+		auditLog.WithFields(logrus.Fields{
+			"status":         "failure",
+			"reason":         "invalid_transition",
+			"quarter_status": quarterObj.Status,
+		}).Warn("Quarter status does not allow the action")
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error":          fmt.Sprintf("A quarter that is %s cannot be moved with %s", quarterObj.Status, action.Name),
+			"quarter_status": quarterObj.Status,
+		})
+		return
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  err.Error(),
+		}).Error("Failed to change quarter status")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change quarter status"})
+		return
+	}
+	QuarterCache.Delete(fmt.Sprintf("%d_%s_%d", companyID, quarterObj.Quarter, quarterObj.Year))
+	auditLog.WithFields(logrus.Fields{
+		"status":     "success",
+		"quarter_id": quarterObj.ID,
+		"to":         action.To,
+	}).Info("Quarter status changed")
+	ctx.JSON(http.StatusOK, quarterStatusResponse{
+		ID:              quarterObj.ID,
+		CompanyID:       quarterObj.CompanyID,
+		Quarter:         quarterObj.Quarter,
+		Year:            quarterObj.Year,
+		Status:          quarterObj.Status,
+		StatusChangedAt: quarterObj.StatusChangedAt,
+		StatusChangedBy: quarterObj.StatusChangedBy,
+	})
+}
+
+// staffTransition handles the moderator side of the lifecycle, the company
+// comes from the path.
+func staffTransition(ctx *gin.Context, action models.QuarterAction, noteRequired bool) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "quarter_" + action.Name,
+	})
+	idStr := ctx.Param("id")
+	idUint, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "invalid_company_id",
+			"company_id": idStr,
+		}).Warn("Invalid company ID")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+	claims, ok := vcClaims(ctx)
+	if !ok {
+		auditLog.WithField("status", "failure").Warn("Invalid claims format")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req quarterTransitionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || (noteRequired && req.Note == "") {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_request_body",
+		}).Warn("Invalid request body")
+		message := "Invalid request body"
+		if err == nil {
+			message = "A note for the founders is required"
+		}
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+	transitionQuarter(ctx, db, uint(idUint), claims.ID, action, req, auditLog)
+}
+
+// SubmitQuarter godoc
+// @Summary      Submit a quarter for review
+// @Description  Submits a draft quarter of the user's company before its deadline, or one a moderator requested changes on. Founders cannot edit it while it is with the moderators.
+// @Tags         company
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body body      quarterTransitionRequest  true  "Quarter, year and an optional note"
+// @Success      200  {object}  quarterStatusResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /company/quarters/submit [post]
+func SubmitQuarter(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "quarter_submit",
+	})
+	var req quarterTransitionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_request_body",
+		}).Warn("Invalid request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	user, company, ok := memberCompany(ctx, db, false, auditLog)
+	if !ok {
+		return
+	}
+	transitionQuarter(ctx, db, company.ID, user.ID, models.ActionSubmit, req, auditLog)
+}
+
+// StartQuarterReview godoc
+// @Summary      Start reviewing a quarter
+// @Description  Moves a submitted quarter of the company to under review
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int                       true  "Company ID"
+// @Param        body body      quarterTransitionRequest  true  "Quarter, year and an optional note"
+// @Success      200  {object}  quarterStatusResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/quarters/{id}/review [post]
+func StartQuarterReview(ctx *gin.Context) {
+	staffTransition(ctx, models.ActionStartReview, false)
+}
+
+// RequestQuarterChanges godoc
+// @Summary      Request changes to a quarter
+// @Description  Sends a quarter under review back to the founders with a note saying what to fix. They can edit and submit it again.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int                       true  "Company ID"
+// @Param        body body      quarterTransitionRequest  true  "Quarter, year and the required note"
+// @Success      200  {object}  quarterStatusResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/quarters/{id}/request-changes [post]
+func RequestQuarterChanges(ctx *gin.Context) {
+	staffTransition(ctx, models.ActionRequestChanges, true)
+}
+
+// ApproveQuarter godoc
+// @Summary      Approve a quarter
+// @Description  Approves a quarter under review and locks it. Its numbers are final: neither founders nor moderators can edit or roll back its sections until an admin reopens it.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int                       true  "Company ID"
+// @Param        body body      quarterTransitionRequest  true  "Quarter, year and an optional note"
+// @Success      200  {object}  quarterStatusResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/quarters/{id}/approve [post]
+func ApproveQuarter(ctx *gin.Context) {
+	staffTransition(ctx, models.ActionApprove, false)
+}
+
+// ReopenQuarter godoc
+// @Summary      Reopen an approved quarter
+// @Description  Unlocks an approved quarter and sends it back to the founders as changes requested, with a note saying why
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int                       true  "Company ID"
+// @Param        body body      quarterTransitionRequest  true  "Quarter, year and the required note"
+// @Success      200  {object}  quarterStatusResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/quarters/{id}/reopen [post]
+func ReopenQuarter(ctx *gin.Context) {
+	staffTransition(ctx, models.ActionReopen, true)
+}
+
+// ListQuarterTransitions godoc
+// @Summary      List the status changes of a quarter
+// @Description  Returns who moved the quarter to which status and when, oldest first, with the notes of the moderators. Founders use /company/quarters/transitions for their own company.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path   int     true  "Company ID"
+// @Param        quarter  query  string  true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int     true  "Year"
+// @Success      200  {object}  []quarterTransitionModel
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/quarters/{id}/transitions [get]
+// @Router       /company/quarters/transitions [get]
+func ListQuarterTransitions(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "list_quarter_transitions",
+	})
+	companyID, ok := permsCompanyID(ctx, db, auditLog)
+	if !ok {
+		return
+	}
+	auditLog = auditLog.WithField("company_id", companyID)
+	quarterObj, ok := queryQuarter(ctx, db, companyID, auditLog)
+	if !ok {
+		return
+	}
+	var transitions []models.QuarterTransition
+	if err := db.Where("quarter_id = ?", quarterObj.ID).Order("id").Find(&transitions).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error("Failed to list quarter transitions")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list quarter transitions"})
+		return
+	}
+	result := make([]quarterTransitionModel, 0, len(transitions))
+	for _, t := range transitions {
+		result = append(result, quarterTransitionModel{
+			Action:    t.Action,
+			From:      t.From,
+			To:        t.To,
+			ActorID:   t.ActorID,
+			Note:      t.Note,
+			CreatedAt: t.CreatedAt,
+		})
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":     "success",
+		"quarter_id": quarterObj.ID,
+		"count":      len(result),
+	}).Info("Listed quarter transitions")
+	ctx.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,308 @@
+package company
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+type rollbackRequest struct {
+	Version uint32 `json:"version" binding:"required" example:"2"`
+}
+
+type rollbackResponse struct {
+	Message      string   `json:"message" example:"finance restored from version 2"`
+	CompanyID    uint     `json:"company_id" example:"1"`
+	QuarterID    uint     `json:"quarter_id" example:"1"`
+	Data         string   `json:"data" example:"finance"`
+	RestoredFrom uint32   `json:"restored_from" example:"2"`
+	Version      uint32   `json:"version" example:"5"`
+	Kept         []string `json:"kept" example:"cash_balance"`
+}
+
+// rowIdentity are the fields of a section row that say which row and version it is
+// rather than what was reported.
+var rowIdentity = map[string]bool{
+	"Model":      true,
+	"CompanyID":  true,
+	"QuarterID":  true,
+	"Version":    true,
+	"IsVisible":  true,
+	"IsEditable": true,
+}
+
+func loadLatest[T historyModel](db *gorm.DB, quarterObj *models.Quarter, data string) (T, error) {
+	var model T
+	query := db.Where("quarter_id = ? AND company_id = ?", quarterObj.ID, quarterObj.CompanyID).Order("version DESC")
+	if preload, ok := sectionPreloads[data]; ok {
+		query = query.Preload(preload)
+	}
+	err := query.First(&model).Error
+	return model, err
+}
+
+// sectionMasks reads the visibility and edit masks of a section row.
+func sectionMasks(model any) (visible, editable uint64) {
+	v := reflect.ValueOf(model).Elem()
+	return v.FieldByName("IsVisible").Uint(), v.FieldByName("IsEditable").Uint()
+}
+
+func sectionVersion(model any) uint32 {
+	return uint32(reflect.ValueOf(model).Elem().FieldByName("Version").Uint())
+}
+
+// overlayFields copies every field that is set in src onto dst, the same
+// fields gorm's Updates would have written.
+func overlayFields(dst, src any) {
+	d := reflect.ValueOf(dst).Elem()
+	s := reflect.ValueOf(src).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		if rowIdentity[s.Type().Field(i).Name] {
+			continue
+		}
+		if field := s.Field(i); !field.IsZero() {
+			d.Field(i).Set(field)
+		}
+	}
+}
+
+// fieldByJSON finds the struct field serialized under name.
+func fieldByJSON(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// keepLocked puts back the current value of every field the current edit mask
+// locks, so a restore cannot change what founders are not allowed to change.
+// It returns the locked fields whose restored value would have differed.
+func keepLocked[T historyModel](restored, latest T) []string {
+	_, editable := sectionMasks(latest)
+	r := reflect.ValueOf(restored).Elem()
+	l := reflect.ValueOf(latest).Elem()
+	kept := []string{}
+	for i, name := range latest.VisibilityList(true) {
+		if editable&(1<<i) != 0 {
+			continue
+		}
+		current := fieldByJSON(l, name)
+		target := fieldByJSON(r, name)
+		if !current.IsValid() || !target.IsValid() {
+			continue
+		}
+		currentJSON, _ := json.Marshal(current.Interface())
+		targetJSON, _ := json.Marshal(target.Interface())
+		if string(currentJSON) != string(targetJSON) {
+			kept = append(kept, name)
+		}
+		target.Set(current)
+	}
+	return kept
+}
+
+// resetForInsert clears the primary keys of a loaded section row and of its
+// breakdown rows so it can be inserted again as the given version.
+func resetForInsert(model any, version uint32) {
+	v := reflect.ValueOf(model).Elem()
+	v.FieldByName("Model").Set(reflect.Zero(v.FieldByName("Model").Type()))
+	v.FieldByName("Version").SetUint(uint64(version))
+	for _, preload := range sectionPreloads {
+		rows := v.FieldByName(preload)
+		if !rows.IsValid() {
+			continue
+		}
+		for i := 0; i < rows.Len(); i++ {
+			row := rows.Index(i).FieldByName("Model")
+			row.Set(reflect.Zero(row.Type()))
+		}
+	}
+}
+
+// insertVersion writes a new version of a section with the given masks.
+func insertVersion(db *gorm.DB, model any, visible, editable uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		v := reflect.ValueOf(model).Elem()
+		v.FieldByName("IsVisible").SetUint(visible)
+		v.FieldByName("IsEditable").SetUint(editable)
+		if err := tx.Create(model).Error; err != nil {
+			return err
+		}
+		// gorm falls back to the column default for a zero mask, so empty masks are written explicitly
+		zeroed := map[string]any{}
+		if visible == 0 {
+			zeroed["is_visible"] = 0
+		}
+		if editable == 0 {
+			zeroed["is_editable"] = 0
+		}
+		if len(zeroed) == 0 {
+			return nil
+		}
+		return tx.Model(model).UpdateColumns(zeroed).Error
+	})
+}
+
+func rollbackSection[T historyModel](ctx *gin.Context, db *gorm.DB, quarterObj *models.Quarter, data string, target uint32, auditLog *logrus.Entry) {
+	latest, err := loadLatest[T](db, quarterObj, data)
+	if respondWithErrorIfNeeded(ctx, err, data) {
+		return
+	}
+	current := sectionVersion(latest)
+	if target == current {
+		auditLog.WithFields(logrus.Fields{
+			"status":  "failure",
+			"reason":  "already_latest",
+			"version": target,
+		}).Warn("Version to restore is already the latest")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Version %d is already the latest", target)})
+		return
+	}
+	restored, err := loadVersion[T](db, quarterObj, data, target)
+	if respondWithErrorIfNeeded(ctx, err, data) {
+		return
+	}
+	kept := keepLocked(restored, latest)
+	visible, editable := sectionMasks(latest)
+	version := current + 1
+	resetForInsert(restored, version)
+	if err := insertVersion(db, restored, visible, editable); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":  "failure",
+			"reason":  "db_create_failed",
+			"version": target,
+			"error":   err.Error(),
+		}).Error("Failed to insert restored version")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to restore %s", data)})
+		return
+	}
+	recordVersion(ctx, db, restored.TableName(), quarterObj.CompanyID, quarterObj.ID, version, recordID(restored), "rollback")
+	auditLog.WithFields(logrus.Fields{
+		"status":        "success",
+		"restored_from": target,
+		"replaced":      current,
+		"version":       version,
+		"kept":          kept,
+	}).Info("Section version restored")
+	ctx.JSON(http.StatusOK, rollbackResponse{
+		Message:      fmt.Sprintf("%s restored from version %d", data, target),
+		CompanyID:    quarterObj.CompanyID,
+		QuarterID:    quarterObj.ID,
+		Data:         data,
+		RestoredFrom: target,
+		Version:      version,
+		Kept:         kept,
+	})
+}
+
+// RollbackVersion godoc
+// @Summary      Restore an earlier version of a section
+// @Description  Copies an earlier version of a section into a new latest version, so the history keeps both the bad edit and its undo. Visibility and edit masks are taken from the current version, and fields locked by the current edit mask keep their current value; they are listed in `kept`. Unlock them through the perms endpoint first to restore them as well. (moderator, admin)
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path   int              true  "Company ID"
+// @Param        data     query  string           true  "Section"  Enums(finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, product, attachments)
+// @Param        quarter  query  string           true  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int              true  "Year"
+// @Param        body     body   rollbackRequest  true  "Version to restore"
+// @Success      200  {object}  rollbackResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /manage/company/history/{id}/rollback [post]
+func RollbackVersion(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "rollback_section",
+	})
+	idStr := ctx.Param("id")
+	idUint, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "invalid_company_id",
+			"company_id": idStr,
+		}).Warn("Invalid company ID")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+	companyID := uint(idUint)
+	auditLog = auditLog.WithField("company_id", companyID)
+	if claims, ok := vcClaims(ctx); ok {
+		auditLog = auditLog.WithField("user_id", claims.ID)
+	}
+	data := ctx.Query("data")
+	if !permsSections[data] {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_data_param",
+			"data":   data,
+		}).Warn("Invalid data query parameter")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data query parameter"})
+		return
+	}
+	var req rollbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_request_body",
+			"error":  err.Error(),
+		}).Warn("Invalid request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	quarterObj, ok := queryQuarter(ctx, db, companyID, auditLog)
+	if !ok || !quarterEditable(ctx, db, quarterObj, false, auditLog) {
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"quarter_id": quarterObj.ID,
+		"data":       data,
+	})
+	switch data {
+	case "finance":
+		rollbackSection[*models.FinancialHealth](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "market":
+		rollbackSection[*models.MarketTraction](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "uniteconomics":
+		rollbackSection[*models.UnitEconomics](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "teamperf":
+		rollbackSection[*models.TeamPerformance](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "fund":
+		rollbackSection[*models.FundraisingStatus](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "competitive":
+		rollbackSection[*models.CompetitiveLandscape](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "operation":
+		rollbackSection[*models.OperationalEfficiency](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "risk":
+		rollbackSection[*models.RiskManagement](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "additional":
+		rollbackSection[*models.AdditionalInfo](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "self":
+		rollbackSection[*models.SelfAssessment](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "product":
+		rollbackSection[*models.ProductDevelopment](ctx, db, quarterObj, data, req.Version, auditLog)
+	case "attachments":
+		rollbackSection[*models.Attachment](ctx, db, quarterObj, data, req.Version, auditLog)
+	}
+}
@@ -49,12 +49,12 @@ func CreateCompany(ctx *gin.Context) {
 		return
 	}
 	claims, ok := claimsVal.(*Claims)
-	if !ok || claims.Role == "admin" {
+	if !ok {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
-			"role":   claims.Role,
-		}).Warn("Admins cannot create companies")
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot create companies"})
+			"reason": "invalid_claims",
+		}).Warn("Invalid claims format")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 	var req createCompanyRequest
@@ -67,6 +67,16 @@ func CreateCompany(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
 		return
 	}
+	sector, ok := models.NormalizeSector(req.Sector)
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_sector",
+			"sector": req.Sector,
+		}).Warn("Unknown sector")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown sector %q, see /company/taxonomy", req.Sector)})
+		return
+	}
 	var user models.User
 	if value, ok := handlers.UserCache.Get(claims.ID); ok {
 		user = value
@@ -95,8 +105,9 @@ func CreateCompany(ctx *gin.Context) {
 		Name:         req.Name,
 		ContactName:  req.ContactName,
 		ContactEmail: req.ContactEmail,
-		Sector:       req.Sector,
+		Sector:       sector,
 		Description:  req.Description,
+		FounderID:    &user.ID,
 	}
 	if err := db.Create(&newCompany).Error; err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "UNIQUE") {
@@ -117,7 +128,7 @@ func CreateCompany(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create company"})
 		return
 	}
-	if err := db.Model(&user).Update("startup_id", newCompany.ID).Error; err != nil {
+	if err := db.Model(&user).Updates(models.CompanyLink(newCompany.ID)).Error; err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status":     "failure",
 			"user_id":    user.ID,
@@ -197,9 +208,10 @@ func UserCompany(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{
 		"id":            startup.ID,
 		"name":          startup.Name,
-		"secret_code":   startup.SecretCode,
+		"founder":       startup.FounderID != nil && *startup.FounderID == claims.ID,
 		"contact_name":  startup.ContactName,
 		"contact_email": startup.ContactEmail,
+		"profile":       newCompanyProfile(startup),
 	})
 }
 
@@ -253,7 +265,7 @@ func DeleteCompany(ctx *gin.Context) {
 		return
 	}
 	companyID := user.StartUp.ID
-	if err := db.Delete(&models.Company{}, companyID).Error; err != nil {
+	if _, err := deleteCompany(db, companyID); err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status":     "failure",
 			"user_id":    user.ID,
@@ -263,18 +275,6 @@ func DeleteCompany(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete company"})
 		return
 	}
-	if err := db.Model(&models.User{}).
-		Where("startup_id = ?", companyID).
-		Update("startup_id", nil).Error; err != nil {
-		auditLog.WithFields(logrus.Fields{
-			"status":     "failure",
-			"user_id":    user.ID,
-			"company_id": companyID,
-			"error":      err.Error(),
-		}).Error("Failed to clear company from users")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear company from users"})
-		return
-	}
 	StartupCache.Delete(companyID)
 	auditLog.WithFields(logrus.Fields{
 		"status":     "success",
@@ -284,15 +284,35 @@ func DeleteCompany(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"message": "Company deleted successfully"})
 }
 
+// deleteCompany deletes the company, the VC assignments to it and the links
+// of its members to it, and reports whether the company existed.
+func deleteCompany(db *gorm.DB, companyID uint) (bool, error) {
+	var deleted bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Company{}, companyID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+		if err := tx.Unscoped().Where("company_id = ?", companyID).Delete(&models.VCAssignment{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("startup_id = ?", companyID).
+			Update("startup_id", nil).Error
+	})
+	return deleted, err
+}
+
 // JoinCompany godoc
 // @Summary      Join a company
-// @Description  Join company for the user
+// @Description  Joins the company with a join code from its founder. The code has to be active, not used up, and locked to the email of the user if it has an email.
 // @Tags         company
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int                true  "Company ID"
-// @Param        body body      joinCompanyRequest true  "Secret Code"
+// @Param        body body      joinCompanyRequest true  "Join code"
 // @Success      200  {object}  map[string]string
 // @Failure      400  {object}  map[string]string
 // @Failure      401  {object}  map[string]string
@@ -319,15 +339,13 @@ func JoinCompany(ctx *gin.Context) {
 		return
 	}
 	companyID := uint(companyIDUint)
-	var req struct {
-		SecretCode string `json:"secret_code" binding:"required"`
-	}
+	var req joinCompanyRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
-			"reason": "missing_or_invalid_secret_code",
-		}).Warn("Missing or invalid secret code")
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Missing or invalid secret code"})
+			"reason": "missing_join_code",
+		}).Warn("Missing join code")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Missing join code"})
 		return
 	}
 	claimsVal, exists := ctx.Get("claims")
@@ -387,17 +405,45 @@ func JoinCompany(ctx *gin.Context) {
 		}
 		StartupCache.Set(company.ID, company)
 	}
-	if company.SecretCode != req.SecretCode {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		claimed, err := models.ClaimJoinCode(tx, company.ID, req.SecretCode, strings.ToLower(user.Email), time.Now())
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return errInvalidJoinCode
+		}
+		// only join while still without a company, a concurrent join may have won
+		result := tx.Model(&user).Where("startup_id IS NULL").Updates(models.CompanyLink(company.ID))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyMember
+		}
+		// a company whose founder left gets the next member as founder
+		return tx.Model(&models.Company{}).Where("id = ? AND founder_id IS NULL", company.ID).Update("founder_id", user.ID).Error
+	})
+	if errors.Is(err, errInvalidJoinCode) {
 		auditLog.WithFields(logrus.Fields{
 			"status":     "failure",
-			"reason":     "invalid_secret_code",
+			"reason":     "invalid_join_code",
 			"company_id": companyID,
 			"user_id":    userID,
-		}).Warn("Invalid secret code")
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid secret code"})
+		}).Warn("Invalid, expired or used up join code")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired join code"})
+		return
+	}
+	if errors.Is(err, errAlreadyMember) {
+		auditLog.WithFields(logrus.Fields{
+			"status":  "failure",
+			"user_id": user.ID,
+			"reason":  "already_in_company",
+		}).Warn("User already belongs to a company")
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "User already belongs to a company"})
 		return
 	}
-	if err := db.Model(&user).Update("startup_id", company.ID).Error; err != nil {
+	if err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status":     "failure",
 			"reason":     "db_error",
@@ -408,6 +454,8 @@ func JoinCompany(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join company"})
 		return
 	}
+	StartupCache.Delete(company.ID)
+	handlers.UserCache.Delete(user.ID)
 	auditLog.WithFields(logrus.Fields{
 		"status":     "success",
 		"company_id": company.ID,
@@ -416,6 +464,23 @@ func JoinCompany(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"message": "Successfully joined the company"})
 }
 
+// respondWithInputErrors rejects requests whose numeric, percentage, month or
+// money fields could not be parsed, naming each offending field.
+func respondWithInputErrors(ctx *gin.Context, req any, table string, auditLog *logrus.Entry) bool {
+	fieldErrs := models.InputErrors(req)
+	if len(fieldErrs) == 0 {
+		return false
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "failure",
+		"error":  "invalid_field_values",
+		"table":  table,
+		"fields": fieldErrs,
+	}).Warn("Invalid field values")
+	ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field values", "fields": fieldErrs})
+	return true
+}
+
 func handleEdit[T editableModel](
 	ctx *gin.Context,
 	db *gorm.DB,
@@ -423,30 +488,37 @@ func handleEdit[T editableModel](
 	table string,
 	auditLog *logrus.Entry,
 ) {
+	if !quarterEditable(ctx, db, quarterObj, true, auditLog) {
+		return
+	}
 	var req T
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		auditLog.WithFields(logrus.Fields{
-			"status": "failure",
-			"error":  "invalid_request_body",
-			"table":  table,
+			"status":  "failure",
+			"error":   "invalid_request_body",
+			"table":   table,
+			"details": err.Error(),
 		}).Warn("Invalid request body")
-		fmt.Println(err.Error())
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	if respondWithInputErrors(ctx, req, table, auditLog) {
+		return
+	}
 	v := reflect.ValueOf(req)
 	var version uint32
 	var isEditable uint16
+	var isVisible sql.NullInt32
 	var model T
 
 	row := db.
 		Model(&model).
-		Select("version, is_editable").
+		Select("version, is_editable, is_visible").
 		Where("quarter_id = ? AND company_id = ?", quarterObj.ID, quarterObj.CompanyID).
 		Order("version DESC").
 		Limit(1).
 		Row()
-	err := row.Scan(&version, &isEditable)
+	err := row.Scan(&version, &isEditable, &isVisible)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			version = 1
@@ -477,7 +549,13 @@ func handleEdit[T editableModel](
 	}
 	v.Elem().FieldByName("QuarterID").SetUint(uint64(quarterObj.ID))
 	v.Elem().FieldByName("CompanyID").SetUint(uint64(quarterObj.CompanyID))
-	if err := db.Create(&req).Error; err != nil {
+	// a first version takes the column defaults, later ones carry the masks forward
+	if isVisible.Valid {
+		err = insertVersion(db, req, uint64(isVisible.Int32), uint64(isEditable))
+	} else {
+		err = db.Create(req).Error
+	}
+	if err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status":  "failure",
 			"error":   "db_create_failed",
@@ -487,6 +565,7 @@ func handleEdit[T editableModel](
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to add %s data", table)})
 		return
 	}
+	recordVersion(ctx, db, req.TableName(), quarterObj.CompanyID, quarterObj.ID, version, recordID(req), "edit")
 
 	getID := func() uint {
 		if v.Kind() == reflect.Pointer {
@@ -515,7 +594,7 @@ func handleEdit[T editableModel](
 
 // EditCompany godoc
 // @Summary      Edit company information
-// @Description  Updates the existing company data. If `data=info` or omitted, updates company name, contact name, and contact email. Otherwise, allows versioned updates for specific company data types (such as finance, market, uniteconomics, etc) for a given quarter and year. The allowed types are: finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, attachements. All data modifications are subject to field-level editability checks based on the current IsEditable mask for each record.
+// @Description  Updates the existing company data. If `data=info` or omitted, updates the company profile: name, contact, sector, description, stage, founding date, headquarters, website, logo, social links and tags; the quarter and year are not needed then. Otherwise, allows versioned updates for specific company data types (such as finance, market, uniteconomics, etc) for a given quarter and year. The allowed types are: finance, market, uniteconomics, teamperf, fund, competitive, operation, risk, additional, self, attachements. All data modifications are subject to field-level editability checks based on the current IsEditable mask for each record.
 // @Security     BearerAuth
 // @Tags         company
 // @Accept       json
@@ -598,32 +677,21 @@ func EditCompany(ctx *gin.Context) {
 			return
 		}
 	}
-	yearUint, err := strconv.ParseUint(yearStr, 10, 32)
-	if err != nil {
-		auditLog.WithField("status", "failure").Warn("Invalid year format")
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
-		return
-	}
-	year := uint(yearUint)
 	if data == "" || data == "info" {
-		var req struct {
-			Name         *string `json:"name"`
-			ContactName  *string `json:"contact_name"`
-			ContactEmail *string `json:"contact_email"`
-		}
+		var req companyInfoRequest
 		if err := ctx.ShouldBindJSON(&req); err != nil {
 			auditLog.WithField("status", "failure").Warn("Invalid company info body")
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
 			return
 		}
-		if req.Name != nil {
-			company.Name = *req.Name
-		}
-		if req.ContactName != nil {
-			company.ContactName = *req.ContactName
-		}
-		if req.ContactEmail != nil {
-			company.ContactEmail = *req.ContactEmail
+		if err := req.apply(&company); err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "invalid_profile",
+				"error":  err.Error(),
+			}).Warn("Invalid company info")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 		if err := db.Save(&company).Error; err != nil {
 			auditLog.WithFields(logrus.Fields{
@@ -633,10 +701,18 @@ func EditCompany(ctx *gin.Context) {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update company"})
 			return
 		}
+		StartupCache.Set(company.ID, company)
 		auditLog.WithField("status", "success").Info("Updated company info")
 		ctx.JSON(http.StatusOK, gin.H{"message": "Company updated successfully", "company": company})
 		return
 	}
+	yearUint, err := strconv.ParseUint(yearStr, 10, 32)
+	if err != nil {
+		auditLog.WithField("status", "failure").Warn("Invalid year format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+	year := uint(yearUint)
 	var quarterObj models.Quarter
 	cacheKey := fmt.Sprintf("%d_%s_%d", company.ID, quarter, year)
 	if val, ok := QuarterCache.Get(cacheKey); ok {
@@ -717,12 +793,12 @@ func AddQuarter(ctx *gin.Context) {
 		return
 	}
 	claims, ok := claimsVal.(*Claims)
-	if !ok || claims.Role == "admin" {
+	if !ok {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
-			"role":   claims.Role,
-		}).Warn("Admins cannot create quarters")
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot create quarters"})
+			"reason": "invalid_claims",
+		}).Warn("Invalid claims format")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 	var user models.User
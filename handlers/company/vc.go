@@ -0,0 +1,335 @@
+package company
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+// liveCompanyJoin leaves out assignments to deleted companies.
+const liveCompanyJoin = "JOIN companies ON companies.id = vc_assignments.company_id AND companies.deleted_at IS NULL"
+
+type visibilityModel interface {
+	VisibilityFilter(bool) map[string]any
+}
+
+type portfolioCompany struct {
+	CompanyID     uint             `json:"company_id" example:"1"`
+	CompanyName   string           `json:"company_name" example:"Acme Inc"`
+	Sector        string           `json:"sector" example:"xyz"`
+	Description   string           `json:"description" example:"We do something xyz and make money"`
+	LatestQuarter *quarterResponse `json:"latest_quarter,omitempty"`
+}
+
+// latestQuarter returns the most recent quarter the company submitted, nil
+// when it has none yet. Drafts the founders are still editing are left out.
+func latestQuarter(db *gorm.DB, companyID uint) (*models.Quarter, error) {
+	var quarter models.Quarter
+	err := db.Where("company_id = ? AND status IN ?", companyID, models.QuarterSubmittedStatuses).
+		Order("year DESC").
+		Order("quarter DESC").
+		First(&quarter).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &quarter, nil
+}
+
+// latestSection loads the latest version of a section for the quarter and
+// filters it with the public visibility mask. Missing sections give nil.
+func latestSection[T any, PT interface {
+	*T
+	visibilityModel
+}](db *gorm.DB, companyID, quarterID uint, preloads ...string) (map[string]any, error) {
+	var item T
+	query := db.Where("company_id = ? AND quarter_id = ?", companyID, quarterID).Order("version DESC")
+	for _, preload := range preloads {
+		query = query.Preload(preload)
+	}
+	if err := query.First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return PT(&item).VisibilityFilter(false), nil
+}
+
+func vcClaims(ctx *gin.Context) (*Claims, bool) {
+	claimsVal, exists := ctx.Get("claims")
+	if !exists {
+		return nil, false
+	}
+	claims, ok := claimsVal.(*Claims)
+	return claims, ok
+}
+
+// VCCompanies godoc
+// @Summary      List portfolio companies
+// @Description  Lists the companies assigned to the current VC along with their latest submitted quarter
+// @Security     BearerAuth
+// @Tags         vc
+// @Produce      json
+// @Success      200  {array}   portfolioCompany
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /vc/companies [get]
+func VCCompanies(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "vc_list_companies",
+	})
+	claims, ok := vcClaims(ctx)
+	if !ok {
+		auditLog.WithField("status", "failure").Warn("Unauthorized: no claims in context")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	auditLog = auditLog.WithField("user_id", claims.ID)
+	var assignments []models.VCAssignment
+	if err := db.Preload("Company").Joins(liveCompanyJoin).Where("vc_assignments.vc_id = ?", claims.ID).Find(&assignments).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error("Failed to fetch portfolio")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch portfolio"})
+		return
+	}
+	result := make([]portfolioCompany, 0, len(assignments))
+	for _, a := range assignments {
+		item := portfolioCompany{
+			CompanyID:   a.Company.ID,
+			CompanyName: a.Company.Name,
+			Sector:      a.Company.Sector,
+			Description: a.Company.Description,
+		}
+		quarter, err := latestQuarter(db, a.CompanyID)
+		if err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status":     "failure",
+				"reason":     "fetch_quarter_failed",
+				"company_id": a.CompanyID,
+				"error":      err.Error(),
+			}).Error("Failed to fetch latest quarter")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch portfolio"})
+			return
+		}
+		if quarter != nil {
+			item.LatestQuarter = &quarterResponse{
+				ID:      quarter.ID,
+				Quarter: quarter.Quarter,
+				Year:    quarter.Year,
+			}
+		}
+		result = append(result, item)
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"count":  len(result),
+	}).Info("Fetched VC portfolio")
+	ctx.JSON(http.StatusOK, result)
+}
+
+// VCCompanyData godoc
+// @Summary      Get portfolio company data
+// @Description  Returns the visible data of every section for an assigned company. Only submitted quarters are served, drafts the founders are still editing are not. Defaults to the latest submitted quarter.
+// @Security     BearerAuth
+// @Tags         vc
+// @Produce      json
+// @Param        id       path   int     true   "Company ID"
+// @Param        quarter  query  string  false  "Quarter (e.g. Q1, Q2, Q3, Q4)"
+// @Param        year     query  int     false  "Year"
+// @Success      200  {object}  map[string]any
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /vc/companies/{id} [get]
+func VCCompanyData(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "vc_company_data",
+	})
+	claims, ok := vcClaims(ctx)
+	if !ok {
+		auditLog.WithField("status", "failure").Warn("Unauthorized: no claims in context")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	auditLog = auditLog.WithField("user_id", claims.ID)
+	idStr := ctx.Param("id")
+	idUint, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "invalid_company_id",
+			"company_id": idStr,
+		}).Warn("Invalid company ID")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+	companyID := uint(idUint)
+	auditLog = auditLog.WithField("company_id", companyID)
+	var assignment models.VCAssignment
+	if err := db.Preload("Company").Joins(liveCompanyJoin).Where("vc_assignments.vc_id = ? AND vc_assignments.company_id = ?", claims.ID, companyID).First(&assignment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "not_assigned",
+			}).Warn("Company not in VC portfolio")
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Company is not in your portfolio"})
+			return
+		}
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error("Failed to check assignment")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch company"})
+		return
+	}
+	var quarter *models.Quarter
+	quarterStr := ctx.Query("quarter")
+	yearStr := ctx.Query("year")
+	if quarterStr != "" || yearStr != "" {
+		year, err := strconv.ParseUint(yearStr, 10, 32)
+		if err != nil || quarterStr == "" {
+			auditLog.WithFields(logrus.Fields{
+				"status":  "failure",
+				"reason":  "invalid_quarter",
+				"quarter": quarterStr,
+				"year":    yearStr,
+			}).Warn("Invalid quarter or year")
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quarter or year"})
+			return
+		}
+		var q models.Quarter
+		if err := db.Where("company_id = ? AND quarter = ? AND year = ? AND status IN ?", companyID, quarterStr, uint(year), models.QuarterSubmittedStatuses).First(&q).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				auditLog.WithFields(logrus.Fields{
+					"status":  "failure",
+					"reason":  "quarter_not_found",
+					"quarter": quarterStr,
+					"year":    year,
+				}).Warn("Quarter not found")
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Quarter not found"})
+				return
+			}
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "db_query_failed",
+				"error":  err.Error(),
+			}).Error("Failed to fetch quarter")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quarter"})
+			return
+		}
+		quarter = &q
+	} else {
+		quarter, err = latestQuarter(db, companyID)
+		if err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "db_query_failed",
+				"error":  err.Error(),
+			}).Error("Failed to fetch latest quarter")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quarter"})
+			return
+		}
+		if quarter == nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "no_quarters",
+			}).Warn("Company has no submitted quarters")
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Company has no submitted quarters"})
+			return
+		}
+	}
+	loaders := []struct {
+		name string
+		load func() (map[string]any, error)
+	}{
+		{"finance", func() (map[string]any, error) {
+			return latestSection[models.FinancialHealth](db, companyID, quarter.ID, "RevenueBreakdowns")
+		}},
+		{"market", func() (map[string]any, error) {
+			return latestSection[models.MarketTraction](db, companyID, quarter.ID)
+		}},
+		{"uniteconomics", func() (map[string]any, error) {
+			return latestSection[models.UnitEconomics](db, companyID, quarter.ID, "MarketingBreakdowns")
+		}},
+		{"teamperf", func() (map[string]any, error) {
+			return latestSection[models.TeamPerformance](db, companyID, quarter.ID)
+		}},
+		{"fund", func() (map[string]any, error) {
+			return latestSection[models.FundraisingStatus](db, companyID, quarter.ID)
+		}},
+		{"competitive", func() (map[string]any, error) {
+			return latestSection[models.CompetitiveLandscape](db, companyID, quarter.ID)
+		}},
+		{"operation", func() (map[string]any, error) {
+			return latestSection[models.OperationalEfficiency](db, companyID, quarter.ID)
+		}},
+		{"risk", func() (map[string]any, error) {
+			return latestSection[models.RiskManagement](db, companyID, quarter.ID)
+		}},
+		{"additional", func() (map[string]any, error) {
+			return latestSection[models.AdditionalInfo](db, companyID, quarter.ID)
+		}},
+		{"self", func() (map[string]any, error) {
+			return latestSection[models.SelfAssessment](db, companyID, quarter.ID)
+		}},
+		{"product", func() (map[string]any, error) {
+			return latestSection[models.ProductDevelopment](db, companyID, quarter.ID)
+		}},
+		{"attachments", func() (map[string]any, error) {
+			return latestSection[models.Attachment](db, companyID, quarter.ID)
+		}},
+	}
+	sections := make(map[string]any, len(loaders))
+	for _, loader := range loaders {
+		data, err := loader.load()
+		if err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status":  "failure",
+				"reason":  "db_query_failed",
+				"section": loader.name,
+				"error":   err.Error(),
+			}).Error("Failed to load section")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load " + loader.name})
+			return
+		}
+		sections[loader.name] = data
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":     "success",
+		"quarter_id": quarter.ID,
+	}).Info("Fetched portfolio company data")
+	ctx.JSON(http.StatusOK, gin.H{
+		"company_id":   assignment.Company.ID,
+		"company_name": assignment.Company.Name,
+		"sector":       assignment.Company.Sector,
+		"description":  assignment.Company.Description,
+		"quarter": quarterResponse{
+			ID:      quarter.ID,
+			Quarter: quarter.Quarter,
+			Year:    quarter.Year,
+		},
+		"sections": sections,
+	})
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/limiter"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+)
+
+type lockoutListResponse struct {
+	Lockouts []limiter.Entry `json:"lockouts"`
+}
+
+// throttled answers with 429 when the account or the client IP has to wait
+// after too many failed attempts, and reports whether it did. Wrong guesses are
+// counted from the audit events by the limiter hook. When the counters cannot
+// be read the attempt is let through, the credential checks still apply.
+func throttled(ctx *gin.Context, event, email string) bool {
+	attempts := values.GetLimiter()
+	if attempts == nil {
+		return false
+	}
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": event,
+		"email": email,
+	})
+	wait, err := attempts.Wait(ctx.Request.Context(), limiter.AccountKey(email), limiter.IPKey(ctx.ClientIP()))
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "limiter_unavailable",
+			"error":  err.Error(),
+		}).Error("Failed to read sign in attempts")
+		return false
+	}
+	if wait <= 0 {
+		return false
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	auditLog.WithFields(logrus.Fields{
+		"status":      "failure",
+		"reason":      "locked_out",
+		"retry_after": seconds,
+	}).Warn("Too many failed attempts")
+	ctx.Header("Retry-After", fmt.Sprint(seconds))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("Too many failed attempts, try again in %d seconds", seconds)})
+	return true
+}
+
+// GetLockouts godoc
+// @Summary      List locked accounts and IPs
+// @Description  Returns the accounts and client IPs that currently have to wait after failed sign in attempts, with their failure count and when the wait ends.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  lockoutListResponse
+// @Failure      401  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/lockouts [get]
+func GetLockouts(ctx *gin.Context) {
+	attempts := values.GetLimiter()
+	if attempts == nil {
+		ctx.JSON(http.StatusOK, lockoutListResponse{Lockouts: []limiter.Entry{}})
+		return
+	}
+	locked, err := attempts.Locked(ctx.Request.Context())
+	if err != nil {
+		utils.Logger.WithFields(logrus.Fields{
+			"ip":     ctx.ClientIP(),
+			"type":   "audit",
+			"event":  "lockout_list",
+			"status": "failure",
+			"reason": "limiter_unavailable",
+			"error":  err.Error(),
+		}).Error("Failed to list lockouts")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list lockouts"})
+		return
+	}
+	ctx.JSON(http.StatusOK, lockoutListResponse{Lockouts: locked})
+}
+
+// UnlockAccount godoc
+// @Summary      Unlock an account or IP
+// @Description  Clears the failed sign in attempts of an account, a client IP or both, lifting any lockout right away.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        email  query     string  false  "Account email"
+// @Param        ip     query     string  false  "Client IP"
+// @Success      200    {object}  map[string]string
+// @Failure      400    {object}  failedResponse
+// @Failure      401    {object}  failedResponse
+// @Failure      500    {object}  failedResponse
+// @Router       /manage/lockouts [delete]
+func UnlockAccount(ctx *gin.Context) {
+	email := strings.TrimSpace(ctx.Query("email"))
+	ip := strings.TrimSpace(ctx.Query("ip"))
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":        ctx.ClientIP(),
+		"type":      "audit",
+		"event":     "lockout_clear",
+		"target":    email,
+		"target_ip": ip,
+	})
+	if claims, ok := currentClaims(ctx); ok {
+		auditLog = auditLog.WithField("user_id", claims.ID)
+	}
+	if email == "" && ip == "" {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "missing_target",
+		}).Warn("Unlock without an email or IP")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Provide an email, an ip or both"})
+		return
+	}
+	attempts := values.GetLimiter()
+	if attempts == nil {
+		ctx.JSON(http.StatusOK, gin.H{"message": "Nothing to unlock"})
+		return
+	}
+	var keys []string
+	if email != "" {
+		keys = append(keys, limiter.AccountKey(email))
+	}
+	if ip != "" {
+		keys = append(keys, limiter.IPKey(ip))
+	}
+	for _, key := range keys {
+		if err := attempts.Reset(ctx.Request.Context(), key); err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "limiter_unavailable",
+				"error":  err.Error(),
+			}).Error("Failed to clear sign in attempts")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+			return
+		}
+	}
+	auditLog.WithField("status", "success").Info("Sign in attempts cleared")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Unlocked"})
+}
@@ -1,21 +1,27 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/mailer"
 	"github.com/vnestcc/dashboard/models"
 	"github.com/vnestcc/dashboard/utils"
 	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
 )
 
 type vcModel struct {
-	ID       uint   `json:"id" example:"1"`
-	Name     string `json:"name" example:"someone"`
-	Email    string `json:"email" example:"example@vnest.org"`
-	Approved bool   `json:"approved" example:"false"`
+	ID         uint       `json:"id" example:"1"`
+	Name       string     `json:"name" example:"someone"`
+	Email      string     `json:"email" example:"example@vnest.org"`
+	Approved   bool       `json:"approved" example:"false"`
+	Verified   bool       `json:"verified" example:"true"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty" example:"2025-01-02T15:04:05Z"`
 }
 
 // GetVCList godoc
@@ -48,10 +54,12 @@ func GetVCList(ctx *gin.Context) {
 	result := make([]vcModel, 0, len(vc))
 	for _, v := range vc {
 		result = append(result, vcModel{
-			ID:       v.ID,
-			Name:     v.Name,
-			Email:    v.Email,
-			Approved: v.Approved,
+			ID:         v.ID,
+			Name:       v.Name,
+			Email:      v.Email,
+			Approved:   v.Approved,
+			Verified:   v.VerifiedAt != nil,
+			VerifiedAt: v.VerifiedAt,
 		})
 	}
 	auditLog.WithFields(logrus.Fields{
@@ -63,7 +71,7 @@ func GetVCList(ctx *gin.Context) {
 
 // ApproveVC godoc
 // @Summary      Approve a VC
-// @Description  Sets the VC's approved field to true
+// @Description  Sets the VC's approved field to true and emails the VC that they can sign in
 // @Security     BearerAuth
 // @Tags         admin
 // @Accept       json
@@ -116,12 +124,27 @@ func ApproveVC(ctx *gin.Context) {
 		"status": "success",
 		"id":     id,
 	}).Info("VC approved")
+	var vc models.User
+	if err := db.First(&vc, uint(id)).Error; err == nil {
+		mail := values.GetMailer()
+		if err := mail.Enqueue(ctx.Request.Context(), vc.Email, mailer.TemplateVCApproved, mailer.VCApprovedData{
+			Name: vc.Name,
+			Link: mail.Link(""),
+		}); err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "mail_queue_failed",
+				"id":     id,
+				"error":  err.Error(),
+			}).Error("Failed to queue VC approval mail")
+		}
+	}
 	ctx.JSON(http.StatusOK, gin.H{"message": "VC approved"})
 }
 
 // RemoveVC godoc
 // @Summary      Unapprove a VC
-// @Description  Sets the VC's approved field to false
+// @Description  Sets the VC's approved field to false and signs them out of every device
 // @Security     BearerAuth
 // @Tags         admin
 // @Accept       json
@@ -151,18 +174,28 @@ func RemoveVC(ctx *gin.Context) {
 		return
 	}
 
-	result := db.Model(&models.User{}).Where("id = ?", uint(id)).Update("approved", false)
-	if result.Error != nil {
+	var vc models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND role = ?", uint(id), "vc").First(&vc).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&vc).Update("approved", false).Error; err != nil {
+			return err
+		}
+		// signed in devices lose access right away instead of when their token expires
+		return models.RevokeUserSessions(tx, vc.ID)
+	})
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
 			"reason": "db_update_failed",
 			"id":     id,
-			"error":  result.Error.Error(),
+			"error":  err.Error(),
 		}).Error("Failed to remove VC approval")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove VC approval"})
 		return
 	}
-	if result.RowsAffected == 0 {
+	if err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
 			"reason": "user_not_found",
@@ -171,6 +204,8 @@ func RemoveVC(ctx *gin.Context) {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
 		return
 	}
+	LoginCache.Delete(vc.Email)
+	UserCache.Delete(vc.ID)
 
 	auditLog.WithFields(logrus.Fields{
 		"status": "success",
@@ -181,7 +216,7 @@ func RemoveVC(ctx *gin.Context) {
 
 // DeleteVC godoc
 // @Summary      Delete a VC
-// @Description  Deletes the VC from the database by ID
+// @Description  Deletes the VC from the database by ID, ending all of their sessions
 // @Security     BearerAuth
 // @Tags         admin
 // @Accept       json
@@ -210,18 +245,31 @@ func DeleteVC(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
-	result := db.Unscoped().Where("id = ? AND role = ?", uint(id), "vc").Delete(&models.User{})
-	if result.Error != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// assignments reference the user, so they go first
+		if err := tx.Unscoped().Where("vc_id = ?", uint(id)).Delete(&models.VCAssignment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", uint(id)).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id = ? AND role = ?", uint(id), "vc").Delete(&models.User{})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
 			"reason": "db_delete_failed",
 			"id":     id,
-			"error":  result.Error.Error(),
+			"error":  err.Error(),
 		}).Error("Failed to delete VC")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete VC"})
 		return
 	}
-	if result.RowsAffected == 0 {
+	if err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
 			"reason": "vc_not_found",
@@ -239,7 +287,7 @@ func DeleteVC(ctx *gin.Context) {
 
 // DeleteUserByID godoc
 // @Summary      Delete a User
-// @Description  Deletes a User by ID (hard delete)
+// @Description  Deletes a User by ID (hard delete), ending all of their sessions
 // @Security     BearerAuth
 // @Tags         admin
 // @Accept       json
@@ -268,18 +316,30 @@ func DeleteUserByID(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
-	result := db.Unscoped().Where("id = ? AND role = ?", uint(id), "user").Delete(&models.User{})
-	if result.Error != nil {
+	var user models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("id = ? AND role = ?", uint(id), "user").First(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		if err := models.HandOverFounder(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&user).Error
+	})
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
 			"reason": "db_delete_failed",
 			"id":     id,
-			"error":  result.Error.Error(),
+			"error":  err.Error(),
 		}).Error("Failed to delete user")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
-	if result.RowsAffected == 0 {
+	if err != nil {
 		auditLog.WithFields(logrus.Fields{
 			"status": "failure",
 			"reason": "user_not_found",
@@ -288,6 +348,8 @@ func DeleteUserByID(ctx *gin.Context) {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
 		return
 	}
+	LoginCache.Delete(user.Email)
+	UserCache.Delete(user.ID)
 	auditLog.WithFields(logrus.Fields{
 		"status": "success",
 		"id":     id,
@@ -296,11 +358,13 @@ func DeleteUserByID(ctx *gin.Context) {
 }
 
 type userModel struct {
-	ID        uint   `json:"id" example:"1"`
-	Name      string `json:"name" example:"John Doe"`
-	Email     string `json:"email" example:"john@example.com"`
-	IsDeleted bool   `json:"is_deleted" example:"false"`
-	StartUpID *uint  `json:"startup_id,omitempty" example:"42"`
+	ID         uint       `json:"id" example:"1"`
+	Name       string     `json:"name" example:"John Doe"`
+	Email      string     `json:"email" example:"john@example.com"`
+	IsDeleted  bool       `json:"is_deleted" example:"false"`
+	StartUpID  *uint      `json:"startup_id,omitempty" example:"42"`
+	Verified   bool       `json:"verified" example:"true"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty" example:"2025-01-02T15:04:05Z"`
 }
 
 // GetUserList godoc
@@ -333,11 +397,13 @@ func GetUserList(ctx *gin.Context) {
 	result := make([]userModel, 0, len(users))
 	for _, v := range users {
 		result = append(result, userModel{
-			ID:        v.ID,
-			Name:      v.Name,
-			Email:     v.Email,
-			StartUpID: v.StartupID,
-			IsDeleted: v.DeletedAt.Valid,
+			ID:         v.ID,
+			Name:       v.Name,
+			Email:      v.Email,
+			StartUpID:  v.StartupID,
+			IsDeleted:  v.DeletedAt.Valid,
+			Verified:   v.VerifiedAt != nil,
+			VerifiedAt: v.VerifiedAt,
 		})
 	}
 	auditLog.WithFields(logrus.Fields{
@@ -346,3 +412,247 @@ func GetUserList(ctx *gin.Context) {
 	}).Info("Fetched user list successfully")
 	ctx.JSON(http.StatusOK, result)
 }
+
+type assignCompanyRequest struct {
+	CompanyID uint `json:"company_id" example:"1" binding:"required"`
+}
+
+type assignmentModel struct {
+	CompanyID   uint   `json:"company_id" example:"1"`
+	CompanyName string `json:"company_name" example:"Acme Inc"`
+	AssignedAt  string `json:"assigned_at" example:"2025-04-01T00:00:00Z"`
+}
+
+// GetVCAssignments godoc
+// @Summary      List companies assigned to a VC
+// @Description  Returns the companies in the portfolio of the given VC
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      int  true  "VC ID"
+// @Success      200  {array}   assignmentModel
+// @Failure      400  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/vc/{id}/companies [get]
+func GetVCAssignments(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "get_vc_assignments",
+	})
+	idParam := ctx.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_id",
+			"id":     idParam,
+		}).Warn("Invalid VC ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var assignments []models.VCAssignment
+	if err := db.Preload("Company").
+		Joins("JOIN companies ON companies.id = vc_assignments.company_id AND companies.deleted_at IS NULL").
+		Where("vc_assignments.vc_id = ?", uint(id)).
+		Find(&assignments).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"id":     id,
+			"error":  err.Error(),
+		}).Error("Failed to get VC assignments")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get VC assignments"})
+		return
+	}
+	result := make([]assignmentModel, 0, len(assignments))
+	for _, a := range assignments {
+		result = append(result, assignmentModel{
+			CompanyID:   a.CompanyID,
+			CompanyName: a.Company.Name,
+			AssignedAt:  a.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"id":     id,
+		"count":  len(result),
+	}).Info("Fetched VC assignments")
+	ctx.JSON(http.StatusOK, result)
+}
+
+// AssignVCCompany godoc
+// @Summary      Assign a company to a VC
+// @Description  Adds a company to the portfolio of an approved VC
+// @Security     BearerAuth
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                   true  "VC ID"
+// @Param        body  body      assignCompanyRequest  true  "Company to assign"
+// @Success      200   {object}  map[string]string
+// @Failure      400   {object}  failedResponse
+// @Failure      404   {object}  failedResponse
+// @Failure      409   {object}  failedResponse
+// @Failure      500   {object}  failedResponse
+// @Router       /manage/vc/{id}/companies [post]
+func AssignVCCompany(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "assign_vc_company",
+	})
+	idParam := ctx.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_id",
+			"id":     idParam,
+		}).Warn("Invalid VC ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var req assignCompanyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+			"id":     id,
+		}).Warn("Invalid assignment input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	var vc models.User
+	if err := db.Where("id = ? AND role = ?", uint(id), "vc").First(&vc).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "vc_not_found",
+			"id":     id,
+		}).Warn("VC does not exist")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "VC does not exist"})
+		return
+	}
+	if !vc.Approved {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "vc_not_approved",
+			"id":     id,
+		}).Warn("VC is not approved")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "VC is not approved"})
+		return
+	}
+	var company models.Company
+	if err := db.First(&company, req.CompanyID).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "company_not_found",
+			"id":         id,
+			"company_id": req.CompanyID,
+		}).Warn("Company does not exist")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Company does not exist"})
+		return
+	}
+	assignment := models.VCAssignment{VCID: vc.ID, CompanyID: company.ID}
+	if err := db.Create(&assignment).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			auditLog.WithFields(logrus.Fields{
+				"status":     "failure",
+				"reason":     "already_assigned",
+				"id":         id,
+				"company_id": company.ID,
+			}).Warn("Company already assigned to VC")
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Company already assigned to this VC"})
+			return
+		}
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "db_create_failed",
+			"id":         id,
+			"company_id": company.ID,
+			"error":      err.Error(),
+		}).Error("Failed to assign company to VC")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign company"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":     "success",
+		"id":         id,
+		"company_id": company.ID,
+	}).Info("Company assigned to VC")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Company assigned to VC"})
+}
+
+// UnassignVCCompany godoc
+// @Summary      Remove a company from a VC
+// @Description  Removes a company from the portfolio of a VC
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        id          path      int  true  "VC ID"
+// @Param        company_id  path      int  true  "Company ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  failedResponse
+// @Failure      404  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/vc/{id}/companies/{company_id} [delete]
+func UnassignVCCompany(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "unassign_vc_company",
+	})
+	idParam := ctx.Param("id")
+	companyParam := ctx.Param("company_id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_id",
+			"id":     idParam,
+		}).Warn("Invalid VC ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	companyID, err := strconv.ParseUint(companyParam, 10, 64)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "invalid_company_id",
+			"company_id": companyParam,
+		}).Warn("Invalid company ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+	result := db.Unscoped().Where("vc_id = ? AND company_id = ?", uint(id), uint(companyID)).Delete(&models.VCAssignment{})
+	if result.Error != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "db_delete_failed",
+			"id":         id,
+			"company_id": companyID,
+			"error":      result.Error.Error(),
+		}).Error("Failed to remove VC assignment")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove assignment"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		auditLog.WithFields(logrus.Fields{
+			"status":     "failure",
+			"reason":     "assignment_not_found",
+			"id":         id,
+			"company_id": companyID,
+		}).Warn("Assignment does not exist")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Assignment does not exist"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":     "success",
+		"id":         id,
+		"company_id": companyID,
+	}).Info("VC assignment removed")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Company removed from VC"})
+}
@@ -0,0 +1,509 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/mailer"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/rbac"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+const inviteExpiry = 72 * time.Hour
+
+var errInviteTaken = errors.New("email belongs to another account")
+
+type inviteModeratorRequest struct {
+	Email string `json:"email" example:"staff@vnest.org" binding:"required,email"`
+	// Role defaults to moderator, see /manage/roles for the other staff roles
+	Role string `json:"role" example:"moderator"`
+}
+
+type inviteResponse struct {
+	ID          uint   `json:"id" example:"1"`
+	Email       string `json:"email" example:"staff@vnest.org"`
+	Role        string `json:"role" example:"moderator"`
+	InviteToken string `json:"invite_token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	ExpiresAt   int64  `json:"expires_at" example:"1735689600"`
+}
+
+type moderatorModel struct {
+	ID        uint   `json:"id" example:"3"`
+	Name      string `json:"name" example:"someone"`
+	Email     string `json:"email" example:"staff@vnest.org"`
+	Role      string `json:"role" example:"moderator"`
+	Active    bool   `json:"active" example:"true"`
+	CreatedAt string `json:"created_at" example:"2025-04-01T00:00:00Z"`
+}
+
+type pendingInviteModel struct {
+	ID        uint   `json:"id" example:"1"`
+	Email     string `json:"email" example:"staff@vnest.org"`
+	Role      string `json:"role" example:"moderator"`
+	InvitedBy uint   `json:"invited_by" example:"1"`
+	ExpiresAt string `json:"expires_at" example:"2025-04-04T00:00:00Z"`
+}
+
+type moderatorListResponse struct {
+	Moderators []moderatorModel     `json:"moderators"`
+	Invites    []pendingInviteModel `json:"invites"`
+}
+
+type moderatorSignupRequest struct {
+	InviteToken string `json:"invite_token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" binding:"required"`
+	Name        string `json:"name" example:"someone" binding:"required"`
+	Password    string `json:"password" example:"superstrongpassword" binding:"required,min=8"`
+}
+
+// InviteModerator godoc
+// @Summary      Invite a moderator
+// @Description  Creates a one-time signup token for the email, valid for 72 hours, for a moderator or another staff role except admin, and cancels earlier open invites to it. The invite link is emailed, and the token is also returned here once so it can be passed on by hand. It is redeemed at /auth/moderator/signup. Inviting a revoked moderator reinstates them once they sign up again.
+// @Security     BearerAuth
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        request  body      inviteModeratorRequest  true  "Email to invite"
+// @Success      200      {object}  inviteResponse
+// @Failure      400      {object}  failedResponse
+// @Failure      401      {object}  failedResponse
+// @Failure      409      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /manage/moderators/invite [post]
+func InviteModerator(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "moderator_invite",
+	})
+	claims, ok := currentClaims(ctx)
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_claims",
+		}).Warn("Moderator invite without valid claims")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	auditLog = auditLog.WithField("user_id", claims.ID)
+	var input inviteModeratorRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid moderator invite input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	role := input.Role
+	if role == "" {
+		role = rbac.RoleModerator
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"invitee": email,
+		"role":    role,
+	})
+	staff := rbac.InvitableRoles()
+	if !slices.Contains(staff, role) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_role",
+		}).Warn("Invite for a role that cannot be invited")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	token, err := newRefreshToken()
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("Failed to generate invite token")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+	invite := models.ModeratorInvite{
+		Email:     email,
+		Role:      role,
+		TokenHash: hashToken(token),
+		InvitedBy: claims.ID,
+		ExpiresAt: time.Now().Add(inviteExpiry),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing models.User
+		err := tx.Where("LOWER(email) = ?", email).First(&existing).Error
+		if err == nil && (!slices.Contains(staff, existing.Role) || existing.Approved) {
+			return errInviteTaken
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := tx.Where("email = ? AND accepted_at IS NULL", email).Delete(&models.ModeratorInvite{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invite).Error
+	})
+	if errors.Is(err, errInviteTaken) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "email_taken",
+		}).Warn("Invite for an email that already has an account")
+		ctx.JSON(http.StatusConflict, gin.H{"error": "This email already has an account"})
+		return
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_insert_failed",
+			"error":  err.Error(),
+		}).Error("Failed to create moderator invite")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+	mail := values.GetMailer()
+	if err := mail.Enqueue(ctx.Request.Context(), invite.Email, mailer.TemplateModeratorInvite, mailer.ModeratorInviteData{
+		Link:      mail.Link("/moderator/signup?token=" + token),
+		ExpiresAt: invite.ExpiresAt.UTC().Format("2 Jan 2006 15:04 MST"),
+	}); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "mail_queue_failed",
+			"error":  err.Error(),
+		}).Error("Failed to queue moderator invite mail")
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":    "success",
+		"invite_id": invite.ID,
+	}).Info("Moderator invited")
+	ctx.JSON(http.StatusOK, inviteResponse{
+		ID:          invite.ID,
+		Email:       invite.Email,
+		Role:        invite.Role,
+		InviteToken: token,
+		ExpiresAt:   invite.ExpiresAt.Unix(),
+	})
+}
+
+// GetModerators godoc
+// @Summary      List moderators
+// @Description  Returns every moderator and other invited staff account, active or revoked, and the invites that have not been used or expired yet
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  moderatorListResponse
+// @Failure      401  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/moderators [get]
+func GetModerators(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "get_moderator_list",
+	})
+	var users []models.User
+	if err := db.Where("role IN ?", rbac.InvitableRoles()).Order("id").Find(&users).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error("Failed to get the list of moderators")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get the list of moderators"})
+		return
+	}
+	var invites []models.ModeratorInvite
+	if err := db.Where("accepted_at IS NULL AND expires_at > ?", time.Now()).Order("id").Find(&invites).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error("Failed to get the list of moderator invites")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get the list of moderators"})
+		return
+	}
+	response := moderatorListResponse{
+		Moderators: make([]moderatorModel, 0, len(users)),
+		Invites:    make([]pendingInviteModel, 0, len(invites)),
+	}
+	for _, user := range users {
+		response.Moderators = append(response.Moderators, moderatorModel{
+			ID:        user.ID,
+			Name:      user.Name,
+			Email:     user.Email,
+			Role:      user.Role,
+			Active:    user.Approved,
+			CreatedAt: user.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	for _, invite := range invites {
+		response.Invites = append(response.Invites, pendingInviteModel{
+			ID:        invite.ID,
+			Email:     invite.Email,
+			Role:      invite.Role,
+			InvitedBy: invite.InvitedBy,
+			ExpiresAt: invite.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":          "success",
+		"moderator_count": len(response.Moderators),
+		"invite_count":    len(response.Invites),
+	}).Info("Fetched moderator list successfully")
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RevokeModerator godoc
+// @Summary      Revoke a moderator
+// @Description  Takes away moderator access and signs the moderator out of every device. The account is kept so their edits stay attributed; invite the email again to reinstate it.
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      int  true  "Moderator ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  failedResponse
+// @Failure      404  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/moderators/{id} [delete]
+func RevokeModerator(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "moderator_revoke",
+	})
+	idParam := ctx.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_id",
+			"id":     idParam,
+		}).Warn("Invalid moderator ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var moderator models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND role IN ?", uint(id), rbac.InvitableRoles()).First(&moderator).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&moderator).Update("approved", false).Error; err != nil {
+			return err
+		}
+		return models.RevokeUserSessions(tx, moderator.ID)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "user_not_found",
+			"id":     id,
+		}).Warn("Moderator does not exist")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Moderator does not exist"})
+		return
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"id":     id,
+			"error":  err.Error(),
+		}).Error("Failed to revoke moderator")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke moderator"})
+		return
+	}
+	LoginCache.Delete(moderator.Email)
+	UserCache.Delete(moderator.ID)
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"id":     id,
+		"email":  moderator.Email,
+	}).Info("Moderator revoked")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Moderator revoked"})
+}
+
+// CancelModeratorInvite godoc
+// @Summary      Cancel a moderator invite
+// @Description  Invalidates an invite that has not been used yet
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      int  true  "Invite ID"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  failedResponse
+// @Failure      404  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/moderators/invites/{id} [delete]
+func CancelModeratorInvite(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "moderator_invite_cancel",
+	})
+	idParam := ctx.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_id",
+			"id":     idParam,
+		}).Warn("Invalid invite ID format")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	result := db.Where("id = ? AND accepted_at IS NULL", uint(id)).Delete(&models.ModeratorInvite{})
+	if result.Error != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_delete_failed",
+			"id":     id,
+			"error":  result.Error.Error(),
+		}).Error("Failed to cancel moderator invite")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel invite"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invite_not_found",
+			"id":     id,
+		}).Warn("Open invite does not exist")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Invite does not exist or was already used"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"id":     id,
+	}).Info("Moderator invite cancelled")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Invite cancelled"})
+}
+
+// ModeratorSignupHandler godoc
+// @Summary      Moderator Signup
+// @Description  Creates a staff account with the role of the invite for its email and signs it in. Each invite token works once. A revoked moderator invited again gets their account back with the new name, password and role.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      moderatorSignupRequest  true  "Invite token and account details"
+// @Success      200      {object}  successResponse
+// @Success      202      {object}  challengeResponse  "Second factor needed, finish at /auth/2fa/verify"
+// @Failure      400      {object}  failedResponse
+// @Failure      401      {object}  failedResponse
+// @Failure      409      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /auth/moderator/signup [post]
+func ModeratorSignupHandler(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "moderator_signup",
+	})
+	var input moderatorSignupRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid moderator signup input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	var user models.User
+	var invite models.ModeratorInvite
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var claimed bool
+		var err error
+		if invite, claimed, err = models.ClaimModeratorInvite(tx, hashToken(input.InviteToken), time.Now()); err != nil {
+			return err
+		} else if !claimed {
+			return gorm.ErrRecordNotFound
+		}
+		err = tx.Where("LOWER(email) = ? AND role IN ?", invite.Email, rbac.InvitableRoles()).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user = models.User{
+				Name:     input.Name,
+				Email:    invite.Email,
+				Password: input.Password,
+				Role:     invite.Role,
+				Approved: true,
+				// the invite link reached this address
+				VerifiedAt: invite.AcceptedAt,
+			}
+			err = tx.Create(&user).Error
+		} else if err == nil {
+			if err = user.SetPassword(input.Password); err != nil {
+				return err
+			}
+			user.Name = input.Name
+			user.Role = invite.Role
+			user.Approved = true
+			if user.VerifiedAt == nil {
+				user.VerifiedAt = invite.AcceptedAt
+			}
+			err = tx.Model(&user).Select("name", "password", "role", "approved", "verified_at").Updates(&user).Error
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&invite).Update("user_id", user.ID).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_or_expired_invite",
+		}).Warn("Moderator signup with an unknown or used invite")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired invite"})
+		return
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "email_taken",
+			"email":  invite.Email,
+		}).Warn("Invited email got another account before signup")
+		ctx.JSON(http.StatusConflict, gin.H{"error": "This email already has an account"})
+		return
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_create_failed",
+			"email":  invite.Email,
+			"error":  err.Error(),
+		}).Error("Failed to create moderator")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+		return
+	}
+	LoginCache.Delete(user.Email)
+	UserCache.Delete(user.ID)
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"user_id":   user.ID,
+		"email":     user.Email,
+		"invite_id": invite.ID,
+	})
+	auditLog.WithField("status", "success").Info("Moderator signed up")
+	if requireSecondFactor(ctx, db, &user) {
+		return
+	}
+	tokens, err := startSession(ctx, db, &user)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("JWT generation failed after moderator signup")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create JWT"})
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnestcc/dashboard/rbac"
+)
+
+type permissionModel struct {
+	Name        rbac.Permission `json:"name" example:"quarter.open"`
+	Description string          `json:"description" example:"Open and close quarters for companies"`
+}
+
+type rolesResponse struct {
+	Roles       []rbac.Role       `json:"roles"`
+	Permissions []permissionModel `json:"permissions"`
+}
+
+// GetRoles godoc
+// @Summary      List roles and permissions
+// @Description  Returns every role with the permissions it grants, including roles added in the config, and the description of every permission
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  rolesResponse
+// @Failure      401  {object}  failedResponse
+// @Failure      403  {object}  failedResponse
+// @Router       /manage/roles [get]
+func GetRoles(ctx *gin.Context) {
+	response := rolesResponse{
+		Roles:       rbac.Roles(),
+		Permissions: make([]permissionModel, 0, len(rbac.Permissions)),
+	}
+	for _, perm := range rbac.Permissions {
+		response.Permissions = append(response.Permissions, permissionModel{Name: perm.Name, Description: perm.Description})
+	}
+	ctx.JSON(http.StatusOK, response)
+}
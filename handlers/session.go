@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/rbac"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAccessTokenExpiry  = 15 * time.Minute
+	defaultRefreshTokenExpiry = 30 * 24 * time.Hour
+)
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" binding:"required"`
+}
+
+func accessTokenExpiry() time.Duration {
+	if minutes := values.GetConfig().Server.AccessTokenExpiry; minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultAccessTokenExpiry
+}
+
+func refreshTokenExpiry() time.Duration {
+	if hours := values.GetConfig().Server.RefreshTokenExpiry; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultRefreshTokenExpiry
+}
+
+// hashToken is how refresh tokens are stored, they are long and random enough
+// that a plain hash cannot be reversed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRefreshToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// sessionTokens signs a new access token for a session and pairs it with its refresh token.
+func sessionTokens(user *models.User, sessionID uint, refreshToken string) (successResponse, error) {
+	expiresAt := time.Now().Add(accessTokenExpiry())
+	token, err := generateJWT(user.ID, user.Role, sessionID, expiresAt)
+	if err != nil {
+		return successResponse{}, err
+	}
+	return successResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt.Unix(),
+	}, nil
+}
+
+// startSession signs the user in on a new device and returns its first token pair.
+func startSession(ctx *gin.Context, db *gorm.DB, user *models.User) (successResponse, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return successResponse{}, err
+	}
+	now := time.Now()
+	session := models.Session{
+		UserID:     user.ID,
+		TokenHash:  hashToken(refreshToken),
+		ExpiresAt:  now.Add(refreshTokenExpiry()),
+		LastUsedAt: now,
+		IP:         ctx.ClientIP(),
+		UserAgent:  ctx.Request.UserAgent(),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return successResponse{}, err
+	}
+	return sessionTokens(user, session.ID, refreshToken)
+}
+
+// RefreshTokenHandler godoc
+// @Summary      Refresh the access token
+// @Description  Exchanges a refresh token for a new access token and a new refresh token. Every refresh token works once; presenting one that was already exchanged signs the session out, since it means the token was copied.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      refreshRequest  true  "Refresh token"
+// @Success      200      {object}  successResponse
+// @Failure      400      {object}  failedResponse
+// @Failure      401      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /auth/refresh [post]
+func RefreshTokenHandler(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "refresh_token",
+	})
+	var input refreshRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid refresh token input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	now := time.Now()
+	hash := hashToken(input.RefreshToken)
+	var session models.Session
+	if err := db.Where("token_hash = ?", hash).First(&session).Error; err != nil {
+		var reused models.Session
+		if db.Where("previous_hash = ? AND revoked_at IS NULL", hash).First(&reused).Error == nil {
+			db.Model(&reused).Update("revoked_at", now)
+			auditLog.WithFields(logrus.Fields{
+				"status":     "failure",
+				"reason":     "token_reused",
+				"user_id":    reused.UserID,
+				"session_id": reused.ID,
+			}).Warn("Refresh token used twice, session revoked")
+		} else {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "unknown_token",
+			}).Warn("Unknown refresh token")
+		}
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"user_id":    session.UserID,
+		"session_id": session.ID,
+	})
+	if !session.Active(now) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "session_inactive",
+		}).Warn("Refresh on an expired or revoked session")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
+		return
+	}
+	var user models.User
+	if err := db.First(&user, session.UserID).Error; err != nil {
+		db.Model(&session).Update("revoked_at", now)
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "user_not_found",
+		}).Warn("Refresh for a deleted user")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
+		return
+	}
+	if rbac.NeedsApproval(user.Role) && !user.Approved {
+		db.Model(&session).Update("revoked_at", now)
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "not_approved",
+		}).Warn("Refresh for an account that is no longer approved")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "This account is not approved"})
+		return
+	}
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("Failed to generate refresh token")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	// matching on the old hash makes two refreshes racing with the same token fail one of them
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND token_hash = ?", session.ID, hash).
+		Updates(map[string]any{
+			"token_hash":    hashToken(refreshToken),
+			"previous_hash": hash,
+			"last_used_at":  now,
+			"ip":            ctx.ClientIP(),
+			"user_agent":    ctx.Request.UserAgent(),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		reason := "token_already_rotated"
+		if result.Error != nil {
+			reason = result.Error.Error()
+		}
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "rotation_failed",
+			"error":  reason,
+		}).Warn("Failed to rotate refresh token")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	tokens, err := sessionTokens(&user, session.ID, refreshToken)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("JWT generation failed on refresh")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create JWT"})
+		return
+	}
+	auditLog.WithField("status", "success").Info("Access token refreshed")
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// LogoutHandler godoc
+// @Summary      Log out
+// @Description  Revokes the session of the current token. Its access token and refresh token stop working immediately.
+// @Tags         auth
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Failure      401  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /auth/logout [post]
+func LogoutHandler(ctx *gin.Context) {
+	handleLogout(ctx, false)
+}
+
+// LogoutAllHandler godoc
+// @Summary      Log out of all devices
+// @Description  Revokes every session of the current user, including the one making the request.
+// @Tags         auth
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Failure      401  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /auth/logout-all [post]
+func LogoutAllHandler(ctx *gin.Context) {
+	handleLogout(ctx, true)
+}
+
+func handleLogout(ctx *gin.Context, everywhere bool) {
+	db := values.GetDB()
+	event := "logout"
+	if everywhere {
+		event = "logout_all"
+	}
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": event,
+	})
+	claimsVal, exists := ctx.Get("claims")
+	claims, ok := claimsVal.(*Claims)
+	if !exists || !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_claims",
+		}).Warn("Logout without valid claims")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"user_id":    claims.ID,
+		"session_id": claims.SessionID,
+	})
+	var err error
+	if everywhere {
+		err = models.RevokeUserSessions(db, claims.ID)
+	} else {
+		err = db.Model(&models.Session{}).
+			Where("id = ? AND user_id = ?", claims.SessionID, claims.ID).
+			Update("revoked_at", time.Now()).Error
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  err.Error(),
+		}).Error("Failed to revoke session")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	auditLog.WithField("status", "success").Info("Logged out")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/oidc"
+	"github.com/vnestcc/dashboard/rbac"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+// ssoStateCookie ties a started sign in to the browser that started it, so
+// nobody can have a victim's browser finish a sign in into their account.
+const (
+	ssoStateCookie = "sso_state"
+	ssoStatePath   = "/api/auth/sso"
+)
+
+type ssoProvider struct {
+	Name        string `json:"name" example:"acme"`
+	DisplayName string `json:"display_name" example:"Acme Capital"`
+}
+
+type ssoStartResponse struct {
+	AuthorizationURL string `json:"authorization_url" example:"https://login.example.com/authorize?client_id=dashboard&code_challenge=..."`
+}
+
+type ssoCallbackRequest struct {
+	Code  string `json:"code" example:"SplxlOBeZQQYbYS6WxSbIA" binding:"required"`
+	State string `json:"state" example:"af0ifjsldkj" binding:"required"`
+}
+
+// GetSSOProviders godoc
+// @Summary      List SSO providers
+// @Description  Returns the identity providers accounts can sign in with
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  []ssoProvider
+// @Router       /auth/sso [get]
+func GetSSOProviders(ctx *gin.Context) {
+	providers := values.GetSSO().Providers()
+	result := make([]ssoProvider, 0, len(providers))
+	for _, provider := range providers {
+		result = append(result, ssoProvider{Name: provider.Name(), DisplayName: provider.DisplayName()})
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// StartSSO godoc
+// @Summary      Start an SSO sign in
+// @Description  Returns the URL of the identity provider to send the browser to and sets an HttpOnly cookie holding the state. The provider redirects back to the configured frontend page with a code and state, which are passed on to the callback within 10 minutes from the same browser, with credentials included.
+// @Tags         auth
+// @Produce      json
+// @Param        provider  path      string  true  "Provider name"
+// @Success      200       {object}  ssoStartResponse
+// @Failure      404       {object}  failedResponse
+// @Failure      502       {object}  failedResponse
+// @Router       /auth/sso/{provider} [get]
+func StartSSO(ctx *gin.Context) {
+	name := ctx.Param("provider")
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":       ctx.ClientIP(),
+		"type":     "audit",
+		"event":    "sso_start",
+		"provider": name,
+	})
+	authURL, state, err := values.GetSSO().Begin(ctx.Request.Context(), name)
+	if errors.Is(err, oidc.ErrUnknownProvider) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "unknown_provider",
+		}).Warn("SSO start with an unknown provider")
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "provider_unavailable",
+			"error":  err.Error(),
+		}).Error("Failed to start SSO sign in")
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "The identity provider is not reachable"})
+		return
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(ssoStateCookie, state, int(oidc.StateExpiry.Seconds()), ssoStatePath, "", values.GetConfig().Server.Prod, true)
+	ctx.JSON(http.StatusOK, ssoStartResponse{AuthorizationURL: authURL})
+}
+
+// SSOCallback godoc
+// @Summary      Finish an SSO sign in
+// @Description  Exchanges the code from the identity provider and signs in the account with the verified email. Unknown emails get a VC account when the provider allows it, which waits for an admin unless its domain is approved automatically.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        provider  path      string              true  "Provider name"
+// @Param        request   body      ssoCallbackRequest  true  "Code and state from the redirect"
+// @Success      200       {object}  successResponse
+// @Success      201       {object}  map[string]string  "VC account created, waiting for approval"
+// @Success      202       {object}  challengeResponse  "Second factor needed, finish at /auth/2fa/verify"
+// @Failure      400       {object}  failedResponse
+// @Failure      401       {object}  failedResponse
+// @Failure      403       {object}  failedResponse
+// @Failure      404       {object}  failedResponse
+// @Failure      500       {object}  failedResponse
+// @Router       /auth/sso/{provider}/callback [post]
+func SSOCallback(ctx *gin.Context) {
+	db := values.GetDB()
+	name := ctx.Param("provider")
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":       ctx.ClientIP(),
+		"type":     "audit",
+		"event":    "sso_login",
+		"provider": name,
+	})
+	var input ssoCallbackRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid SSO callback input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	cookie, _ := ctx.Cookie(ssoStateCookie)
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(ssoStateCookie, "", -1, ssoStatePath, "", values.GetConfig().Server.Prod, true)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(input.State)) != 1 {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "state_mismatch",
+		}).Warn("SSO callback from another browser than the one that started it")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "The sign in expired, please start again"})
+		return
+	}
+	provider, identity, err := values.GetSSO().Finish(ctx.Request.Context(), name, input.Code, input.State)
+	if err != nil {
+		status, reason, message := http.StatusUnauthorized, "exchange_failed", "Sign in with the identity provider failed"
+		switch {
+		case errors.Is(err, oidc.ErrUnknownProvider):
+			status, reason, message = http.StatusNotFound, "unknown_provider", "Unknown provider"
+		case errors.Is(err, oidc.ErrInvalidState):
+			reason, message = "invalid_state", "The sign in expired, please start again"
+		case errors.Is(err, oidc.ErrEmailNotVerified):
+			status, reason, message = http.StatusForbidden, "email_not_verified", "The identity provider did not confirm your email address"
+		}
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": reason,
+			"error":  err.Error(),
+		}).Warn("SSO sign in failed")
+		ctx.JSON(status, gin.H{"error": message})
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"email":   identity.Email,
+		"subject": identity.Subject,
+	})
+	var user models.User
+	err = db.Where("LOWER(email) = ?", identity.Email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ssoSignup(ctx, provider, identity, auditLog)
+		return
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_fetch_failed",
+			"error":  err.Error(),
+		}).Error("Failed to look up the SSO account")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+	auditLog = auditLog.WithField("user_id", user.ID)
+	if !provider.AllowsRole(user.Role) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "role_not_allowed",
+			"role":   user.Role,
+		}).Warn("SSO sign in for a role the provider does not cover")
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "This account cannot sign in with this provider"})
+		return
+	}
+	// the provider confirmed the email, so an unverified account is verified now
+	if user.VerifiedAt == nil {
+		now := time.Now()
+		if err := db.Model(&user).Update("verified_at", now).Error; err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "db_update_failed",
+				"error":  err.Error(),
+			}).Error("Failed to update the SSO account")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+			return
+		}
+		LoginCache.Delete(user.Email)
+		UserCache.Delete(user.ID)
+		user.VerifiedAt = &now
+	}
+	if rbac.NeedsApproval(user.Role) && !user.Approved {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "not_approved",
+		}).Warn("SSO sign in for an account that is not approved")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "This account is still not approved"})
+		return
+	}
+	if requireSecondFactor(ctx, db, &user) {
+		return
+	}
+	tokens, err := startSession(ctx, db, &user)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("JWT generation failed after SSO sign in")
+		ctx.Set("message", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create JWT"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"role":   user.Role,
+	}).Info("Signed in with SSO")
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// ssoSignup creates the VC account of an email the provider vouched for. The
+// account gets a random password, the provider is how it signs in.
+func ssoSignup(ctx *gin.Context, provider *oidc.Provider, identity oidc.Identity, auditLog *logrus.Entry) {
+	db := values.GetDB()
+	if !provider.Signup() || !provider.AllowsRole("vc") {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "user_not_found",
+		}).Warn("SSO sign in without an account")
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "There is no account for this email"})
+		return
+	}
+	password, err := newRefreshToken()
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("Failed to generate a password for the SSO account")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create the user"})
+		return
+	}
+	name := identity.Name
+	if name == "" {
+		name = identity.Email[:strings.LastIndex(identity.Email, "@")]
+	}
+	now := time.Now()
+	user := models.User{
+		Name:       name,
+		Email:      identity.Email,
+		Password:   password,
+		Role:       "vc",
+		Approved:   provider.AutoApproves(identity.Email),
+		VerifiedAt: &now,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_create_failed",
+			"error":  err.Error(),
+		}).Error("Failed to create the SSO account")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create the user"})
+		return
+	}
+	auditLog = auditLog.WithFields(logrus.Fields{
+		"event":    "sso_signup",
+		"user_id":  user.ID,
+		"approved": user.Approved,
+	})
+	if !user.Approved {
+		auditLog.WithField("status", "success").Info("VC account created with SSO, waiting for approval")
+		ctx.JSON(http.StatusCreated, gin.H{"message": "Your account is submitted for approval"})
+		return
+	}
+	if requireSecondFactor(ctx, db, &user) {
+		return
+	}
+	tokens, err := startSession(ctx, db, &user)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("JWT generation failed after SSO signup")
+		ctx.Set("message", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create JWT"})
+		return
+	}
+	auditLog.WithField("status", "success").Info("VC account created with SSO and approved by domain")
+	ctx.JSON(http.StatusOK, tokens)
+}
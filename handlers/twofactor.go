@@ -0,0 +1,591 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/rbac"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	challengeExpiry      = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+type challengeResponse struct {
+	ChallengeToken string `json:"challenge_token" example:"4f1c2a..."`
+	ExpiresAt      int64  `json:"expires_at" example:"1735689600"`
+	SetupRequired  bool   `json:"setup_required" example:"false"`
+	TOTPURL        string `json:"totp_url,omitempty" example:"otpauth://totp/V-NEST:john@example.com?secret=...&issuer=V-NEST&period=60&digits=8"`
+}
+
+type challengeRequest struct {
+	ChallengeToken string `json:"challenge_token" example:"4f1c2a..." binding:"required"`
+	Code           string `json:"code" example:"12345678" binding:"required"`
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code" example:"12345678" binding:"required"`
+}
+
+type twoFactorSetupResponse struct {
+	Enabled  bool   `json:"enabled" example:"false"`
+	Required bool   `json:"required" example:"true"`
+	TOTPURL  string `json:"totp_url,omitempty" example:"otpauth://totp/V-NEST:john@example.com?secret=...&issuer=V-NEST&period=60&digits=8"`
+	QRCode   string `json:"qr_code,omitempty" example:"iVBORw0KGgo..."`
+}
+
+type twoFactorPolicyModel struct {
+	Role      string     `json:"role" example:"vc"`
+	Required  bool       `json:"required" example:"true"`
+	UpdatedBy uint       `json:"updated_by,omitempty" example:"1"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+type twoFactorPolicyRequest struct {
+	Required *bool `json:"required" example:"true" binding:"required"`
+}
+
+func currentClaims(ctx *gin.Context) (*Claims, bool) {
+	claimsVal, exists := ctx.Get("claims")
+	if !exists {
+		return nil, false
+	}
+	claims, ok := claimsVal.(*Claims)
+	return claims, ok
+}
+
+func normalizeCode(code string) string {
+	return strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+}
+
+// requireSecondFactor answers a login that passed the password check with a
+// challenge when the user enabled 2FA or their role requires it. It reports
+// whether a response was written, in which case no tokens must be issued.
+func requireSecondFactor(ctx *gin.Context, db *gorm.DB, user *models.User) bool {
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":      ctx.ClientIP(),
+		"type":    "audit",
+		"event":   "login_challenge",
+		"user_id": user.ID,
+		"email":   user.Email,
+	})
+	required, err := models.TwoFactorRequired(db, user.Role)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "policy_lookup_failed",
+			"error":  err.Error(),
+		}).Error("Failed to read the two factor policy")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return true
+	}
+	if !user.TwoFactor && !required {
+		return false
+	}
+	random := make([]byte, 20)
+	if _, err := rand.Read(random); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("Failed to generate login challenge")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return true
+	}
+	token := hex.EncodeToString(random)
+	challenge := models.LoginChallenge{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		Setup:     !user.TwoFactor,
+		ExpiresAt: time.Now().Add(challengeExpiry),
+	}
+	if err := db.Create(&challenge).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_create_failed",
+			"error":  err.Error(),
+		}).Error("Failed to store login challenge")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return true
+	}
+	LoginCache.Delete(user.Email)
+	response := challengeResponse{
+		ChallengeToken: token,
+		ExpiresAt:      challenge.ExpiresAt.Unix(),
+		SetupRequired:  challenge.Setup,
+	}
+	if challenge.Setup {
+		response.TOTPURL, _ = user.TOTPUrl()
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"setup":  challenge.Setup,
+	}).Info("Password accepted, waiting for second factor")
+	ctx.JSON(http.StatusAccepted, response)
+	return true
+}
+
+// VerifyTwoFactor godoc
+// @Summary      Complete a two factor login
+// @Description  Exchanges the challenge token returned by a login plus an 8-digit TOTP or an unused backup code for an access token and a refresh token. When the challenge asks for setup only a TOTP from the newly scanned authenticator is accepted, and 2FA is turned on once it checks out. A backup code works once. A challenge is dropped after 5 wrong codes.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      challengeRequest  true  "Challenge and code"
+// @Success      200      {object}  successResponse
+// @Failure      400      {object}  failedResponse
+// @Failure      401      {object}  failedResponse
+// @Failure      429      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /auth/2fa/verify [post]
+func VerifyTwoFactor(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "login_second_factor",
+	})
+	var input challengeRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid second factor input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	// every guess takes an attempt before the code is checked, so concurrent
+	// guesses cannot get past the limit
+	var claimed []models.LoginChallenge
+	err := db.Model(&claimed).Clauses(clause.Returning{}).
+		Where("token_hash = ? AND expires_at > ? AND attempts < ?", hashToken(input.ChallengeToken), time.Now(), maxChallengeAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  err.Error(),
+		}).Error("Failed to claim login challenge")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check code"})
+		return
+	}
+	if len(claimed) != 1 {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_or_expired_challenge",
+		}).Warn("Unknown login challenge")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	challenge := claimed[0]
+	auditLog = auditLog.WithField("user_id", challenge.UserID)
+	var user models.User
+	if err := db.First(&user, challenge.UserID).Error; err != nil {
+		db.Delete(&challenge)
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "user_not_found",
+		}).Warn("Login challenge for a deleted user")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	auditLog = auditLog.WithField("email", user.Email)
+	if throttled(ctx, "login_second_factor", user.Email) {
+		return
+	}
+	code := normalizeCode(input.Code)
+	method := "totp"
+	valid := false
+	if len(code) == models.TOTPDigits.Length() {
+		valid = user.VerifyTOTP(code)
+	} else if !challenge.Setup {
+		method = "backup_code"
+		var err error
+		if valid, err = models.ConsumeBackupCode(db, user.ID, code); err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "db_update_failed",
+				"error":  err.Error(),
+			}).Error("Failed to check backup code")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check code"})
+			return
+		}
+	}
+	if !valid {
+		if challenge.Attempts >= maxChallengeAttempts {
+			db.Delete(&challenge)
+		}
+		auditLog.WithFields(logrus.Fields{
+			"status":   "failure",
+			"reason":   "invalid_" + method,
+			"attempts": challenge.Attempts,
+		}).Warn("Wrong second factor")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	// a challenge signs in once, also when the right code is sent twice
+	result := db.Delete(&challenge)
+	if result.Error != nil || result.RowsAffected != 1 {
+		reason := "challenge_already_used"
+		if result.Error != nil {
+			reason = "db_delete_failed"
+		}
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": reason,
+		}).Warn("Login challenge could not be claimed")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	if challenge.Setup {
+		if err := db.Model(&user).Update("two_factor", true).Error; err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "db_update_failed",
+				"error":  err.Error(),
+			}).Error("Failed to enable two factor during login")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two factor"})
+			return
+		}
+		UserCache.Delete(user.ID)
+	}
+	tokens, err := startSession(ctx, db, &user)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "token_generation_failed",
+			"error":  err.Error(),
+		}).Error("JWT generation failed after second factor")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create JWT"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status": "success",
+		"method": method,
+		"setup":  challenge.Setup,
+	}).Info("Second factor accepted, logged in")
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// TwoFactorSetup godoc
+// @Summary      Start two factor setup
+// @Description  Returns the authenticator link and a base64 PNG QR code for the current user while 2FA is still off. Scan it, then confirm with a code at /auth/2fa/enable.
+// @Tags         auth
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  twoFactorSetupResponse
+// @Failure      401  {object}  failedResponse
+// @Failure      500  {object}  failedResponse
+// @Router       /auth/2fa/setup [get]
+func TwoFactorSetup(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "two_factor_setup",
+	})
+	claims, ok := currentClaims(ctx)
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_claims",
+		}).Warn("Two factor setup without valid claims")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	auditLog = auditLog.WithField("user_id", claims.ID)
+	var user models.User
+	if err := db.First(&user, claims.ID).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_fetch_failed",
+			"error":  err.Error(),
+		}).Error("Failed to fetch user for two factor setup")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	required, err := models.TwoFactorRequired(db, user.Role)
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "policy_lookup_failed",
+			"error":  err.Error(),
+		}).Error("Failed to read the two factor policy")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read two factor policy"})
+		return
+	}
+	response := twoFactorSetupResponse{Enabled: user.TwoFactor, Required: required}
+	// once enabled the secret is not handed out again, a stolen access token must not be enough to copy it
+	if !user.TwoFactor {
+		totpURL, _ := user.TOTPUrl()
+		png, err := qrcode.Encode(totpURL, qrcode.Medium, 256)
+		if err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "qrcode_failed",
+				"error":  err.Error(),
+			}).Error("Failed to generate QR code")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate QR code"})
+			return
+		}
+		response.TOTPURL = totpURL
+		response.QRCode = base64.StdEncoding.EncodeToString(png)
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":  "success",
+		"enabled": user.TwoFactor,
+	}).Info("Two factor setup fetched")
+	ctx.JSON(http.StatusOK, response)
+}
+
+// EnableTwoFactor godoc
+// @Summary      Turn on two factor login
+// @Description  Confirms the authenticator with a current 8-digit code and turns on 2FA for the current user. Later logins return a challenge instead of tokens.
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      totpCodeRequest  true  "Code from the authenticator"
+// @Success      200      {object}  map[string]string
+// @Failure      400      {object}  failedResponse
+// @Failure      401      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /auth/2fa/enable [post]
+func EnableTwoFactor(ctx *gin.Context) {
+	setTwoFactor(ctx, true)
+}
+
+// DisableTwoFactor godoc
+// @Summary      Turn off two factor login
+// @Description  Turns off 2FA for the current user after checking a current 8-digit code. Not allowed when 2FA is required for the user's role.
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      totpCodeRequest  true  "Code from the authenticator"
+// @Success      200      {object}  map[string]string
+// @Failure      400      {object}  failedResponse
+// @Failure      401      {object}  failedResponse
+// @Failure      403      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /auth/2fa/disable [post]
+func DisableTwoFactor(ctx *gin.Context) {
+	setTwoFactor(ctx, false)
+}
+
+func setTwoFactor(ctx *gin.Context, enable bool) {
+	db := values.GetDB()
+	event := "two_factor_disable"
+	if enable {
+		event = "two_factor_enable"
+	}
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": event,
+	})
+	claims, ok := currentClaims(ctx)
+	if !ok {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_claims",
+		}).Warn("Two factor change without valid claims")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	auditLog = auditLog.WithField("user_id", claims.ID)
+	var input totpCodeRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid two factor input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	var user models.User
+	if err := db.First(&user, claims.ID).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_fetch_failed",
+			"error":  err.Error(),
+		}).Error("Failed to fetch user for two factor change")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	if !enable {
+		required, err := models.TwoFactorRequired(db, user.Role)
+		if err != nil {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "policy_lookup_failed",
+				"error":  err.Error(),
+			}).Error("Failed to read the two factor policy")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read two factor policy"})
+			return
+		}
+		if required {
+			auditLog.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "required_by_policy",
+			}).Warn("Tried to turn off required two factor")
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Two factor login is required for your role"})
+			return
+		}
+	}
+	if !user.VerifyTOTP(normalizeCode(input.Code)) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_totp",
+		}).Warn("Wrong code for two factor change")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	if err := db.Model(&user).Update("two_factor", enable).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  err.Error(),
+		}).Error("Failed to change two factor")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change two factor"})
+		return
+	}
+	UserCache.Delete(user.ID)
+	LoginCache.Delete(user.Email)
+	auditLog.WithField("status", "success").Info("Two factor changed")
+	if enable {
+		ctx.JSON(http.StatusOK, gin.H{"message": "Two factor login enabled"})
+	} else {
+		ctx.JSON(http.StatusOK, gin.H{"message": "Two factor login disabled"})
+	}
+}
+
+// GetTwoFactorPolicies godoc
+// @Summary      List two factor policies
+// @Description  Returns, for every role, whether accounts of that role must use two factor login
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Success      200  {array}   twoFactorPolicyModel
+// @Failure      500  {object}  failedResponse
+// @Router       /manage/2fa [get]
+func GetTwoFactorPolicies(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "get_two_factor_policies",
+	})
+	var policies []models.TwoFactorPolicy
+	if err := db.Find(&policies).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error("Failed to get two factor policies")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two factor policies"})
+		return
+	}
+	byRole := make(map[string]models.TwoFactorPolicy, len(policies))
+	for _, p := range policies {
+		byRole[p.Role] = p
+	}
+	roles := rbac.SignInRoles()
+	result := make([]twoFactorPolicyModel, 0, len(roles))
+	for _, role := range roles {
+		entry := twoFactorPolicyModel{Role: role}
+		if p, ok := byRole[role]; ok {
+			entry.Required = p.Required
+			entry.UpdatedBy = p.UpdatedBy
+			entry.UpdatedAt = &p.UpdatedAt
+		}
+		result = append(result, entry)
+	}
+	auditLog.WithField("status", "success").Info("Fetched two factor policies")
+	ctx.JSON(http.StatusOK, result)
+}
+
+// SetTwoFactorPolicy godoc
+// @Summary      Require two factor login for a role
+// @Description  Makes two factor login mandatory (or optional again) for every account of a role. Accounts that have not enrolled yet are walked through setup at their next login.
+// @Security     BearerAuth
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        role     path      string                  true  "Role"  Enums(user, vc, moderator, admin)
+// @Param        request  body      twoFactorPolicyRequest  true  "Policy"
+// @Success      200      {object}  twoFactorPolicyModel
+// @Failure      400      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /manage/2fa/{role} [put]
+func SetTwoFactorPolicy(ctx *gin.Context) {
+	db := values.GetDB()
+	role := ctx.Param("role")
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "set_two_factor_policy",
+		"role":  role,
+	})
+	claims, ok := currentClaims(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	auditLog = auditLog.WithField("user_id", claims.ID)
+	if !slices.Contains(rbac.SignInRoles(), role) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_role",
+		}).Warn("Two factor policy for unknown role")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	var input twoFactorPolicyRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid two factor policy input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	policy := models.TwoFactorPolicy{
+		Role:      role,
+		Required:  *input.Required,
+		UpdatedBy: claims.ID,
+	}
+	if err := db.Save(&policy).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  err.Error(),
+		}).Error("Failed to save two factor policy")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save two factor policy"})
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":   "success",
+		"required": policy.Required,
+	}).Info("Two factor policy updated")
+	ctx.JSON(http.StatusOK, twoFactorPolicyModel{
+		Role:      policy.Role,
+		Required:  policy.Required,
+		UpdatedBy: policy.UpdatedBy,
+		UpdatedAt: &policy.UpdatedAt,
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/vnestcc/dashboard/models"
 	"github.com/vnestcc/dashboard/utils"
 	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
 )
 
 type editUserRequest struct {
@@ -142,7 +143,16 @@ func DeleteUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 		return
 	}
-	if err := db.Delete(&models.User{}, claims.ID).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := models.RevokeUserSessions(tx, claims.ID); err != nil {
+			return err
+		}
+		if err := models.HandOverFounder(tx, claims.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, claims.ID).Error
+	})
+	if err != nil {
 		ctx.Set("message", err.Error())
 		auditLog.WithFields(logrus.Fields{
 			"event":   "delete_user_attempt",
@@ -325,70 +335,3 @@ func UserTOTP(ctx *gin.Context) {
 	ctx.Header("Content-Type", "image/png")
 	ctx.Writer.Write(png)
 }
-
-// UserBackupCode godoc
-// @Summary      Get TOTP Backup Code
-// @Description  Returns the TOTP backup code for the authenticated user
-// @Tags         user
-// @Security     BearerAuth
-// @Produce      json
-// @Success      200  {object}  map[string]string
-// @Failure      401  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
-// @Router       /users/backup-code [get]
-// NOTE: testing done
-func UserBackupCode(ctx *gin.Context) {
-	var db = values.GetDB()
-	claimsVal, exists := ctx.Get("claims")
-	auditLog := utils.Logger.WithFields(logrus.Fields{
-		"ip":   ctx.ClientIP(),
-		"type": "audit",
-	})
-	if !exists {
-		auditLog.WithFields(logrus.Fields{
-			"event":  "user_backup_code_attempt",
-			"status": "failure",
-			"reason": "no_claims",
-		}).Warn("Unauthorized backup code attempt")
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-	claims, ok := claimsVal.(*Claims)
-	if !ok {
-		auditLog.WithFields(logrus.Fields{
-			"event":  "user_backup_code_attempt",
-			"status": "failure",
-			"reason": "invalid_claims",
-		}).Warn("Invalid token claims during backup code")
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid claims format"})
-		return
-	}
-	var user models.User
-	if val, ok := UserCache.Get(claims.ID); ok {
-		ctx.Set("message", fmt.Sprintf("Loaded User %d from cache", claims.ID))
-		user = val
-	} else {
-		if err := db.First(&user, claims.ID).Error; err != nil {
-			ctx.Set("message", err.Error())
-			auditLog.WithFields(logrus.Fields{
-				"event":   "user_backup_code_attempt",
-				"status":  "failure",
-				"user_id": claims.ID,
-				"reason":  "db_fetch_failed",
-				"error":   err.Error(),
-			}).Error("Failed to fetch user for backup code")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
-			return
-		} else {
-			ctx.Set("message", fmt.Sprintf("Added User %d to cache", claims.ID))
-			UserCache.Set(claims.ID, user)
-		}
-	}
-	auditLog.WithFields(logrus.Fields{
-		"event":   "user_backup_code_attempt",
-		"status":  "success",
-		"user_id": user.ID,
-		"email":   user.Email,
-	}).Info("Fetched backup code successfully")
-	ctx.JSON(http.StatusOK, gin.H{"backup_code": user.BackupCode})
-}
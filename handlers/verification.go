@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/mailer"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/utils"
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+const (
+	verificationExpiry = 24 * time.Hour
+	// resendCooldown keeps the resend endpoint from being used to flood an inbox
+	resendCooldown = time.Minute
+)
+
+var errResendTooSoon = errors.New("a verification link was sent moments ago")
+
+type verifyEmailRequest struct {
+	Token string `json:"token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" binding:"required"`
+}
+
+type resendVerificationRequest struct {
+	Email string `json:"email" example:"example@vnest.org" binding:"required,email"`
+}
+
+// sendVerificationMail replaces the open verification link of the user with a
+// new one and queues it.
+func sendVerificationMail(ctx *gin.Context, db *gorm.DB, user *models.User) error {
+	token, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var last models.EmailVerification
+		err := tx.Where("user_id = ?", user.ID).First(&last).Error
+		if err == nil && now.Sub(last.CreatedAt) < resendCooldown {
+			return errResendTooSoon
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.EmailVerification{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailVerification{
+			UserID:    user.ID,
+			TokenHash: hashToken(token),
+			ExpiresAt: now.Add(verificationExpiry),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	mail := values.GetMailer()
+	return mail.Enqueue(ctx.Request.Context(), user.Email, mailer.TemplateVerifyEmail, mailer.VerifyEmailData{
+		Name:      user.Name,
+		Link:      mail.Link("/verify-email?token=" + token),
+		ExpiresIn: int(verificationExpiry / time.Hour),
+	})
+}
+
+// requireVerifiedEmail stops a sign in with an address that was never
+// confirmed. It reports whether a response was written.
+func requireVerifiedEmail(ctx *gin.Context, auditLog *logrus.Entry, event string, user *models.User) bool {
+	if user.VerifiedAt != nil {
+		return false
+	}
+	auditLog.WithFields(logrus.Fields{
+		"event":   event,
+		"status":  "failure",
+		"reason":  "email_not_verified",
+		"user_id": user.ID,
+		"email":   user.Email,
+		"ip":      ctx.ClientIP(),
+	}).Warn("Login failed - email not verified")
+	ctx.JSON(http.StatusForbidden, gin.H{"error": "Please confirm your email address first"})
+	return true
+}
+
+// VerifyEmail godoc
+// @Summary      Confirm an email address
+// @Description  Marks the address of the account as verified using the token from the emailed link. The link works once.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      verifyEmailRequest  true  "Verification token"
+// @Success      200      {object}  map[string]string
+// @Failure      400      {object}  failedResponse
+// @Failure      401      {object}  failedResponse
+// @Failure      500      {object}  failedResponse
+// @Router       /auth/verify-email [post]
+func VerifyEmail(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "verify_email",
+	})
+	var input verifyEmailRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid email verification input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var verification models.EmailVerification
+		if err := tx.Where("token_hash = ? AND expires_at > ?", hashToken(input.Token), time.Now()).First(&verification).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&verification).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&user, verification.UserID).Error; err != nil {
+			return err
+		}
+		if user.VerifiedAt != nil {
+			return nil
+		}
+		now := time.Now()
+		user.VerifiedAt = &now
+		return tx.Model(&user).Update("verified_at", now).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_or_expired_token",
+		}).Warn("Email verification with an unknown or expired token")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_update_failed",
+			"error":  err.Error(),
+		}).Error("Failed to verify email")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify the email"})
+		return
+	}
+	LoginCache.Delete(user.Email)
+	UserCache.Delete(user.ID)
+	auditLog.WithFields(logrus.Fields{
+		"status":  "success",
+		"user_id": user.ID,
+		"email":   user.Email,
+	}).Info("Email verified")
+	ctx.JSON(http.StatusOK, gin.H{"message": "Your email address is confirmed, you can sign in now"})
+}
+
+// ResendVerification godoc
+// @Summary      Resend the email verification link
+// @Description  Sends a new verification link to an account that is not verified yet, the previous link stops working. The response is the same whether or not the account exists.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      resendVerificationRequest  true  "Account email"
+// @Success      200      {object}  map[string]string
+// @Failure      400      {object}  failedResponse
+// @Router       /auth/verify-email/resend [post]
+func ResendVerification(ctx *gin.Context) {
+	db := values.GetDB()
+	auditLog := utils.Logger.WithFields(logrus.Fields{
+		"ip":    ctx.ClientIP(),
+		"type":  "audit",
+		"event": "resend_verification",
+	})
+	var input resendVerificationRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "invalid_json",
+		}).Warn("Invalid resend verification input")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	response := gin.H{"message": "If the account is waiting for confirmation, a new link was sent to it"}
+	var user models.User
+	email := strings.TrimSpace(input.Email)
+	if err := db.Where("email = ? AND verified_at IS NULL", email).First(&user).Error; err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "user_not_found",
+			"email":  email,
+		}).Warn("Verification resend for an unknown or verified account")
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+	if err := sendVerificationMail(ctx, db, &user); err != nil {
+		reason := "mail_queue_failed"
+		if errors.Is(err, errResendTooSoon) {
+			reason = "too_soon"
+		}
+		auditLog.WithFields(logrus.Fields{
+			"status":  "failure",
+			"reason":  reason,
+			"user_id": user.ID,
+			"email":   user.Email,
+			"error":   err.Error(),
+		}).Warn("Verification link not resent")
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+	auditLog.WithFields(logrus.Fields{
+		"status":  "success",
+		"user_id": user.ID,
+		"email":   user.Email,
+	}).Info("Verification link resent")
+	ctx.JSON(http.StatusOK, response)
+}
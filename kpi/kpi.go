@@ -0,0 +1,138 @@
+// Package kpi derives quarterly KPIs from the raw figures founders submit and
+// compares them with the values they typed in themselves.
+package kpi
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/vnestcc/dashboard/models"
+)
+
+const (
+	UnitMonths  = "months"
+	UnitPercent = "percent"
+	UnitRatio   = "ratio"
+)
+
+// Snapshot is the latest reported version of each section for one quarter.
+// Sections that were never filled in are nil.
+type Snapshot struct {
+	Quarter   string
+	Year      uint
+	Finance   *models.FinancialHealth
+	Market    *models.MarketTraction
+	Economics *models.UnitEconomics
+}
+
+// Value is one derived KPI. Reported is what the founder entered for the same
+// field, if anything, and Mismatch is set when the two disagree.
+type Value struct {
+	Key      string   `json:"key" example:"cash_runway"`
+	Section  string   `json:"section" example:"finance"`
+	Unit     string   `json:"unit" example:"months"`
+	Computed float64  `json:"computed" example:"14.5"`
+	Reported *float64 `json:"reported" example:"18"`
+	Mismatch bool     `json:"mismatch" example:"true"`
+}
+
+// tolerance is how far a reported value may drift from the computed one
+// before it is flagged: an absolute floor plus 5% of the computed value.
+var tolerance = map[string]float64{
+	UnitMonths:  0.5,
+	UnitPercent: 0.5,
+	UnitRatio:   0.1,
+}
+
+const relativeTolerance = 0.05
+
+// PreviousQuarter returns the calendar quarter before the given one.
+func PreviousQuarter(quarter string, year uint) (string, uint, error) {
+	var n int
+	if _, err := fmt.Sscanf(quarter, "Q%d", &n); err != nil || n < 1 || n > 4 {
+		return "", 0, fmt.Errorf("invalid quarter %q", quarter)
+	}
+	if n == 1 {
+		return "Q4", year - 1, nil
+	}
+	return fmt.Sprintf("Q%d", n-1), year, nil
+}
+
+// Compute derives every KPI it has inputs for. previous is the snapshot of the
+// preceding calendar quarter and may be nil, in which case growth figures are
+// skipped.
+func Compute(current Snapshot, previous *Snapshot) []Value {
+	var values []Value
+	add := func(key, section, unit string, computed float64, reported models.Decimal) {
+		if math.IsNaN(computed) || math.IsInf(computed, 0) {
+			return
+		}
+		v := Value{Key: key, Section: section, Unit: unit, Computed: round(computed)}
+		if reported.Valid() {
+			r := reported.Float64()
+			v.Reported = &r
+			v.Mismatch = math.Abs(r-computed) > tolerance[unit]+relativeTolerance*math.Abs(computed)
+		}
+		values = append(values, v)
+	}
+
+	if f := current.Finance; f != nil {
+		if sameCurrency(f.CashBalance, f.BurnRate) && f.BurnRate.Amount.Float64() > 0 {
+			add("cash_runway", "finance", UnitMonths,
+				f.CashBalance.Amount.Float64()/f.BurnRate.Amount.Float64(), f.CashRunway.Decimal)
+		}
+		if previous != nil && previous.Finance != nil {
+			p := previous.Finance
+			if growth, ok := change(f.BurnRate, p.BurnRate); ok {
+				add("burn_rate_change", "finance", UnitPercent, growth, f.BurnRateChange.Decimal)
+			}
+			if growth, ok := change(f.QuarterlyRevenue, p.QuarterlyRevenue); ok {
+				add("revenue_growth", "finance", UnitPercent, growth, f.RevenueGrowth.Decimal)
+			}
+		}
+	}
+
+	if m := current.Market; m != nil && previous != nil && previous.Market != nil {
+		p := previous.Market
+		if m.TotalCustomers.Valid() && p.TotalCustomers.Valid() && p.TotalCustomers.Float64() != 0 {
+			add("customer_growth", "market", UnitPercent,
+				growth(m.TotalCustomers.Float64(), p.TotalCustomers.Float64()), m.CustomerGrowth.Decimal)
+		}
+		if m.MarketShare.Valid() && p.MarketShare.Valid() {
+			add("market_share_change", "market", UnitPercent,
+				m.MarketShare.Float64()-p.MarketShare.Float64(), m.MarketShareChange.Decimal)
+		}
+	}
+
+	if e := current.Economics; e != nil {
+		if sameCurrency(e.LTV, e.CAC) && e.CAC.Amount.Float64() != 0 {
+			add("ltv_ratio", "economics", UnitRatio, e.LTV.Amount.Float64()/e.CAC.Amount.Float64(), e.LTVRatio)
+		}
+		if previous != nil && previous.Economics != nil {
+			if growth, ok := change(e.CAC, previous.Economics.CAC); ok {
+				add("cac_change", "economics", UnitPercent, growth, e.CACChange.Decimal)
+			}
+		}
+	}
+	return values
+}
+
+func sameCurrency(a, b models.Money) bool {
+	return a.Valid() && b.Valid() && a.Currency == b.Currency
+}
+
+// change is the quarter over quarter growth of an amount in percent.
+func change(current, previous models.Money) (float64, bool) {
+	if !sameCurrency(current, previous) || previous.Amount.Float64() == 0 {
+		return 0, false
+	}
+	return growth(current.Amount.Float64(), previous.Amount.Float64()), true
+}
+
+func growth(current, previous float64) float64 {
+	return (current - previous) / math.Abs(previous) * 100
+}
+
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
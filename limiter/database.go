@@ -0,0 +1,88 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// authAttempt is the row behind an Entry in the database store.
+type authAttempt struct {
+	Key         string    `gorm:"primaryKey"`
+	Failures    int       `gorm:"not null;default:0"`
+	LastFailure time.Time `gorm:"not null;index"`
+	LockedUntil time.Time `gorm:"not null"`
+}
+
+func (a authAttempt) entry() Entry {
+	return Entry{Key: a.Key, Failures: a.Failures, LastFailure: a.LastFailure, LockedUntil: a.LockedUntil}
+}
+
+// DatabaseStore keeps the counters in postgres so that every server instance
+// sees the same attempts.
+type DatabaseStore struct {
+	db *gorm.DB
+}
+
+func NewDatabase(db *gorm.DB) (*DatabaseStore, error) {
+	if db == nil {
+		return nil, errors.New("the database limiter needs a database connection")
+	}
+	if err := db.AutoMigrate(&authAttempt{}); err != nil {
+		return nil, err
+	}
+	return &DatabaseStore{db: db}, nil
+}
+
+func (d *DatabaseStore) Get(ctx context.Context, key string) (Entry, error) {
+	var row authAttempt
+	err := d.db.WithContext(ctx).Where("key = ?", key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Entry{Key: key}, nil
+	}
+	return row.entry(), err
+}
+
+// Fail is a single upsert so that concurrent failures on several instances all get counted.
+func (d *DatabaseStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Entry, error) {
+	var row authAttempt
+	err := d.db.WithContext(ctx).Raw(`
+		INSERT INTO auth_attempts (key, failures, last_failure, locked_until)
+		VALUES (?, 1, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN auth_attempts.last_failure < ? THEN 1 ELSE auth_attempts.failures + 1 END,
+			last_failure = EXCLUDED.last_failure
+		RETURNING key, failures, last_failure, locked_until
+	`, key, now, time.Time{}, now.Add(-window)).Scan(&row).Error
+	return row.entry(), err
+}
+
+func (d *DatabaseStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return d.db.WithContext(ctx).Model(&authAttempt{}).
+		Where("key = ? AND locked_until < ?", key, until).
+		Update("locked_until", until).Error
+}
+
+func (d *DatabaseStore) Reset(ctx context.Context, key string) error {
+	return d.db.WithContext(ctx).Where("key = ?", key).Delete(&authAttempt{}).Error
+}
+
+func (d *DatabaseStore) Locked(ctx context.Context, now time.Time) ([]Entry, error) {
+	var rows []authAttempt
+	if err := d.db.WithContext(ctx).Where("locked_until > ?", now).Order("locked_until DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	locked := make([]Entry, 0, len(rows))
+	for _, row := range rows {
+		locked = append(locked, row.entry())
+	}
+	return locked, nil
+}
+
+func (d *DatabaseStore) Prune(ctx context.Context, before time.Time) error {
+	return d.db.WithContext(ctx).
+		Where("last_failure < ? AND locked_until < ?", before, time.Now()).
+		Delete(&authAttempt{}).Error
+}
@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// guardedEvents are the audit events of the sign in and password recovery
+// endpoints, the only ones whose failures count as attempts.
+var guardedEvents = map[string]bool{
+	"login_attempt":        true,
+	"vc_login":             true,
+	"admin_login":          true,
+	"forgot_password":      true,
+	"forgot_password_auth": true,
+	"login_second_factor":  true,
+}
+
+// countedReasons are the failures that mean a wrong guess.
+var countedReasons = map[string]bool{
+	"user_not_found":      true,
+	"invalid_password":    true,
+	"invalid_totp":        true,
+	"invalid_backup_code": true,
+}
+
+// signedIn are the events that end a successful sign in or recovery and clear
+// the account. A password accepted while a second factor is pending is not one
+// of them, or the password alone would reset the count of wrong codes.
+var signedIn = map[string]bool{
+	"login_attempt":                true,
+	"vc_login":                     true,
+	"admin_login":                  true,
+	"login_second_factor":          true,
+	"forgot_password_token_issued": true,
+}
+
+// Hook counts attempts from the audit events the auth handlers already log,
+// so the handlers only need to ask the limiter before checking credentials.
+type Hook struct {
+	limiter *Limiter
+}
+
+func NewHook(l *Limiter) *Hook {
+	return &Hook{limiter: l}
+}
+
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	if entry.Data["type"] != "audit" {
+		return nil
+	}
+	event, _ := entry.Data["event"].(string)
+	status, _ := entry.Data["status"].(string)
+	reason, _ := entry.Data["reason"].(string)
+	email, _ := entry.Data["email"].(string)
+	ip, _ := entry.Data["ip"].(string)
+	var err error
+	switch {
+	case status == "failure" && guardedEvents[event] && countedReasons[reason]:
+		var keys []string
+		if email != "" {
+			keys = append(keys, AccountKey(email))
+		}
+		if ip != "" {
+			keys = append(keys, IPKey(ip))
+		}
+		err = h.limiter.Fail(context.Background(), keys...)
+	case status == "success" && signedIn[event] && email != "":
+		err = h.limiter.Reset(context.Background(), AccountKey(email))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "limiter: failed to count %s: %v\n", event, err)
+	}
+	return nil
+}
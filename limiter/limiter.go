@@ -0,0 +1,185 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/vnestcc/dashboard/config"
+	"gorm.io/gorm"
+)
+
+// Entry is the failed attempt count of one key, an account or a client IP.
+type Entry struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Store keeps the counters. The memory store is enough for a single server,
+// the database store shares them between every instance.
+type Store interface {
+	// Get returns the entry of key, or a zero Entry when it has none.
+	Get(ctx context.Context, key string) (Entry, error)
+	// Fail counts a failure for key. Failures older than window are forgotten
+	// first, so the count starts over after a quiet period.
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Entry, error)
+	// Lock makes key wait until the given time. It never shortens a lock.
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+	// Locked lists the keys that are waiting at now.
+	Locked(ctx context.Context, now time.Time) ([]Entry, error)
+	// Prune drops keys whose last failure is older than before and that are not locked.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// Policy turns a failure count into a wait. The first Free failures cost
+// nothing, each one after doubles the wait from BaseDelay up to MaxDelay, and
+// from LockoutAfter failures on every failure locks the key for Lockout.
+type Policy struct {
+	Free         int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+// Delay is how long a key has to wait after its nth failure.
+func (p Policy) Delay(failures int) time.Duration {
+	if failures >= p.LockoutAfter {
+		return p.Lockout
+	}
+	if failures <= p.Free {
+		return 0
+	}
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(failures-p.Free-1))
+	if delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+var (
+	DefaultAccountPolicy = Policy{
+		Free:         3,
+		BaseDelay:    2 * time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockoutAfter: 10,
+		Lockout:      30 * time.Minute,
+		Window:       24 * time.Hour,
+	}
+	DefaultIPPolicy = Policy{
+		Free:         20,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockoutAfter: 100,
+		Lockout:      time.Hour,
+		Window:       time.Hour,
+	}
+)
+
+// Limiter tracks failed sign in attempts per account and per client IP.
+type Limiter struct {
+	store   Store
+	account Policy
+	ip      Policy
+}
+
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+func NewLimiter(store Store, account, ip Policy) *Limiter {
+	return &Limiter{store: store, account: account, ip: ip}
+}
+
+func New(cfg config.LimiterConfig, db *gorm.DB) (*Limiter, error) {
+	account := DefaultAccountPolicy
+	if cfg.MaxAttempts > 0 {
+		account.LockoutAfter = cfg.MaxAttempts
+		account.Free = min(account.Free, cfg.MaxAttempts-1)
+	}
+	if cfg.Lockout > 0 {
+		account.Lockout = time.Duration(cfg.Lockout) * time.Minute
+	}
+	switch cfg.Backend {
+	case "", "memory":
+		return NewLimiter(NewMemory(), account, DefaultIPPolicy), nil
+	case "database":
+		store, err := NewDatabase(db)
+		if err != nil {
+			return nil, err
+		}
+		return NewLimiter(store, account, DefaultIPPolicy), nil
+	default:
+		return nil, fmt.Errorf("unknown limiter backend %q", cfg.Backend)
+	}
+}
+
+func (l *Limiter) policy(key string) Policy {
+	if strings.HasPrefix(key, "ip:") {
+		return l.ip
+	}
+	return l.account
+}
+
+// Wait returns how long the caller has to wait before any of the keys may try
+// again, zero when none of them is locked.
+func (l *Limiter) Wait(ctx context.Context, keys ...string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		entry, err := l.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if left := entry.LockedUntil.Sub(now); left > wait {
+			wait = left
+		}
+	}
+	return wait, nil
+}
+
+// Fail counts a failed attempt against every key and locks the ones that ran
+// out of free attempts.
+func (l *Limiter) Fail(ctx context.Context, keys ...string) error {
+	now := time.Now()
+	for _, key := range keys {
+		policy := l.policy(key)
+		entry, err := l.store.Fail(ctx, key, now, policy.Window)
+		if err != nil {
+			return err
+		}
+		if delay := policy.Delay(entry.Failures); delay > 0 {
+			if err := l.store.Lock(ctx, key, now.Add(delay)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, key)
+}
+
+func (l *Limiter) Get(ctx context.Context, key string) (Entry, error) {
+	return l.store.Get(ctx, key)
+}
+
+func (l *Limiter) Locked(ctx context.Context) ([]Entry, error) {
+	return l.store.Locked(ctx, time.Now())
+}
+
+// Prune forgets keys that have been quiet for longer than the longest window.
+func (l *Limiter) Prune(ctx context.Context) error {
+	return l.store.Prune(ctx, time.Now().Add(-max(l.account.Window, l.ip.Window)))
+}
@@ -0,0 +1,89 @@
+package limiter
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+func NewMemory() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*Entry)}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entry, ok := m.entries[key]; ok {
+		return *entry, nil
+	}
+	return Entry{Key: key}, nil
+}
+
+func (m *MemoryStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &Entry{Key: key}
+		m.entries[key] = entry
+	}
+	if now.Sub(entry.LastFailure) > window {
+		entry.Failures = 0
+	}
+	entry.Failures++
+	entry.LastFailure = now
+	return *entry, nil
+}
+
+func (m *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &Entry{Key: key}
+		m.entries[key] = entry
+	}
+	if until.After(entry.LockedUntil) {
+		entry.LockedUntil = until
+	}
+	return nil
+}
+
+func (m *MemoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *MemoryStore) Locked(ctx context.Context, now time.Time) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	locked := []Entry{}
+	for _, entry := range m.entries {
+		if entry.LockedUntil.After(now) {
+			locked = append(locked, *entry)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool {
+		return locked[i].LockedUntil.After(locked[j].LockedUntil)
+	})
+	return locked, nil
+}
+
+func (m *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, entry := range m.entries {
+		if entry.LastFailure.Before(before) && entry.LockedUntil.Before(time.Now()) {
+			delete(m.entries, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/vnestcc/dashboard/config"
+	"gorm.io/gorm"
+)
+
+const (
+	TemplateResetPassword    = "reset_password"
+	TemplateVCApproved       = "vc_approved"
+	TemplateQuarterOpened    = "quarter_opened"
+	TemplateDeadlineReminder = "deadline_reminder"
+	TemplateModeratorInvite  = "moderator_invite"
+	TemplateVerifyEmail      = "verify_email"
+)
+
+var templateNames = []string{
+	TemplateResetPassword,
+	TemplateVCApproved,
+	TemplateQuarterOpened,
+	TemplateDeadlineReminder,
+	TemplateModeratorInvite,
+	TemplateVerifyEmail,
+}
+
+var ErrDisabled = errors.New("mailer is not set up")
+
+//go:embed templates
+var templateFS embed.FS
+
+type ResetPasswordData struct {
+	Name      string
+	Link      string
+	ExpiresIn int // minutes
+}
+
+type VCApprovedData struct {
+	Name string
+	Link string
+}
+
+type QuarterOpenedData struct {
+	Name     string
+	Company  string
+	Quarter  string
+	Year     uint
+	Deadline string // empty when the quarter has no deadline
+	Link     string
+}
+
+type DeadlineReminderData struct {
+	Name     string
+	Company  string
+	Quarter  string
+	Year     uint
+	Deadline string
+	Link     string
+}
+
+type ModeratorInviteData struct {
+	Link      string
+	ExpiresAt string
+}
+
+type VerifyEmailData struct {
+	Name      string
+	Link      string
+	ExpiresIn int // hours
+}
+
+// Message is one rendered email.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Transport delivers a message. SMTP is used when a host is configured,
+// otherwise messages are only logged.
+type Transport interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type templates struct {
+	text *texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// Mailer renders templates and queues the messages. Sending happens in Run, so
+// callers never wait on the mail server.
+type Mailer struct {
+	db        *gorm.DB
+	transport Transport
+	from      string
+	baseURL   string
+	templates templates
+	wake      chan struct{}
+}
+
+// New sets up the mailer. Without an SMTP host mails are only logged, which is
+// refused in production where users would never get their links.
+func New(cfg config.MailConfig, prod bool, db *gorm.DB) (*Mailer, error) {
+	if db == nil {
+		return nil, errors.New("the mail queue needs a database connection")
+	}
+	if prod && cfg.Host == "" {
+		return nil, errors.New("mail.host must be set in production")
+	}
+	parsed, err := parseTemplates()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(&queuedMail{}); err != nil {
+		return nil, err
+	}
+	var transport Transport = LogTransport{}
+	if cfg.Host != "" {
+		if transport, err = NewSMTP(cfg); err != nil {
+			return nil, err
+		}
+	}
+	from := cfg.From
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	return &Mailer{
+		db:        db,
+		transport: transport,
+		from:      from,
+		baseURL:   strings.TrimRight(cfg.BaseURL, "/"),
+		templates: parsed,
+		wake:      make(chan struct{}, 1),
+	}, nil
+}
+
+func parseTemplates() (templates, error) {
+	text, err := texttemplate.ParseFS(templateFS, "templates/*.txt")
+	if err != nil {
+		return templates{}, err
+	}
+	parsed := templates{text: text, html: make(map[string]*htmltemplate.Template)}
+	for _, name := range templateNames {
+		if text.Lookup(name+".txt") == nil || text.Lookup(name+".subject") == nil {
+			return templates{}, fmt.Errorf("missing text template or subject for %s", name)
+		}
+		html, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html")
+		if err != nil {
+			return templates{}, err
+		}
+		parsed.html[name] = html
+	}
+	return parsed, nil
+}
+
+// Link turns a path of the frontend into an absolute URL for emails.
+func (m *Mailer) Link(path string) string {
+	if m == nil {
+		return path
+	}
+	return m.baseURL + path
+}
+
+// Render builds the message for a template without queueing it.
+func (m *Mailer) Render(to, name string, data any) (Message, error) {
+	msg := Message{From: m.from, To: to}
+	var buf bytes.Buffer
+	if err := m.templates.text.ExecuteTemplate(&buf, name+".subject", data); err != nil {
+		return msg, err
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err := m.templates.text.ExecuteTemplate(&buf, name+".txt", data); err != nil {
+		return msg, err
+	}
+	msg.Text = buf.String()
+	buf.Reset()
+	html, ok := m.templates.html[name]
+	if !ok {
+		return msg, fmt.Errorf("unknown template %s", name)
+	}
+	if err := html.ExecuteTemplate(&buf, "layout", data); err != nil {
+		return msg, err
+	}
+	msg.HTML = buf.String()
+	return msg, nil
+}
+
+// Enqueue renders a template and stores the message in the queue. It only
+// fails when the message cannot be stored, delivery errors are retried later.
+func (m *Mailer) Enqueue(ctx context.Context, to, name string, data any) error {
+	if m == nil {
+		return ErrDisabled
+	}
+	msg, err := m.Render(to, name, data)
+	if err != nil {
+		return err
+	}
+	if err := m.db.WithContext(ctx).Create(newQueuedMail(name, msg)).Error; err != nil {
+		return err
+	}
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package mailer
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	pollInterval = 15 * time.Second
+	batchSize    = 20
+	maxAttempts  = 8
+	// lease keeps a claimed message away from other instances while it is being sent
+	lease = 5 * time.Minute
+)
+
+// queuedMail is a message waiting in the mail_queue table. Messages that ran
+// out of attempts keep their last error so they can be looked at.
+type queuedMail struct {
+	ID            uint `gorm:"primaryKey"`
+	Template      string
+	From          string    `gorm:"not null"`
+	To            string    `gorm:"not null"`
+	Subject       string    `gorm:"not null"`
+	Text          string    `gorm:"not null"`
+	HTML          string    `gorm:"not null"`
+	Attempts      int       `gorm:"not null;default:0"`
+	NextAttemptAt time.Time `gorm:"not null;index"`
+	LastError     string
+	SentAt        *time.Time
+	FailedAt      *time.Time
+	CreatedAt     time.Time
+}
+
+func (queuedMail) TableName() string {
+	return "mail_queue"
+}
+
+func newQueuedMail(template string, msg Message) *queuedMail {
+	return &queuedMail{
+		Template:      template,
+		From:          msg.From,
+		To:            msg.To,
+		Subject:       msg.Subject,
+		Text:          msg.Text,
+		HTML:          msg.HTML,
+		NextAttemptAt: time.Now(),
+	}
+}
+
+func (q queuedMail) message() Message {
+	return Message{From: q.From, To: q.To, Subject: q.Subject, Text: q.Text, HTML: q.HTML}
+}
+
+// retryDelay doubles from a minute up to six hours, so a message is retried for
+// about a day before it is given up.
+func retryDelay(attempts int) time.Duration {
+	return min(time.Minute<<(attempts-1), 6*time.Hour)
+}
+
+// Run sends queued messages until ctx is done. Several instances can run it at
+// the same time, each message is claimed by one of them.
+func (m *Mailer) Run(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			sent, err := m.Process(ctx)
+			if err != nil {
+				logrus.Errorf("mail queue: %v", err)
+			}
+			if err != nil || sent < batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+	}
+}
+
+// Process sends one batch of due messages and returns how many it picked up.
+func (m *Mailer) Process(ctx context.Context) (int, error) {
+	now := time.Now()
+	var batch []queuedMail
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+			Order("id").Limit(batchSize).Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		ids := make([]uint, 0, len(batch))
+		for _, mail := range batch {
+			ids = append(ids, mail.ID)
+		}
+		return tx.Model(&queuedMail{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, mail := range batch {
+		m.deliver(ctx, mail)
+	}
+	return len(batch), nil
+}
+
+func (m *Mailer) deliver(ctx context.Context, mail queuedMail) {
+	log := logrus.WithFields(logrus.Fields{
+		"mail_id":  mail.ID,
+		"template": mail.Template,
+		"to":       mail.To,
+	})
+	attempts := mail.Attempts + 1
+	updates := map[string]any{"attempts": attempts}
+	sendErr := m.transport.Send(ctx, mail.message())
+	now := time.Now()
+	switch {
+	case sendErr == nil:
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+	case attempts >= maxAttempts:
+		updates["failed_at"] = now
+		updates["last_error"] = sendErr.Error()
+		log.WithField("error", sendErr.Error()).Error("Giving up on mail")
+	default:
+		updates["next_attempt_at"] = now.Add(retryDelay(attempts))
+		updates["last_error"] = sendErr.Error()
+		log.WithFields(logrus.Fields{
+			"error":    sendErr.Error(),
+			"attempts": attempts,
+		}).Warn("Mail delivery failed, will retry")
+	}
+	if err := m.db.Model(&queuedMail{}).Where("id = ?", mail.ID).Updates(updates).Error; err != nil {
+		log.WithField("error", err.Error()).Error("Failed to update mail queue")
+	}
+}
+
+// Prune drops messages that were sent or given up before the given time.
+func (m *Mailer) Prune(ctx context.Context, before time.Time) error {
+	if m == nil {
+		return nil
+	}
+	return m.db.WithContext(ctx).
+		Where("sent_at < ? OR failed_at < ?", before, before).
+		Delete(&queuedMail{}).Error
+}
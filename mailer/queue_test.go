@@ -0,0 +1,220 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vnestcc/dashboard/config"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeTransport fails with err, or keeps the messages when err is nil.
+type fakeTransport struct {
+	mu   sync.Mutex
+	err  error
+	sent []Message
+	// onSend runs before a message is handled, while it is leased
+	onSend func(Message)
+}
+
+func (f *fakeTransport) Send(ctx context.Context, msg Message) error {
+	if f.onSend != nil {
+		f.onSend(msg)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// dryRunDB builds statements without a database and hands every update of the
+// mail queue to record.
+func dryRunDB(t *testing.T, record func(map[string]any)) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Callback().Update().After("gorm:update").Register("test:record", func(tx *gorm.DB) {
+		if updates, ok := tx.Statement.Dest.(map[string]any); ok {
+			record(updates)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDeliver(t *testing.T) {
+	sendErr := errors.New("550 mailbox unavailable")
+	tests := []struct {
+		name      string
+		attempts  int
+		err       error
+		wantSent  bool
+		wantRetry time.Duration
+		wantGone  bool
+	}{
+		{name: "sent", attempts: 0, wantSent: true},
+		{name: "sent after retries", attempts: 3, wantSent: true},
+		{name: "first failure", attempts: 0, err: sendErr, wantRetry: time.Minute},
+		{name: "fourth failure", attempts: 3, err: sendErr, wantRetry: 8 * time.Minute},
+		{name: "last failure", attempts: maxAttempts - 1, err: sendErr, wantGone: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updates map[string]any
+			transport := &fakeTransport{err: tt.err}
+			m := &Mailer{db: dryRunDB(t, func(u map[string]any) { updates = u }), transport: transport}
+			mail := queuedMail{ID: 1, To: "jane@example.com", Subject: "Hi", Attempts: tt.attempts}
+
+			before := time.Now()
+			m.deliver(context.Background(), mail)
+
+			if updates == nil {
+				t.Fatal("deliver() did not update the queue")
+			}
+			if updates["attempts"] != tt.attempts+1 {
+				t.Errorf("attempts = %v, want %d", updates["attempts"], tt.attempts+1)
+			}
+			_, sent := updates["sent_at"]
+			_, gone := updates["failed_at"]
+			if sent != tt.wantSent || gone != tt.wantGone {
+				t.Errorf("sent_at set = %t, failed_at set = %t, want %t, %t", sent, gone, tt.wantSent, tt.wantGone)
+			}
+			wantError := ""
+			if tt.err != nil {
+				wantError = tt.err.Error()
+			}
+			if updates["last_error"] != wantError {
+				t.Errorf("last_error = %q, want %q", updates["last_error"], wantError)
+			}
+			next, retried := updates["next_attempt_at"].(time.Time)
+			if retried != (tt.wantRetry != 0) {
+				t.Fatalf("next_attempt_at = %v, want a retry after %s", updates["next_attempt_at"], tt.wantRetry)
+			}
+			if retried && (next.Before(before.Add(tt.wantRetry)) || next.After(time.Now().Add(tt.wantRetry))) {
+				t.Errorf("next_attempt_at is %s from now, want %s", next.Sub(before), tt.wantRetry)
+			}
+		})
+	}
+}
+
+// testDB is a transaction on the database in TEST_DATABASE_URL that is rolled
+// back after the test, with an empty mail queue.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	if err := tx.AutoMigrate(&queuedMail{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Where("1 = 1").Delete(&queuedMail{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestProcess(t *testing.T) {
+	db := testDB(t)
+	m, err := New(config.MailConfig{From: "no-reply@example.com"}, false, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &fakeTransport{err: errors.New("connection refused")}
+	m.transport = transport
+	ctx := context.Background()
+	load := func(id uint) queuedMail {
+		t.Helper()
+		var mail queuedMail
+		if err := db.First(&mail, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		return mail
+	}
+	process := func(want int) {
+		t.Helper()
+		got, err := m.Process(ctx)
+		if err != nil {
+			t.Fatalf("Process() failed: %v", err)
+		}
+		if got != want {
+			t.Fatalf("Process() picked up %d messages, want %d", got, want)
+		}
+	}
+
+	if err := m.Enqueue(ctx, "jane@example.com", TemplateVCApproved, VCApprovedData{Name: "Jane", Link: m.Link("/login")}); err != nil {
+		t.Fatalf("Enqueue() failed: %v", err)
+	}
+	var queued queuedMail
+	if err := db.First(&queued).Error; err != nil {
+		t.Fatal(err)
+	}
+	// a message being sent is leased so another instance does not send it too
+	transport.onSend = func(Message) {
+		if leased := load(queued.ID); time.Until(leased.NextAttemptAt) < lease-time.Minute {
+			t.Errorf("the message is only held until %s while being sent", leased.NextAttemptAt)
+		}
+	}
+
+	process(1)
+	failed := load(queued.ID)
+	if failed.Attempts != 1 || failed.LastError != "connection refused" || failed.SentAt != nil || failed.FailedAt != nil {
+		t.Fatalf("after a failed send the message is %+v, want a retry", failed)
+	}
+	if delay := time.Until(failed.NextAttemptAt); delay <= 0 || delay > retryDelay(1) {
+		t.Errorf("the retry is due in %s, want within %s", delay, retryDelay(1))
+	}
+	process(0)
+
+	// the last attempt fails too, the message is given up and not picked up again
+	db.Model(&failed).Updates(map[string]any{"attempts": maxAttempts - 1, "next_attempt_at": time.Now().Add(-time.Second)})
+	process(1)
+	gone := load(queued.ID)
+	if gone.Attempts != maxAttempts || gone.FailedAt == nil || gone.SentAt != nil || gone.LastError == "" {
+		t.Fatalf("after the last attempt the message is %+v, want it given up", gone)
+	}
+	db.Model(&gone).Update("next_attempt_at", time.Now().Add(-time.Second))
+	process(0)
+
+	transport.err = nil
+	transport.onSend = nil
+	if err := m.Enqueue(ctx, "john@example.com", TemplateVCApproved, VCApprovedData{Name: "John", Link: m.Link("/login")}); err != nil {
+		t.Fatalf("Enqueue() failed: %v", err)
+	}
+	process(1)
+	if len(transport.sent) != 1 || transport.sent[0].To != "john@example.com" || transport.sent[0].From != "no-reply@example.com" {
+		t.Fatalf("sent %+v, want one message to john@example.com", transport.sent)
+	}
+	var sent queuedMail
+	if err := db.Where(&queuedMail{To: "john@example.com"}).First(&sent).Error; err != nil {
+		t.Fatal(err)
+	}
+	if sent.SentAt == nil || sent.Attempts != 1 || sent.LastError != "" {
+		t.Errorf("after sending the message is %+v, want it marked sent", sent)
+	}
+	process(0)
+}
@@ -0,0 +1,193 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/config"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// SMTPTransport sends mail through an SMTP server. Security is "starttls"
+// (the default), "tls" for implicit TLS, usually on port 465, or "none" for
+// local stand-ins such as mailpit.
+type SMTPTransport struct {
+	host     string
+	port     int
+	username string
+	password string
+	security string
+}
+
+func NewSMTP(cfg config.MailConfig) (*SMTPTransport, error) {
+	security := cfg.Security
+	if security == "" {
+		security = "starttls"
+	}
+	if security != "starttls" && security != "tls" && security != "none" {
+		return nil, fmt.Errorf("unknown mail security %q", cfg.Security)
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+		if security == "tls" {
+			port = 465
+		}
+	}
+	return &SMTPTransport{
+		host:     cfg.Host,
+		port:     port,
+		username: cfg.Username,
+		password: cfg.Password,
+		security: security,
+	}, nil
+}
+
+func (s *SMTPTransport) Send(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	if s.security == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if s.security == "starttls" {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	body, err := buildMessage(msg)
+	if err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage encodes a message as multipart/alternative with a plain text
+// and an HTML part.
+func buildMessage(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if from, err := mail.ParseAddress(msg.From); err == nil {
+		if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+			domain = from.Address[at+1:]
+		}
+	}
+	headers := []struct{ key, value string }{
+		{"From", msg.From},
+		{"To", msg.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + writer.Boundary()},
+	}
+	var head bytes.Buffer
+	for _, h := range headers {
+		fmt.Fprintf(&head, "%s: %s\r\n", h.key, h.value)
+	}
+	head.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return append(head.Bytes(), buf.Bytes()...), nil
+}
+
+// LogTransport only logs who a message is for. It is used when no SMTP host is
+// configured so development setups do not need a mail server. The body is left
+// out, it holds sign in and reset links.
+type LogTransport struct{}
+
+func (LogTransport) Send(ctx context.Context, msg Message) error {
+	logrus.WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+	}).Info("Mail not sent, no SMTP host configured")
+	return nil
+}
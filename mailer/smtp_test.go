@@ -0,0 +1,191 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vnestcc/dashboard/config"
+)
+
+// fakeSMTP is an SMTP server that accepts mail without STARTTLS or AUTH and
+// keeps what it was given.
+type fakeSMTP struct {
+	addr       *net.TCPAddr
+	rejectRcpt bool
+
+	mu   sync.Mutex
+	from string
+	rcpt []string
+	data []byte
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &fakeSMTP{addr: ln.Addr().(*net.TCPAddr)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = reversePath(arg, "FROM:")
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			if s.rejectRcpt {
+				text.PrintfLine("550 No such user")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, reversePath(arg, "TO:"))
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = data
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// reversePath is the address of a MAIL or RCPT command, without the
+// parameters that may follow it.
+func reversePath(arg, prefix string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(arg, prefix), " ")
+	return strings.Trim(path, "<>")
+}
+
+func (s *fakeSMTP) transport(t *testing.T) *SMTPTransport {
+	t.Helper()
+	transport, err := NewSMTP(config.MailConfig{Host: s.addr.IP.String(), Port: s.addr.Port, Security: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transport
+}
+
+func TestSMTPSend(t *testing.T) {
+	server := newFakeSMTP(t)
+	msg := Message{
+		From:    "Dashboard <no-reply@example.com>",
+		To:      "Jane Doe <jane@example.com>",
+		Subject: "Réinitialiser votre mot de passe",
+		Text:    "Hi Jane,\nreset it at https://example.com/reset?token=a=b\n",
+		HTML:    `<p>Hi Jane, <a href="https://example.com/reset?token=a=b">reset it</a></p>`,
+	}
+	if err := server.transport(t).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.from != "no-reply@example.com" {
+		t.Errorf("MAIL FROM = %q, want no-reply@example.com", server.from)
+	}
+	if len(server.rcpt) != 1 || server.rcpt[0] != "jane@example.com" {
+		t.Errorf("RCPT TO = %q, want [jane@example.com]", server.rcpt)
+	}
+
+	parsed, err := mail.ReadMessage(bufio.NewReader(bytes.NewReader(server.data)))
+	if err != nil {
+		t.Fatalf("the sent message does not parse: %v", err)
+	}
+	if parsed.Header.Get("From") != msg.From || parsed.Header.Get("To") != msg.To {
+		t.Errorf("From, To = %q, %q, want %q, %q", parsed.Header.Get("From"), parsed.Header.Get("To"), msg.From, msg.To)
+	}
+	rawSubject := parsed.Header.Get("Subject")
+	if !strings.HasPrefix(rawSubject, "=?utf-8?q?") {
+		t.Errorf("Subject %q is not Q-encoded", rawSubject)
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(rawSubject); err != nil || subject != msg.Subject {
+		t.Errorf("Subject decodes to %q, %v, want %q", subject, err, msg.Subject)
+	}
+	if id := parsed.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID %q does not use the sender domain", id)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v, want multipart/alternative", mediaType, err)
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("missing the %s part: %v", want.contentType, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("part Content-Type = %q, want %q", got, want.contentType)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("reading the %s part: %v", want.contentType, err)
+		}
+		if string(body) != want.body {
+			t.Errorf("%s part = %q, want %q", want.contentType, body, want.body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("the message has more than two parts: %v", err)
+	}
+}
+
+func TestSMTPSendRejected(t *testing.T) {
+	server := newFakeSMTP(t)
+	server.rejectRcpt = true
+	msg := Message{From: "no-reply@example.com", To: "nobody@example.com", Subject: "Hi", Text: "Hi", HTML: "<p>Hi</p>"}
+	if err := server.transport(t).Send(context.Background(), msg); err == nil {
+		t.Fatal("Send() to a rejected recipient passed, want an error")
+	}
+}
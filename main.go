@@ -26,33 +26,78 @@ package main
 // @tag.name user
 // @tag.description Endpoints for accessing and managing regular user data.
 
+// @tag.name vc
+// @tag.description Endpoints for VCs to browse the companies in their portfolio.
+
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-co-op/gocron"
 	"github.com/vnestcc/dashboard/config"
-	"github.com/vnestcc/dashboard/db"
 	"github.com/vnestcc/dashboard/handlers"
+	"github.com/vnestcc/dashboard/limiter"
+	"github.com/vnestcc/dashboard/mailer"
+	"github.com/vnestcc/dashboard/oidc"
+	"github.com/vnestcc/dashboard/reporting"
 	"github.com/vnestcc/dashboard/routers"
+	"github.com/vnestcc/dashboard/storage"
 	"github.com/vnestcc/dashboard/utils"
 	middleware "github.com/vnestcc/dashboard/utils/middlewares"
 	"github.com/vnestcc/dashboard/utils/values"
 )
 
+// main runs the server when started without a command, so existing
+// deployments keep working. See commands for the rest.
 func main() {
-	var cfg config.Config
-	if config, err := config.LoadConfig("/config.toml"); err != nil {
-		fmt.Printf("Error in loading config file: %v\n", err)
-		return
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// shutdownTimeout is how long requests in flight get to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+func serve(cfg *config.Config) error {
+	if store, err := storage.New(cfg.Storage); err != nil {
+		return fmt.Errorf("setting up storage: %w", err)
+	} else {
+		values.SetStorage(store)
+	}
+	if attempts, err := limiter.New(cfg.Limiter, values.GetDB()); err != nil {
+		return fmt.Errorf("setting up the login limiter: %w", err)
 	} else {
-		cfg = config
+		values.SetLimiter(attempts)
+		utils.Logger.AddHook(limiter.NewHook(attempts))
+	}
+	if mail, err := mailer.New(cfg.Mail, cfg.Server.Prod, values.GetDB()); err != nil {
+		return fmt.Errorf("setting up mail: %w", err)
+	} else {
+		values.SetMailer(mail)
+		go mail.Run(context.Background())
+	}
+	if sso, err := oidc.New(cfg.SSO, values.GetDB()); err != nil {
+		return fmt.Errorf("setting up SSO: %w", err)
+	} else {
+		values.SetSSO(sso)
 	}
-	values.SetConfig(&cfg)
-	db.InitDB(&cfg)
-	values.SetDB(db.DB)
-	utils.NewLogger(cfg.Server.Prod)
 	if cfg.Server.Prod {
 		gin.SetMode(gin.ReleaseMode)
 	} else {
@@ -60,13 +105,51 @@ func main() {
 	}
 	s := gocron.NewScheduler(time.UTC)
 	s.Every("6h").Do(utils.UserCleanUp)
+	s.Every("24h").Do(utils.SessionCleanUp)
+	s.Every("24h").Do(utils.VerificationCleanUp)
+	s.Every("1h").Do(utils.ChallengeCleanUp)
+	s.Every("24h").Do(utils.JoinCodeCleanUp)
+	s.Every("1h").Do(utils.AttemptCleanUp)
+	s.Every("1h").Do(utils.SSOCleanUp)
+	s.Every("24h").Do(utils.MailCleanUp)
+	cal, err := reporting.NewCalendar(cfg.Reporting)
+	if err != nil {
+		return fmt.Errorf("setting up the reporting calendar: %w", err)
+	}
+	if cfg.Reporting.Enabled {
+		s.Every("1h").Do(utils.ReportingCalendar, cal)
+	}
+	s.Every("1h").Do(utils.DeadlineReminders, cal)
 	s.StartAsync()
-	handlers.InitHandler(&cfg)
+	handlers.InitHandler(cfg)
 	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("setting trusted proxies: %w", err)
+	}
 	r.Use(middleware.Logger())
 	r.Use(middleware.CORS(cfg.Server))
 	r.Use(gin.Recovery())
 	routers.LoadRoutes(r)
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
+		Handler: r,
+	}
+	stopped, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	failed := make(chan error, 1)
+	go func() {
+		failed <- srv.ListenAndServe()
+	}()
 	utils.Logger.Printf("[ENGINE] Server started at %s:%d\n", cfg.Server.Host, cfg.Server.Port)
-	r.Run(fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port))
+	select {
+	case err := <-failed:
+		return err
+	case <-stopped.Done():
+	}
+	// requests in flight are finished before the caller flushes the audit log
+	utils.Logger.Info("Shutting down")
+	s.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
 }
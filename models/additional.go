@@ -21,8 +21,8 @@ type AdditionalInfo struct {
 	InitiativeProgress       string `json:"initiative_progress"`
 	BusinessModelAdjustments string `json:"business_model_adjustments"`
 
-	IsVisible  uint8 `gorm:"default:255"`
-	IsEditable uint8 `gorm:"default:255"`
+	IsVisible  uint8 `gorm:"default:255" json:"-"`
+	IsEditable uint8 `gorm:"default:255" json:"-"`
 }
 
 func (a *AdditionalInfo) EditableList() []string {
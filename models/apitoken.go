@@ -0,0 +1,97 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APITokenPrefix marks API tokens so they can be told apart from JWTs.
+const APITokenPrefix = "vnt_"
+
+const (
+	ScopeMetricsRead = "metrics:read"
+	ScopeCompanyRead = "company:read"
+)
+
+// APIScopes are the scopes a token can be given.
+var APIScopes = []string{ScopeMetricsRead, ScopeCompanyRead}
+
+type Scopes []string
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+func (s *Scopes) Scan(value any) error {
+	if value == nil {
+		*s = Scopes{}
+		return nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		bs, ok := value.([]byte)
+		if !ok {
+			return errors.New("failed to scan Scopes: type assertion to string or []byte failed")
+		}
+		str = string(bs)
+	}
+	if str == "" {
+		*s = Scopes{}
+		return nil
+	}
+	*s = strings.Split(str, ",")
+	return nil
+}
+
+func (s Scopes) Has(scope string) bool {
+	return slices.Contains(s, scope)
+}
+
+// ServiceAccount owns API tokens for automation that does not act as a person.
+type ServiceAccount struct {
+	gorm.Model
+	Name        string `gorm:"not null"`
+	Description string
+	CreatedBy   uint `gorm:"not null"`
+}
+
+// APIToken is a long lived token for scripts. It belongs to either a user or a
+// service account, only its hash is stored and it only works on routes that
+// accept one of its scopes.
+type APIToken struct {
+	gorm.Model
+	Name             string `gorm:"not null"`
+	TokenHash        string `gorm:"not null;uniqueIndex"`
+	Prefix           string `gorm:"not null"`
+	Scopes           Scopes `gorm:"type:text;not null"`
+	UserID           *uint  `gorm:"index"`
+	ServiceAccountID *uint  `gorm:"index"`
+	CreatedBy        uint   `gorm:"not null"`
+	ExpiresAt        *time.Time
+	LastUsedAt       *time.Time
+	RevokedAt        *time.Time
+}
+
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Active reports whether the token can still be used.
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// RevokeServiceAccountTokens ends every token of a service account.
+func RevokeServiceAccountTokens(db *gorm.DB, accountID uint) error {
+	return db.Model(&APIToken{}).
+		Where("service_account_id = ? AND revoked_at IS NULL", accountID).
+		Update("revoked_at", time.Now()).Error
+}
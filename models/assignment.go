@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// VCAssignment links an approved VC to a company in their portfolio
+type VCAssignment struct {
+	gorm.Model
+	VCID      uint `gorm:"not null;uniqueIndex:idx_vc_company"`
+	CompanyID uint `gorm:"not null;uniqueIndex:idx_vc_company"`
+
+	VC      User    `gorm:"foreignKey:VCID"`
+	Company Company `gorm:"foreignKey:CompanyID"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuditLog is a persisted `type: audit` log entry. Fields holds every field of
+// the entry as a JSON object, the common ones are also split out for filtering.
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey"`
+	LoggedAt  time.Time `gorm:"not null;index"`
+	Level     string    `gorm:"size:16"`
+	Event     string    `gorm:"index"`
+	Status    string    `gorm:"size:32;index"`
+	Reason    string
+	UserID    *uint  `gorm:"index"`
+	Email     string `gorm:"index"`
+	CompanyID *uint  `gorm:"index"`
+	IP        string `gorm:"size:64"`
+	Message   string
+	Fields    string `gorm:"type:jsonb"`
+}
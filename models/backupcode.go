@@ -0,0 +1,85 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/vnestcc/dashboard/utils/values"
+	"gorm.io/gorm"
+)
+
+const (
+	BackupCodeCount  = 10
+	backupCodeLength = 12
+)
+
+// BackupCode is one single-use recovery code. Only a keyed hash of the code is
+// kept, so the codes are shown once when they are generated and never again.
+type BackupCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_backup_code"`
+	CodeHash  string `gorm:"not null;uniqueIndex:idx_backup_code"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func normalizeBackupCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code))
+}
+
+// HashBackupCode keys the hash with the JWT secret, a leaked table alone is not
+// enough to brute force the short numeric codes. Changing the secret voids all codes.
+func HashBackupCode(code string) string {
+	mac := hmac.New(sha256.New, []byte(values.GetConfig().Server.JWTSecret))
+	mac.Write([]byte(normalizeBackupCode(code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateBackupCodes replaces every backup code of the user with a new set and
+// returns the codes in plain text, formatted like 1234-5678-9012.
+func GenerateBackupCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, 0, BackupCodeCount)
+	rows := make([]BackupCode, 0, BackupCodeCount)
+	for len(codes) < BackupCodeCount {
+		code, err := generateResetCode(backupCodeLength)
+		if err != nil {
+			return nil, err
+		}
+		formatted := code[0:4] + "-" + code[4:8] + "-" + code[8:12]
+		codes = append(codes, formatted)
+		rows = append(rows, BackupCode{UserID: userID, CodeHash: HashBackupCode(code)})
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&BackupCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ConsumeBackupCode marks a code as used and reports whether it was valid and
+// unused. The check and the update are one statement, so a code works only once
+// even when it is sent twice at the same time.
+func ConsumeBackupCode(db *gorm.DB, userID uint, code string) (bool, error) {
+	if normalizeBackupCode(code) == "" {
+		return false, nil
+	}
+	result := db.Model(&BackupCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, HashBackupCode(code)).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// RemainingBackupCodes counts the unused backup codes of a user.
+func RemainingBackupCodes(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	err := db.Model(&BackupCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// LoginChallenge is a login that passed the password check and waits for a
+// second factor. Setup is set when the role requires 2FA but the user has not
+// enrolled yet, the first valid code then also turns 2FA on. Only the hash of
+// the token is kept, and keeping it in the database lets any server instance
+// finish the login.
+type LoginChallenge struct {
+	ID        uint      `gorm:"primaryKey"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	UserID    uint      `gorm:"not null;index"`
+	Setup     bool      `gorm:"not null;default:false"`
+	Attempts  int       `gorm:"not null;default:0"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
@@ -1,21 +1,69 @@
 package models
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
+// Funding stages of a company.
+const (
+	StagePreSeed     = "pre_seed"
+	StageSeed        = "seed"
+	StageSeriesA     = "series_a"
+	StageSeriesBPlus = "series_b_plus"
+)
+
+var CompanyStages = []string{StagePreSeed, StageSeed, StageSeriesA, StageSeriesBPlus}
+
+// SectorOther is where companies go that fit no other sector.
+const SectorOther = "other"
+
+// Sectors is the taxonomy companies are filed under, tags describe them
+// further.
+var Sectors = []string{
+	"ai", "agritech", "biotech", "climate", "consumer", "cybersecurity", "deeptech",
+	"ecommerce", "edtech", "fintech", "foodtech", "gaming", "hardware", "healthtech",
+	"hrtech", "insurtech", "legaltech", "logistics", "media", "mobility", "proptech",
+	"saas", "spacetech", SectorOther,
+}
+
+// NormalizeSector returns the sector of the taxonomy the name stands for.
+func NormalizeSector(name string) (string, bool) {
+	sector := strings.ToLower(strings.TrimSpace(name))
+	return sector, slices.Contains(Sectors, sector)
+}
+
+// SocialLinks are the profiles of a company on other sites.
+type SocialLinks struct {
+	LinkedIn   string `json:"linkedin,omitempty" gorm:"column:linkedin" example:"https://www.linkedin.com/company/acme"`
+	Twitter    string `json:"twitter,omitempty" example:"https://x.com/acme"`
+	GitHub     string `json:"github,omitempty" gorm:"column:github" example:"https://github.com/acme"`
+	Crunchbase string `json:"crunchbase,omitempty" example:"https://www.crunchbase.com/organization/acme"`
+}
+
 type Company struct {
 	gorm.Model
 	ID           uint `gorm:"primaryKey;autoIncrement"`
 	Name         string
 	ContactName  string
 	ContactEmail string `gorm:"unique"`
-	SecretCode   string `gorm:"unique"`
-	Sector       string
-	Description  string
+	// FounderID is the member who manages join codes and members
+	FounderID   *uint
+	Sector      string
+	Description string
+
+	Stage     string
+	FoundedOn *time.Time `gorm:"type:date"`
+	HQCity    string
+	HQCountry string // ISO 3166-1 alpha-2
+	Website   string
+	LogoURL   string
+	Social    SocialLinks `gorm:"embedded;embeddedPrefix:social_"`
+	Tags      datatypes.JSONSlice[string]
 
 	Quarters []Quarter `gorm:"foreignKey:CompanyID"`
 
@@ -23,12 +71,13 @@ type Company struct {
 	PlannedYear    *uint
 }
 
-func (c *Company) BeforeCreate(tx *gorm.DB) (err error) {
-	random := make([]byte, 6) // this much size to avoid collisions
-	_, err = rand.Read(random)
-	if err != nil {
-		return err
-	}
-	c.SecretCode = hex.EncodeToString(random)
-	return nil
+// HandOverFounder makes the longest standing other member the founder of the
+// companies the user founded, or leaves them without one.
+func HandOverFounder(tx *gorm.DB, userID uint) error {
+	return tx.Exec(`
+		UPDATE companies SET founder_id = (
+			SELECT MIN(id) FROM users
+			WHERE users.startup_id = companies.id AND users.id <> ? AND users.deleted_at IS NULL
+		) WHERE founder_id = ?
+	`, userID, userID).Error
 }
@@ -12,12 +12,12 @@ type UnitEconomics struct {
 	QuarterID uint   `gorm:"not null;index:idx_unique_comp_quarter_version"`
 	Version   uint32 `gorm:"not null;index:idx_unique_comp_quarter_version,unique;default:1"`
 
-	CAC        string `json:"cac"`
-	CACChange  string `json:"cac_change"`
-	LTV        string `json:"ltv"`
-	LTVRatio   string `json:"ltv_ratio"`
-	CACPayback string `json:"cac_payback"`
-	ARPU       string `json:"arpu"`
+	CAC        Money   `json:"cac" gorm:"embedded;embeddedPrefix:cac_"`
+	CACChange  Percent `json:"cac_change"`
+	LTV        Money   `json:"ltv" gorm:"embedded;embeddedPrefix:ltv_"`
+	LTVRatio   Decimal `json:"ltv_ratio"`
+	CACPayback Months  `json:"cac_payback"`
+	ARPU       Money   `json:"arpu" gorm:"embedded;embeddedPrefix:arpu_"`
 
 	MarketingBreakdowns []MarketingBreakdown `json:"marketing_breakdowns"`
 
@@ -29,9 +29,9 @@ type MarketingBreakdown struct {
 	gorm.Model      `json:"-"`
 	UnitEconomicsID uint   `json:"-"`
 	Channel         string `json:"channel"`
-	Spend           string `json:"spend"`
-	Budget          string `json:"budget"`
-	CAC             string `json:"cac"`
+	Spend           Money  `json:"spend" gorm:"embedded;embeddedPrefix:spend_"`
+	Budget          Money  `json:"budget" gorm:"embedded;embeddedPrefix:budget_"`
+	CAC             Money  `json:"cac" gorm:"embedded;embeddedPrefix:cac_"`
 }
 
 func (u *UnitEconomics) EditableList() []string {
@@ -12,15 +12,15 @@ type FinancialHealth struct {
 	QuarterID uint   `gorm:"not null;index:idx_unique_comp_quarter_version"`
 	Version   uint32 `gorm:"not null;index:idx_unique_comp_quarter_version,unique;default:1"`
 
-	CashBalance           string `json:"cash_balance"`
-	BurnRate              string `json:"burn_rate"`
-	CashRunway            string `json:"cash_runway"`
-	BurnRateChange        string `json:"burn_rate_change"`
-	QuarterlyRevenue      string `json:"quarterly_revenue"`
-	RevenueGrowth         string `json:"revenue_growth"`
-	GrossMargin           string `json:"gross_margin"`
-	NetMargin             string `json:"net_margin"`
-	ProfitabilityTimeline string `json:"profitability_timeline"`
+	CashBalance           Money   `json:"cash_balance" gorm:"embedded;embeddedPrefix:cash_balance_"`
+	BurnRate              Money   `json:"burn_rate" gorm:"embedded;embeddedPrefix:burn_rate_"`
+	CashRunway            Months  `json:"cash_runway"`
+	BurnRateChange        Percent `json:"burn_rate_change"`
+	QuarterlyRevenue      Money   `json:"quarterly_revenue" gorm:"embedded;embeddedPrefix:quarterly_revenue_"`
+	RevenueGrowth         Percent `json:"revenue_growth"`
+	GrossMargin           Percent `json:"gross_margin"`
+	NetMargin             Percent `json:"net_margin"`
+	ProfitabilityTimeline string  `json:"profitability_timeline"`
 
 	RevenueBreakdowns []RevenueBreakdown `json:"revenue_breakdowns"`
 
@@ -30,10 +30,10 @@ type FinancialHealth struct {
 
 type RevenueBreakdown struct {
 	gorm.Model        `json:"-"`
-	FinancialHealthID uint   `json:"-"`
-	Product           string `json:"product"`
-	Revenue           string `json:"revenue"`
-	Percentage        string `json:"percentage"`
+	FinancialHealthID uint    `json:"-"`
+	Product           string  `json:"product"`
+	Revenue           Money   `json:"revenue" gorm:"embedded;embeddedPrefix:revenue_"`
+	Percentage        Percent `json:"percentage"`
 }
 
 func (f *FinancialHealth) TableName() string {
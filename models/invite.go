@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ModeratorInvite lets one person sign up as a moderator or another staff role. The token is sent to
+// the invited email and only its hash is stored; it works once and until ExpiresAt.
+type ModeratorInvite struct {
+	gorm.Model
+	Email      string    `gorm:"not null;index"`
+	Role       string    `gorm:"not null;default:moderator"`
+	TokenHash  string    `gorm:"not null;uniqueIndex"`
+	InvitedBy  uint      `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	AcceptedAt *time.Time
+	UserID     *uint
+}
+
+// ClaimModeratorInvite marks the invite with the token hash as accepted if it
+// is still open. Only one of several concurrent signups with the same token wins.
+func ClaimModeratorInvite(tx *gorm.DB, tokenHash string, now time.Time) (ModeratorInvite, bool, error) {
+	var invite ModeratorInvite
+	result := tx.Model(&ModeratorInvite{}).
+		Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", tokenHash, now).
+		Update("accepted_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return invite, false, result.Error
+	}
+	err := tx.Where("token_hash = ?", tokenHash).First(&invite).Error
+	return invite, err == nil, err
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JoinCode lets people join a company. The founder hands it out, only its hash
+// is stored and it works until it expires, is revoked or was used MaxUses
+// times. A code with an Email only works for the account with that email.
+type JoinCode struct {
+	gorm.Model
+	CompanyID uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null;uniqueIndex"`
+	Prefix    string `gorm:"not null"`
+	Email     string
+	MaxUses   uint      `gorm:"not null;default:0"` // 0 is unlimited
+	Uses      uint      `gorm:"not null;default:0"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedBy uint      `gorm:"not null"`
+	RevokedAt *time.Time
+}
+
+// NewJoinCode returns a random code and its hash.
+func NewJoinCode() (string, string, error) {
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	code := hex.EncodeToString(random)
+	return code, HashJoinCode(code), nil
+}
+
+func HashJoinCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Active reports whether the code can still be used by someone.
+func (c *JoinCode) Active(now time.Time) bool {
+	return c.RevokedAt == nil && now.Before(c.ExpiresAt) && (c.MaxUses == 0 || c.Uses < c.MaxUses)
+}
+
+// ClaimJoinCode counts a use of the code of the company if it still works for
+// the email. Concurrent joins cannot use a code more than MaxUses times.
+func ClaimJoinCode(tx *gorm.DB, companyID uint, code, email string, now time.Time) (bool, error) {
+	result := tx.Model(&JoinCode{}).
+		Where("company_id = ? AND code_hash = ? AND revoked_at IS NULL AND expires_at > ?", companyID, HashJoinCode(code), now).
+		Where("max_uses = 0 OR uses < max_uses").
+		Where("email = '' OR email IS NULL OR email = ?", email).
+		Update("uses", gorm.Expr("uses + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeCompanyJoinCodes ends every code of a company.
+func RevokeCompanyJoinCodes(tx *gorm.DB, companyID uint) error {
+	return tx.Model(&JoinCode{}).
+		Where("company_id = ? AND revoked_at IS NULL", companyID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -12,18 +12,18 @@ type MarketTraction struct {
 	QuarterID uint   `gorm:"not null;index:idx_unique_comp_quarter_version"`
 	Version   uint32 `gorm:"not null;index:idx_unique_comp_quarter_version,unique;default:1"`
 
-	NewCustomers        string `json:"new_customers"`
-	TotalCustomers      string `json:"total_customers"`
-	CustomerGrowth      string `json:"customer_growth"`
-	RetentionRate       string `json:"retention_rate"`
-	ChurnRate           string `json:"churn_rate"`
-	PipelineValue       string `json:"pipeline_value"`
-	ConversionRate      string `json:"conversion_rate"`
-	SalesCycle          string `json:"sales_cycle"`
-	SalesProcessChanges string `json:"sales_process_changes"`
-	MarketShare         string `json:"market_share"`
-	MarketShareChange   string `json:"market_share_change"`
-	MarketTrends        string `json:"market_trends"`
+	NewCustomers        Decimal `json:"new_customers"`
+	TotalCustomers      Decimal `json:"total_customers"`
+	CustomerGrowth      Percent `json:"customer_growth"`
+	RetentionRate       Percent `json:"retention_rate"`
+	ChurnRate           Percent `json:"churn_rate"`
+	PipelineValue       Money   `json:"pipeline_value" gorm:"embedded;embeddedPrefix:pipeline_value_"`
+	ConversionRate      Percent `json:"conversion_rate"`
+	SalesCycle          string  `json:"sales_cycle"`
+	SalesProcessChanges string  `json:"sales_process_changes"`
+	MarketShare         Percent `json:"market_share"`
+	MarketShareChange   Percent `json:"market_share_change"`
+	MarketTrends        string  `json:"market_trends"`
 
 	IsVisible  uint16 `gorm:"default:4095" json:"-"`
 	IsEditable uint16 `gorm:"default:4095" json:"-"`
@@ -0,0 +1,339 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts that are sent or migrated without a currency code.
+var DefaultCurrency = "USD"
+
+const (
+	decimalPlaces = 4
+	decimalFactor = 10000
+	decimalLimit  = math.MaxInt64 / decimalFactor
+)
+
+// Decimal is a nullable fixed point number with four decimal places.
+// It is stored as numeric and serialized as a plain JSON number (or null).
+type Decimal struct {
+	units int64
+	valid bool
+	bad   string
+}
+
+// Percent is a percentage such as 12.5 for 12.5%.
+type Percent struct {
+	Decimal
+}
+
+// Months is a duration counted in months, e.g. cash runway or CAC payback.
+type Months struct {
+	Decimal
+}
+
+// Money is an amount with an ISO 4217 currency code. Embed it with a column prefix:
+//
+//	CashBalance Money `gorm:"embedded;embeddedPrefix:cash_balance_"`
+type Money struct {
+	Amount   Decimal `json:"amount"`
+	Currency string  `json:"currency" gorm:"size:3"`
+}
+
+func NewDecimal(f float64) Decimal {
+	return Decimal{units: int64(math.Round(f * decimalFactor)), valid: true}
+}
+
+// ParseDecimal parses a plain decimal literal like "-1200.5". Anything else is rejected.
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Decimal{}, nil
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	neg := strings.HasPrefix(intPart, "-")
+	if neg || strings.HasPrefix(intPart, "+") {
+		intPart = intPart[1:]
+	}
+	if (intPart == "" && fracPart == "") || !isDigits(intPart) || !isDigits(fracPart) {
+		return Decimal{}, fmt.Errorf("invalid number %q", s)
+	}
+	if len(fracPart) > decimalPlaces {
+		// the value keeps four places, anything past that is rounded
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.Abs(f) >= decimalLimit {
+			return Decimal{}, fmt.Errorf("invalid number %q", s)
+		}
+		return NewDecimal(f), nil
+	}
+	fracPart += strings.Repeat("0", decimalPlaces-len(fracPart))
+	units, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("number out of range %q", s)
+	}
+	if neg {
+		units = -units
+	}
+	return Decimal{units: units, valid: true}, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (d Decimal) Valid() bool {
+	return d.valid
+}
+
+func (d Decimal) Float64() float64 {
+	return float64(d.units) / decimalFactor
+}
+
+func (d Decimal) String() string {
+	if !d.valid {
+		return ""
+	}
+	units := d.units
+	sign := ""
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	s := fmt.Sprintf("%s%d.%04d", sign, units/decimalFactor, units%decimalFactor)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func (Decimal) GormDataType() string {
+	return "numeric"
+}
+
+func (d *Decimal) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Decimal{}
+		return nil
+	case []byte:
+		return d.scanString(string(v))
+	case string:
+		return d.scanString(v)
+	case float64:
+		*d = NewDecimal(v)
+		return nil
+	case int64:
+		*d = Decimal{units: v * decimalFactor, valid: true}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Decimal", src)
+}
+
+func (d *Decimal) scanString(s string) error {
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		f, ferr := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if ferr != nil || math.Abs(f) >= decimalLimit {
+			return err
+		}
+		parsed = NewDecimal(f)
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Decimal) Value() (driver.Value, error) {
+	if d.bad != "" {
+		return nil, fmt.Errorf("invalid input, expected %s", d.bad)
+	}
+	if !d.valid {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if !d.valid {
+		return []byte("null"), nil
+	}
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts a number, a numeric string, or null / "" for no value.
+// Bad input does not fail decoding, it is reported by InputErrors instead so
+// every wrong field can be named at once.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	d.unmarshal(data, "", "a number")
+	return nil
+}
+
+func (d *Decimal) unmarshal(data []byte, suffix, expected string) {
+	*d = Decimal{}
+	data = bytes.TrimSpace(data)
+	raw := string(data)
+	if raw == "null" {
+		return
+	}
+	if strings.HasPrefix(raw, `"`) {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			d.bad = expected
+			return
+		}
+		raw = strings.TrimSpace(raw)
+		if suffix != "" {
+			raw = strings.TrimSpace(strings.TrimSuffix(raw, suffix))
+		}
+	} else if strings.ContainsAny(raw, "eE") {
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.Abs(f) >= decimalLimit {
+			d.bad = expected
+			return
+		}
+		*d = NewDecimal(f)
+		return
+	}
+	parsed, err := ParseDecimal(raw)
+	if err != nil {
+		d.bad = expected
+		return
+	}
+	*d = parsed
+}
+
+func (d Decimal) inputError() string {
+	return d.bad
+}
+
+// UnmarshalJSON also accepts strings with a trailing percent sign like "12.5%".
+func (p *Percent) UnmarshalJSON(data []byte) error {
+	p.Decimal.unmarshal(data, "%", "a percentage")
+	return nil
+}
+
+func (m *Months) UnmarshalJSON(data []byte) error {
+	m.Decimal.unmarshal(data, "", "a number of months")
+	return nil
+}
+
+func (m Money) Valid() bool {
+	return m.Amount.valid
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	if !m.Amount.valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(struct {
+		Amount   Decimal `json:"amount"`
+		Currency string  `json:"currency"`
+	}{m.Amount, m.Currency})
+}
+
+// UnmarshalJSON accepts {"amount": 1200.5, "currency": "USD"}, or a bare amount
+// in the default currency. null and "" clear the value.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	const expected = "an amount with a 3 letter currency code"
+	*m = Money{}
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("{")) {
+		m.Amount.unmarshal(data, "", expected)
+		if m.Amount.valid {
+			m.Currency = DefaultCurrency
+		}
+		return nil
+	}
+	var raw struct {
+		Amount   json.RawMessage `json:"amount"`
+		Currency string          `json:"currency"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		m.Amount.bad = expected
+		return nil
+	}
+	if len(raw.Amount) > 0 {
+		m.Amount.unmarshal(raw.Amount, "", expected)
+	}
+	if !m.Amount.valid {
+		return nil
+	}
+	m.Currency = strings.ToUpper(strings.TrimSpace(raw.Currency))
+	if m.Currency == "" {
+		m.Currency = DefaultCurrency
+	}
+	if !isCurrencyCode(m.Currency) {
+		m.Amount = Decimal{bad: expected}
+	}
+	return nil
+}
+
+func (m Money) inputError() string {
+	return m.Amount.bad
+}
+
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// InputErrors walks a decoded request and returns, by JSON path, every typed
+// numeric field whose input could not be parsed.
+func InputErrors(v any) map[string]string {
+	errs := map[string]string{}
+	collectInputErrors(reflect.ValueOf(v), "", errs)
+	return errs
+}
+
+func collectInputErrors(v reflect.Value, path string, errs map[string]string) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if checker, ok := v.Interface().(interface{ inputError() string }); ok {
+		if msg := checker.inputError(); msg != "" {
+			errs[path] = "expected " + msg
+		}
+		return
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectInputErrors(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || (name == "" && !field.Anonymous) {
+				continue
+			}
+			if path != "" && name != "" {
+				name = path + "." + name
+			} else if name == "" {
+				name = path
+			}
+			collectInputErrors(v.Field(i), name, errs)
+		}
+	}
+}
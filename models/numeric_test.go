@@ -0,0 +1,58 @@
+package models
+
+import "testing"
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "  ", want: ""},
+		{in: "0", want: "0"},
+		{in: "1200", want: "1200"},
+		{in: "-1200.5", want: "-1200.5"},
+		{in: "+42", want: "42"},
+		{in: " 7.25 ", want: "7.25"},
+		{in: ".5", want: "0.5"},
+		{in: "-.5", want: "-0.5"},
+		{in: "3.", want: "3"},
+		{in: "1.23456", want: "1.2346"},
+		{in: "-1.23454", want: "-1.2345"},
+		{in: "922337203685477", want: "922337203685477"},
+		{in: "922337203685478", wantErr: true},
+		{in: "1e6", wantErr: true},
+		{in: "1,200", wantErr: true},
+		{in: "--5", wantErr: true},
+		{in: "-+5", wantErr: true},
+		{in: "+-5", wantErr: true},
+		{in: "++5", wantErr: true},
+		{in: "5-", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "$5", wantErr: true},
+		{in: "NaN", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDecimal(%q) = %q, want an error", tt.in, got.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDecimal(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseDecimal(%q) = %q, want %q", tt.in, got.String(), tt.want)
+		}
+		if got.Valid() != (tt.want != "") {
+			t.Errorf("ParseDecimal(%q).Valid() = %v", tt.in, got.Valid())
+		}
+	}
+}
@@ -1,11 +1,65 @@
 package models
 
 import (
+	"errors"
+	"slices"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Statuses of a quarter. Founders fill in a draft and submit it, a moderator
+// reviews it and either sends it back with changes requested or approves it,
+// which locks its numbers.
+const (
+	QuarterDraft            = "draft"
+	QuarterSubmitted        = "submitted"
+	QuarterUnderReview      = "under_review"
+	QuarterChangesRequested = "changes_requested"
+	QuarterApproved         = "approved"
+)
+
+// QuarterSubmittedStatuses are the statuses of a quarter its founders handed
+// in, which VCs may read.
+var QuarterSubmittedStatuses = []string{QuarterSubmitted, QuarterUnderReview, QuarterApproved}
+
+// QuarterAction moves a quarter from one of the From statuses to To.
+type QuarterAction struct {
+	Name string
+	From []string
+	To   string
+}
+
+var (
+	ActionSubmit         = QuarterAction{"submit", []string{QuarterDraft, QuarterChangesRequested}, QuarterSubmitted}
+	ActionStartReview    = QuarterAction{"start_review", []string{QuarterSubmitted}, QuarterUnderReview}
+	ActionRequestChanges = QuarterAction{"request_changes", []string{QuarterUnderReview}, QuarterChangesRequested}
+	ActionApprove        = QuarterAction{"approve", []string{QuarterUnderReview}, QuarterApproved}
+	ActionReopen         = QuarterAction{"reopen", []string{QuarterApproved}, QuarterChangesRequested}
+)
+
+var ErrInvalidTransition = errors.New("the quarter is not in a status this action applies to")
+
+// QuarterSections are the sections founders fill in for a quarter, by the
+// name the API uses for them and the table they are stored in.
+var QuarterSections = []struct {
+	Name  string
+	Table string
+}{
+	{"finance", "finance"},
+	{"market", "market"},
+	{"uniteconomics", "economics"},
+	{"teamperf", "teamperf"},
+	{"fund", "fund"},
+	{"competitive", "competitive"},
+	{"operation", "operational"},
+	{"risk", "risk"},
+	{"additional", "additional"},
+	{"self", "assessment"},
+	{"product", "product"},
+	{"attachments", "attachment"},
+}
+
 type Quarter struct {
 	gorm.Model
 	ID        uint `gorm:"primaryKey;autoIncrement;uniqueIndex:idx_quarter_comp"`
@@ -14,6 +68,17 @@ type Quarter struct {
 	Quarter   string `gorm:"not null;uniqueIndex:idx_company_quarter_year"`
 	Year      uint   `gorm:"not null;uniqueIndex:idx_company_quarter_year"`
 
+	Status          string `gorm:"not null;default:draft;index"`
+	StatusChangedAt *time.Time
+	StatusChangedBy *uint
+	// Deadline is when founders can no longer change or submit the quarter,
+	// quarters opened by hand have none
+	Deadline       *time.Time
+	ReminderSentAt *time.Time
+	// Backfilled quarters were entered after the fact for a company that
+	// joined later, not reported live
+	Backfilled bool `gorm:"not null;default:false"`
+
 	Company                 Company                 `gorm:"foreignKey:CompanyID"`
 	FinancialHealths        []FinancialHealth       `gorm:"foreignKey:QuarterID,CompanyID;references:ID,CompanyID"`
 	MarketTractions         []MarketTraction        `gorm:"foreignKey:QuarterID,CompanyID;references:ID,CompanyID"`
@@ -28,3 +93,79 @@ type Quarter struct {
 	SelfAssessments         []SelfAssessment        `gorm:"foreignKey:QuarterID,CompanyID;references:ID,CompanyID"`
 	Attachments             []Attachment            `gorm:"foreignKey:QuarterID,CompanyID;references:ID,CompanyID"`
 }
+
+// FounderEditable reports whether founders may still change the numbers.
+func (q *Quarter) FounderEditable() bool {
+	return q.Status == "" || q.Status == QuarterDraft || q.Status == QuarterChangesRequested
+}
+
+// Locked reports whether the numbers are final and nobody may change them.
+func (q *Quarter) Locked() bool {
+	return q.Status == QuarterApproved
+}
+
+// PastDeadline reports whether founders missed the deadline of the quarter.
+// Quarters sent back with changes requested can be fixed after it.
+func (q *Quarter) PastDeadline(now time.Time) bool {
+	return q.Deadline != nil && !now.Before(*q.Deadline) && q.Status != QuarterChangesRequested
+}
+
+// Overdue reports whether the deadline passed before the quarter was submitted.
+func (q *Quarter) Overdue(now time.Time) bool {
+	return q.PastDeadline(now) && (q.Status == "" || q.Status == QuarterDraft)
+}
+
+// QuarterTransition records who moved a quarter to another status and when.
+type QuarterTransition struct {
+	ID        uint   `gorm:"primaryKey"`
+	QuarterID uint   `gorm:"not null;index"`
+	CompanyID uint   `gorm:"not null;index"`
+	Action    string `gorm:"not null"`
+	From      string `gorm:"column:from_status;not null"`
+	To        string `gorm:"column:to_status;not null"`
+	ActorID   uint   `gorm:"not null"`
+	Note      string
+	CreatedAt time.Time
+}
+
+// TransitionQuarter applies the action to the quarter if its current status
+// allows it and records the transition. Two concurrent actions cannot both
+// move the quarter from the same status.
+func TransitionQuarter(tx *gorm.DB, quarter *Quarter, action QuarterAction, actorID uint, note string) error {
+	var current Quarter
+	if err := tx.Select("id", "status").First(&current, quarter.ID).Error; err != nil {
+		return err
+	}
+	from := current.Status
+	if from == "" {
+		from = QuarterDraft
+	}
+	if !slices.Contains(action.From, from) {
+		return ErrInvalidTransition
+	}
+	now := time.Now()
+	result := tx.Model(&Quarter{}).
+		Where("id = ? AND status = ?", quarter.ID, current.Status).
+		Updates(map[string]any{
+			"status":            action.To,
+			"status_changed_at": now,
+			"status_changed_by": actorID,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransition
+	}
+	quarter.Status, quarter.StatusChangedAt, quarter.StatusChangedBy = action.To, &now, &actorID
+	return tx.Create(&QuarterTransition{
+		QuarterID: quarter.ID,
+		CompanyID: quarter.CompanyID,
+		Action:    action.Name,
+		From:      from,
+		To:        action.To,
+		ActorID:   actorID,
+		Note:      note,
+		CreatedAt: now,
+	}).Error
+}
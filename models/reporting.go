@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ReportingPeriod is a quarter the reporting calendar opened for every
+// company. OpenedAt is set when the quarter rows were created and ClosedAt
+// once the deadline passed.
+type ReportingPeriod struct {
+	ID       uint      `gorm:"primaryKey"`
+	Quarter  string    `gorm:"not null;uniqueIndex:idx_reporting_period"`
+	Year     uint      `gorm:"not null;uniqueIndex:idx_reporting_period"`
+	OpensAt  time.Time `gorm:"not null"`
+	Deadline time.Time `gorm:"not null"`
+	OpenedAt time.Time `gorm:"not null"`
+	ClosedAt *time.Time
+}
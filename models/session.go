@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is one signed in device. Access tokens carry its ID and stop working
+// once it is revoked; the refresh token is stored hashed and replaced on every refresh.
+type Session struct {
+	gorm.Model
+	UserID       uint      `gorm:"not null;index"`
+	TokenHash    string    `gorm:"not null;uniqueIndex"`
+	PreviousHash string    `gorm:"index"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	RevokedAt    *time.Time
+	LastUsedAt   time.Time
+	IP           string
+	UserAgent    string
+}
+
+// Active reports whether the session can still be used to refresh or authenticate.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RevokeUserSessions ends every session of a user, signing them out on all devices.
+func RevokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
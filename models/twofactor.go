@@ -0,0 +1,27 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TwoFactorPolicy makes a second factor mandatory at login for every account of a role.
+// Roles without a row leave it up to each user.
+type TwoFactorPolicy struct {
+	Role      string `gorm:"primaryKey"`
+	Required  bool   `gorm:"not null;default:false"`
+	UpdatedBy uint
+	UpdatedAt time.Time
+}
+
+// TwoFactorRequired reports whether accounts of the role must use a second factor.
+func TwoFactorRequired(db *gorm.DB, role string) (bool, error) {
+	var policy TwoFactorPolicy
+	err := db.Where("role = ?", role).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return policy.Required, err
+}
@@ -16,6 +16,11 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	totpPeriod = 60
+	TOTPDigits = otp.DigitsEight
+)
+
 const (
 	timeCost    = 1
 	memoryCost  = 32 * 1024
@@ -33,10 +38,22 @@ type User struct {
 	Password   string
 	Role       string `gorm:"not null"`
 	Approved   bool   `gorm:"default:false"`
-	BackupCode string `gorm:"unique"`
 	TOTPSecret string `gorm:"unique"`
+	TwoFactor  bool   `gorm:"default:false"`
+	VerifiedAt *time.Time
 	StartupID  *uint
 	StartUp    *Company `gorm:"foreignKey:StartupID;references:ID"`
+	// JoinedAt is when the user first joined a company. It stays set after
+	// they leave, so the cleanup of abandoned signups spares them.
+	JoinedAt *time.Time
+}
+
+// CompanyLink are the columns to update to make a user a member of the company.
+func CompanyLink(companyID uint) map[string]any {
+	return map[string]any{
+		"startup_id": companyID,
+		"joined_at":  gorm.Expr("COALESCE(joined_at, ?)", time.Now()),
+	}
 }
 
 func generateResetCode(length int) (string, error) {
@@ -62,23 +79,24 @@ func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	b64Hash := base64.RawStdEncoding.EncodeToString(hash)
 	encoded := fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$%s$%s", memoryCost, timeCost, parallelism, b64Salt, b64Hash)
 	u.Password = encoded
-	if code, err := generateResetCode(12); err != nil {
-		return err
-	} else {
-		u.BackupCode = code
-	}
 	u.CreatedAt = time.Now()
-	if key, err := totp.Generate(totp.GenerateOpts{
+	return u.NewTOTPSecret()
+}
+
+// NewTOTPSecret replaces the TOTP secret, any authenticator set up with the old
+// one stops working.
+func (u *User) NewTOTPSecret() error {
+	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      values.GetConfig().Server.TOTPIssuer,
 		AccountName: u.Email,
-		Period:      60,
-		Digits:      otp.Digits(otp.DigitsEight),
-	}); err != nil {
+		Period:      totpPeriod,
+		Digits:      TOTPDigits,
+	})
+	if err != nil {
 		return err
-	} else {
-		u.TOTPSecret = key.Secret()
 	}
-	return
+	u.TOTPSecret = key.Secret()
+	return nil
 }
 
 func (u *User) SetPassword(password string) (err error) {
@@ -98,8 +116,8 @@ func (u *User) SetPassword(password string) (err error) {
 func (u *User) TOTPUrl() (string, error) {
 	issuer := values.GetConfig().Server.TOTPIssuer
 	if key, err := otp.NewKeyFromURL(
-		fmt.Sprintf("otpauth://totp/%s:%s?secret=%s&issuer=%s",
-			issuer, u.Email, u.TOTPSecret, issuer),
+		fmt.Sprintf("otpauth://totp/%s:%s?secret=%s&issuer=%s&period=%d&digits=%d",
+			issuer, u.Email, u.TOTPSecret, issuer, totpPeriod, TOTPDigits),
 	); err != nil {
 		return "", err
 	} else {
@@ -107,8 +125,16 @@ func (u *User) TOTPUrl() (string, error) {
 	}
 }
 
-func (u *User) VerifyTOTP(otp string) bool {
-	return totp.Validate(otp, u.TOTPSecret)
+// VerifyTOTP checks a code with the same period and length the secret was generated with,
+// allowing one period of clock drift.
+func (u *User) VerifyTOTP(code string) bool {
+	valid, err := totp.ValidateCustom(code, u.TOTPSecret, time.Now().UTC(), totp.ValidateOpts{
+		Period:    totpPeriod,
+		Skew:      1,
+		Digits:    TOTPDigits,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	return err == nil && valid
 }
 
 func (u *User) ComparePassword(password string) error {
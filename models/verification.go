@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// EmailVerification is the open verification link of a user. Only the hash of
+// the token is kept and a user has at most one link at a time.
+type EmailVerification struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;uniqueIndex"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import "gorm.io/gorm"
+
+// VersionLog records who produced each version of a section record and how
+type VersionLog struct {
+	gorm.Model
+	Section   string `gorm:"not null;index:idx_version_log"`
+	CompanyID uint   `gorm:"not null;index:idx_version_log"`
+	QuarterID uint   `gorm:"not null;index:idx_version_log"`
+	Version   uint32 `gorm:"not null"`
+	RecordID  uint   `gorm:"not null"`
+	UserID    uint
+	Action    string `gorm:"not null"`
+}
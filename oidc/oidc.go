@@ -0,0 +1,165 @@
+// Package oidc signs accounts in with OpenID Connect providers using the
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vnestcc/dashboard/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StateExpiry is how long the user has to finish signing in at the provider.
+const StateExpiry = 10 * time.Minute
+
+var (
+	ErrUnknownProvider = errors.New("unknown SSO provider")
+	ErrInvalidState    = errors.New("unknown or expired SSO state")
+)
+
+// pendingLogin is a sign in that was started but not finished yet. The state
+// is only stored hashed, the nonce and PKCE verifier are useless without the
+// code the provider hands to the browser.
+type pendingLogin struct {
+	ID        uint      `gorm:"primaryKey"`
+	StateHash string    `gorm:"not null;uniqueIndex"`
+	Provider  string    `gorm:"not null"`
+	Nonce     string    `gorm:"not null"`
+	Verifier  string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+func (pendingLogin) TableName() string {
+	return "oidc_states"
+}
+
+// Registry holds the configured providers. Pending sign ins are kept in the
+// database so the callback can reach any server instance.
+type Registry struct {
+	db        *gorm.DB
+	providers map[string]*Provider
+	order     []*Provider
+}
+
+func New(cfg config.SSOConfig, db *gorm.DB) (*Registry, error) {
+	if db == nil {
+		return nil, errors.New("SSO needs a database connection")
+	}
+	registry := &Registry{db: db, providers: make(map[string]*Provider, len(cfg.Providers))}
+	for _, providerCfg := range cfg.Providers {
+		provider, err := newProvider(providerCfg)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := registry.providers[provider.Name()]; ok {
+			return nil, fmt.Errorf("the SSO provider %s is configured twice", provider.Name())
+		}
+		registry.providers[provider.Name()] = provider
+		registry.order = append(registry.order, provider)
+	}
+	if err := db.AutoMigrate(&pendingLogin{}); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// Providers returns the providers in the order of the config.
+func (r *Registry) Providers() []*Provider {
+	if r == nil {
+		return nil
+	}
+	return r.order
+}
+
+func (r *Registry) Provider(name string) (*Provider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// Begin starts a sign in with the provider and returns the URL to send the
+// browser to and the state, which the caller has to tie to the browser so a
+// sign in cannot be finished in another one.
+func (r *Registry) Begin(ctx context.Context, name string) (string, string, error) {
+	provider, ok := r.Provider(name)
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	var secrets [3]string
+	for i := range secrets {
+		var err error
+		if secrets[i], err = randomString(); err != nil {
+			return "", "", err
+		}
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+	challenge := sha256.Sum256([]byte(verifier))
+	authURL, err := provider.authURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", "", err
+	}
+	err = r.db.WithContext(ctx).Create(&pendingLogin{
+		StateHash: hashState(state),
+		Provider:  provider.Name(),
+		Nonce:     nonce,
+		Verifier:  verifier,
+		ExpiresAt: time.Now().Add(StateExpiry),
+	}).Error
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// Finish completes a sign in with the code and state the provider redirected
+// back with. A state works once, also when the exchange fails.
+func (r *Registry) Finish(ctx context.Context, name, code, state string) (*Provider, Identity, error) {
+	provider, ok := r.Provider(name)
+	if !ok {
+		return nil, Identity{}, ErrUnknownProvider
+	}
+	var claimed []pendingLogin
+	err := r.db.WithContext(ctx).Clauses(clause.Returning{}).
+		Where("state_hash = ? AND provider = ? AND expires_at > ?", hashState(state), provider.Name(), time.Now()).
+		Delete(&claimed).Error
+	if err != nil {
+		return provider, Identity{}, err
+	}
+	if len(claimed) != 1 {
+		return provider, Identity{}, ErrInvalidState
+	}
+	identity, err := provider.exchange(ctx, code, claimed[0].Verifier, claimed[0].Nonce)
+	return provider, identity, err
+}
+
+// Prune drops sign ins that were never finished.
+func (r *Registry) Prune(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	return r.db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&pendingLogin{}).Error
+}
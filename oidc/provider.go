@@ -0,0 +1,303 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vnestcc/dashboard/config"
+)
+
+const (
+	httpTimeout = 10 * time.Second
+	// keyRefresh is how often an unknown key id may trigger a new JWKS fetch
+	keyRefresh = time.Minute
+	// maxResponse caps what is read from the provider
+	maxResponse = 1 << 20
+)
+
+var (
+	ErrEmailNotVerified = errors.New("the provider did not confirm the email address")
+	signingMethods      = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+)
+
+// Identity is what a provider vouches for after a successful sign in.
+type Identity struct {
+	Subject string
+	Email   string
+	Name    string
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Email           string `json:"email"`
+	EmailVerified   any    `json:"email_verified"`
+	Name            string `json:"name"`
+}
+
+// Provider is one OpenID Connect identity provider. The discovery document
+// and the signing keys are fetched on first use, so a provider that is down
+// does not keep the server from starting.
+type Provider struct {
+	cfg    config.OIDCProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        map[string]any
+	keysFetched time.Time
+}
+
+func newProvider(cfg config.OIDCProviderConfig) (*Provider, error) {
+	if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("an SSO provider needs a name, issuer, client-id and redirect-url")
+	}
+	if url.PathEscape(cfg.Name) != cfg.Name {
+		return nil, fmt.Errorf("the SSO provider name %q cannot be used in a URL", cfg.Name)
+	}
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = cfg.Name
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	} else if !slices.Contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	if len(cfg.Roles) == 0 {
+		cfg.Roles = []string{"vc"}
+	}
+	domains := make([]string, 0, len(cfg.AutoApproveDomains))
+	for _, domain := range cfg.AutoApproveDomains {
+		domains = append(domains, strings.ToLower(strings.TrimPrefix(domain, "@")))
+	}
+	cfg.AutoApproveDomains = domains
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: httpTimeout}}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) DisplayName() string {
+	return p.cfg.DisplayName
+}
+
+// Signup reports whether unknown emails get a pending VC account.
+func (p *Provider) Signup() bool {
+	return p.cfg.Signup
+}
+
+// AllowsRole reports whether accounts with the role may sign in with the provider.
+func (p *Provider) AllowsRole(role string) bool {
+	return slices.Contains(p.cfg.Roles, role)
+}
+
+// AutoApproves reports whether a VC account created with the email is approved
+// without waiting for an admin. It only applies at signup, so an account an
+// admin removed stays removed.
+func (p *Provider) AutoApproves(email string) bool {
+	at := strings.LastIndex(email, "@")
+	return at >= 0 && slices.Contains(p.cfg.AutoApproveDomains, strings.ToLower(email[at+1:]))
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", endpoint, res.Status)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponse)).Decode(v)
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	var meta metadata
+	if err := p.getJSON(ctx, strings.TrimRight(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("discovery for %s: %w", p.cfg.Name, err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != strings.TrimRight(p.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("discovery for %s: issuer %q does not match the configured %q", p.cfg.Name, meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery for %s: the document is missing endpoints", p.cfg.Name)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns the signing key with the id, fetching the key set again when
+// the provider rotated its keys.
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keyRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var set jwkSet
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching keys for %s: %w", p.cfg.Name, err)
+	}
+	p.keys = set.publicKeys()
+	p.keysFetched = time.Now()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey allows a token without a key id when the set has a single key.
+func (p *Provider) lookupKey(kid string) (any, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// authURL is where the browser is sent to sign in.
+func (p *Provider) authURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	endpoint, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// exchange trades the authorization code for an ID token and verifies it.
+func (p *Provider) exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer res.Body.Close()
+	var tokens tokenResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponse)).Decode(&tokens); err != nil && res.StatusCode == http.StatusOK {
+		return Identity{}, fmt.Errorf("token response from %s: %w", p.cfg.Name, err)
+	}
+	if res.StatusCode != http.StatusOK || tokens.Error != "" {
+		return Identity{}, fmt.Errorf("token request to %s failed: %s %s %s", p.cfg.Name, res.Status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return Identity{}, fmt.Errorf("%s returned no id_token", p.cfg.Name)
+	}
+	return p.verify(ctx, meta, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, meta *metadata, raw, nonce string) (Identity, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid id_token from %s: %w", p.cfg.Name, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return Identity{}, fmt.Errorf("invalid id_token from %s: nonce mismatch", p.cfg.Name)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return Identity{}, fmt.Errorf("invalid id_token from %s: issued to %q", p.cfg.Name, claims.AuthorizedParty)
+	}
+	if claims.Subject == "" || claims.Email == "" {
+		return Identity{}, fmt.Errorf("the id_token from %s has no subject or email, is the email scope allowed?", p.cfg.Name)
+	}
+	// some providers send the flag as a string
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+	if !verified && !p.cfg.TrustEmail {
+		return Identity{}, ErrEmailNotVerified
+	}
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return Identity{}, fmt.Errorf("invalid id_token from %s: %q is not an email address", p.cfg.Name, claims.Email)
+	}
+	return Identity{
+		Subject: claims.Subject,
+		Email:   email,
+		Name:    claims.Name,
+	}, nil
+}
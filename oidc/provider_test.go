@@ -0,0 +1,287 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vnestcc/dashboard/config"
+)
+
+const (
+	testClientID = "dashboard"
+	testCode     = "code"
+	testVerifier = "verifier"
+	testNonce    = "nonce"
+)
+
+// mockIssuer is an identity provider serving discovery, its key set and a
+// token endpoint that hands out whatever ID token the test set.
+type mockIssuer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	keys     map[string]*rsa.PrivateKey
+	idToken  string
+	jwksHits int
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	m := &mockIssuer{keys: map[string]*rsa.PrivateKey{"k1": newKey(t)}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(metadata{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			JWKSURI:               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.jwksHits++
+		var set jwkSet
+		for kid, key := range m.keys {
+			set.Keys = append(set.Keys, jwk{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, _, _ := r.BasicAuth()
+		if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code") != testCode ||
+			r.PostFormValue("code_verifier") != testVerifier || clientID != testClientID {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant"})
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		json.NewEncoder(w).Encode(tokenResponse{IDToken: m.idToken})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func newKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// claims are those of a valid ID token for the test client.
+func (m *mockIssuer) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            m.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"email":          "Jane@Example.com",
+		"email_verified": true,
+		"name":           "Jane",
+		"nonce":          testNonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+// issue makes the token endpoint return an ID token with the claims, signed
+// with the key given by id.
+func (m *mockIssuer) issue(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.idToken = signed
+	m.mu.Unlock()
+}
+
+func (m *mockIssuer) provider(t *testing.T) *Provider {
+	t.Helper()
+	p, err := newProvider(config.OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       m.URL,
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:3000/sso/mock/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	tests := []struct {
+		name    string
+		change  func(jwt.MapClaims)
+		code    string
+		nonce   string
+		want    Identity
+		wantErr error
+	}{
+		{
+			name: "valid",
+			want: Identity{Subject: "user-1", Email: "jane@example.com", Name: "Jane"},
+		},
+		{
+			name:   "email_verified as a string",
+			change: func(c jwt.MapClaims) { c["email_verified"] = "true" },
+			want:   Identity{Subject: "user-1", Email: "jane@example.com", Name: "Jane"},
+		},
+		{
+			name:    "wrong audience",
+			change:  func(c jwt.MapClaims) { c["aud"] = "other-client" },
+			wantErr: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:   "also issued to another client",
+			change: func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other-client"}; c["azp"] = "other-client" },
+		},
+		{
+			name:    "wrong issuer",
+			change:  func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			wantErr: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name:    "expired",
+			change:  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+			wantErr: jwt.ErrTokenExpired,
+		},
+		{
+			name:  "nonce mismatch",
+			nonce: "another-nonce",
+		},
+		{
+			name:    "email not verified",
+			change:  func(c jwt.MapClaims) { c["email_verified"] = false },
+			wantErr: ErrEmailNotVerified,
+		},
+		{
+			name:    "email_verified missing",
+			change:  func(c jwt.MapClaims) { delete(c, "email_verified") },
+			wantErr: ErrEmailNotVerified,
+		},
+		{
+			name:   "not an email",
+			change: func(c jwt.MapClaims) { c["email"] = "Jane <jane@example.com>" },
+		},
+		{
+			name: "code rejected",
+			code: "stolen",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.claims()
+			if tt.change != nil {
+				tt.change(claims)
+			}
+			issuer.issue(t, issuer.keys["k1"], "k1", claims)
+			code, nonce := tt.code, tt.nonce
+			if code == "" {
+				code = testCode
+			}
+			if nonce == "" {
+				nonce = testNonce
+			}
+			got, err := issuer.provider(t).exchange(context.Background(), code, testVerifier, nonce)
+			if tt.want == (Identity{}) {
+				if err == nil {
+					t.Fatalf("exchange() = %+v, want an error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("exchange() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchange() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("exchange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeTrustEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+	claims := issuer.claims()
+	delete(claims, "email_verified")
+	issuer.issue(t, issuer.keys["k1"], "k1", claims)
+	p := issuer.provider(t)
+	p.cfg.TrustEmail = true
+	if _, err := p.exchange(context.Background(), testCode, testVerifier, testNonce); err != nil {
+		t.Fatalf("exchange() with trust-email failed: %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	issuer := newMockIssuer(t)
+	p := issuer.provider(t)
+	exchange := func(key *rsa.PrivateKey, kid string) error {
+		issuer.issue(t, key, kid, issuer.claims())
+		_, err := p.exchange(context.Background(), testCode, testVerifier, testNonce)
+		return err
+	}
+	oldKey := issuer.keys["k1"]
+	if err := exchange(oldKey, "k1"); err != nil {
+		t.Fatalf("exchange() with the published key failed: %v", err)
+	}
+
+	rotated := newKey(t)
+	issuer.mu.Lock()
+	issuer.keys = map[string]*rsa.PrivateKey{"k2": rotated}
+	issuer.mu.Unlock()
+
+	// an unknown key id right after a fetch must not make every token hit the provider
+	if err := exchange(rotated, "k2"); err == nil {
+		t.Fatal("exchange() with a new key id within the refresh interval passed, want an error")
+	}
+	if issuer.jwksHits != 1 {
+		t.Fatalf("the key set was fetched %d times, want 1", issuer.jwksHits)
+	}
+
+	p.keysFetched = time.Now().Add(-keyRefresh)
+	if err := exchange(rotated, "k2"); err != nil {
+		t.Fatalf("exchange() with the rotated key failed: %v", err)
+	}
+	if issuer.jwksHits != 2 {
+		t.Fatalf("the key set was fetched %d times, want 2", issuer.jwksHits)
+	}
+	if err := exchange(oldKey, "k1"); err == nil {
+		t.Fatal("exchange() with a retired key passed, want an error")
+	}
+
+	// a token signed with a key that is not the one its id names
+	if err := exchange(oldKey, "k2"); err == nil {
+		t.Fatal("exchange() with a forged signature passed, want an error")
+	}
+}
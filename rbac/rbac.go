@@ -0,0 +1,236 @@
+// Package rbac maps roles to the permissions routes and handlers check, so
+// that adding a role means describing it here or in the config instead of
+// editing every handler that used to compare role names.
+package rbac
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync/atomic"
+
+	"github.com/vnestcc/dashboard/config"
+)
+
+type Permission string
+
+const (
+	CompanyRead           Permission = "company.read"
+	CompanyReadFull       Permission = "company.read.full"
+	CompanyOwnManage      Permission = "company.own.manage"
+	CompanyManage         Permission = "company.manage"
+	CompanyHistoryEditors Permission = "company.history.editors"
+	MetricsRead           Permission = "metrics.read"
+	PortfolioRead         Permission = "portfolio.read"
+	QuarterOpen           Permission = "quarter.open"
+	QuarterReview         Permission = "quarter.review"
+	QuarterUnlock         Permission = "quarter.unlock"
+	ComplianceRead        Permission = "compliance.read"
+	ProfileManage         Permission = "profile.manage"
+	TokenManage           Permission = "token.manage"
+	TokenAdmin            Permission = "token.admin"
+	VCApprove             Permission = "vc.approve"
+	VCAssign              Permission = "vc.assign"
+	UserManage            Permission = "user.manage"
+	StaffManage           Permission = "staff.manage"
+	AuditRead             Permission = "audit.read"
+	SecurityManage        Permission = "security.manage"
+	RBACRead              Permission = "rbac.read"
+)
+
+// Permissions describes every permission, in the order they are listed.
+var Permissions = []struct {
+	Name        Permission
+	Description string
+}{
+	{CompanyRead, "View companies, only the fields they made visible unless combined with company.read.full"},
+	{CompanyReadFull, "View every field of every company"},
+	{CompanyOwnManage, "Create, join, edit and delete your own company and its quarters"},
+	{CompanyManage, "List, edit, delete and roll back any company and set its field permissions"},
+	{CompanyHistoryEditors, "See who made each change in the history of a company"},
+	{MetricsRead, "Read company KPI and metric series"},
+	{PortfolioRead, "Browse the companies assigned to you as a VC"},
+	{QuarterOpen, "Open and close quarters for companies"},
+	{QuarterReview, "Review submitted quarters, request changes and approve them"},
+	{QuarterUnlock, "Reopen approved quarters so they can be changed again"},
+	{ComplianceRead, "See which companies filled in which sections of a quarter and who is overdue"},
+	{ProfileManage, "Edit or delete your own founder profile"},
+	{TokenManage, "Create and revoke your own API tokens"},
+	{TokenAdmin, "Manage every API token and the service accounts"},
+	{VCApprove, "List, approve, unapprove and delete VC accounts"},
+	{VCAssign, "Assign companies to VCs"},
+	{UserManage, "List and delete founder accounts"},
+	{StaffManage, "Invite, list and revoke staff accounts"},
+	{AuditRead, "Read the audit log"},
+	{SecurityManage, "Set 2FA policies and lift sign in lockouts"},
+	{RBACRead, "View the roles and their permissions"},
+}
+
+const (
+	RoleUser      = "user"
+	RoleVC        = "vc"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	// RoleService is the role of requests made with a service account token.
+	RoleService = "service"
+)
+
+// Role is what an account of the role may do. Staff roles sign in through the
+// admin login and are invited. Roles with Approval only work while the account
+// is approved. Machine roles never sign in.
+type Role struct {
+	Name        string       `json:"name" example:"moderator"`
+	Staff       bool         `json:"staff" example:"true"`
+	Approval    bool         `json:"approval" example:"true"`
+	Machine     bool         `json:"machine" example:"false"`
+	Permissions []Permission `json:"permissions" example:"company.read,company.manage"`
+}
+
+var defaultRoles = []Role{
+	{
+		Name:        RoleUser,
+		Permissions: []Permission{CompanyRead, CompanyOwnManage, MetricsRead, ProfileManage, TokenManage},
+	},
+	{
+		Name:        RoleVC,
+		Approval:    true,
+		Permissions: []Permission{CompanyRead, MetricsRead, PortfolioRead, TokenManage},
+	},
+	{
+		Name:        RoleModerator,
+		Staff:       true,
+		Approval:    true,
+		Permissions: []Permission{CompanyRead, CompanyManage, CompanyHistoryEditors, MetricsRead, QuarterOpen, QuarterReview, ComplianceRead, TokenManage},
+	},
+	{
+		Name:  RoleAdmin,
+		Staff: true,
+		Permissions: []Permission{
+			CompanyRead, CompanyReadFull, CompanyManage, CompanyHistoryEditors, MetricsRead, QuarterOpen, QuarterReview, QuarterUnlock,
+			ComplianceRead, TokenManage, TokenAdmin, VCApprove, VCAssign, UserManage, StaffManage, AuditRead, SecurityManage, RBACRead,
+		},
+	},
+	{
+		Name:        RoleService,
+		Machine:     true,
+		Permissions: []Permission{CompanyRead, MetricsRead},
+	},
+}
+
+type policy struct {
+	roles  []Role
+	byName map[string]*Role
+}
+
+var current atomic.Pointer[policy]
+
+func init() {
+	current.Store(newPolicy(defaultRoles))
+}
+
+func newPolicy(roles []Role) *policy {
+	p := &policy{roles: roles, byName: make(map[string]*Role, len(roles))}
+	for i := range p.roles {
+		p.byName[p.roles[i].Name] = &p.roles[i]
+	}
+	return p
+}
+
+func knownPermission(perm Permission) bool {
+	for _, p := range Permissions {
+		if p.Name == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Load applies the roles of the config on top of the built in ones. A built in
+// role keeps its kind and only gets its permissions replaced; a new role is
+// added with the staff flag of the config, and staff roles need approval.
+func Load(cfg map[string]config.RoleConfig) error {
+	roles := make([]Role, len(defaultRoles))
+	for i, role := range defaultRoles {
+		role.Permissions = slices.Clone(role.Permissions)
+		roles[i] = role
+	}
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		roleCfg := cfg[name]
+		permissions := make([]Permission, 0, len(roleCfg.Permissions))
+		for _, perm := range roleCfg.Permissions {
+			if !knownPermission(Permission(perm)) {
+				return fmt.Errorf("role %s: unknown permission %q", name, perm)
+			}
+			permissions = append(permissions, Permission(perm))
+		}
+		idx := slices.IndexFunc(roles, func(r Role) bool { return r.Name == name })
+		if idx >= 0 {
+			roles[idx].Permissions = permissions
+			continue
+		}
+		roles = append(roles, Role{
+			Name:        name,
+			Staff:       roleCfg.Staff,
+			Approval:    roleCfg.Staff,
+			Permissions: permissions,
+		})
+	}
+	current.Store(newPolicy(roles))
+	return nil
+}
+
+// Can reports whether accounts of the role have the permission.
+func Can(role string, perm Permission) bool {
+	r, ok := current.Load().byName[role]
+	return ok && slices.Contains(r.Permissions, perm)
+}
+
+// Roles returns every role in a stable order.
+func Roles() []Role {
+	return slices.Clone(current.Load().roles)
+}
+
+func Lookup(role string) (Role, bool) {
+	r, ok := current.Load().byName[role]
+	if !ok {
+		return Role{}, false
+	}
+	return *r, true
+}
+
+func filterRoles(keep func(Role) bool) []string {
+	var names []string
+	for _, r := range current.Load().roles {
+		if keep(r) {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+// SignInRoles are the roles accounts can sign in with.
+func SignInRoles() []string {
+	return filterRoles(func(r Role) bool { return !r.Machine })
+}
+
+// StaffRoles sign in through the admin login.
+func StaffRoles() []string {
+	return filterRoles(func(r Role) bool { return r.Staff })
+}
+
+// InvitableRoles are the staff roles given out with an invite. Admins are
+// only created from the command line.
+func InvitableRoles() []string {
+	return filterRoles(func(r Role) bool { return r.Staff && r.Name != RoleAdmin })
+}
+
+// NeedsApproval reports whether accounts of the role only work while approved.
+func NeedsApproval(role string) bool {
+	r, ok := current.Load().byName[role]
+	return ok && r.Approval
+}
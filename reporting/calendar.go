@@ -0,0 +1,99 @@
+// Package reporting opens reporting quarters on a calendar, so founders can
+// report without a moderator opening every quarter by hand.
+package reporting
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vnestcc/dashboard/config"
+)
+
+const (
+	defaultOpenDay      = 1
+	defaultDeadlineDays = 30
+	defaultRemindDays   = 3
+)
+
+// Period is the window in which founders report on a quarter that ended.
+type Period struct {
+	Quarter  string
+	Year     uint
+	OpensAt  time.Time
+	Deadline time.Time
+}
+
+// Calendar places the reporting periods. Reporting on a quarter opens on
+// OpenDay of the month after it ended and closes DeadlineDays later.
+type Calendar struct {
+	openDay      int
+	deadlineDays int
+	remindDays   int
+	location     *time.Location
+}
+
+func NewCalendar(cfg config.ReportingConfig) (Calendar, error) {
+	cal := Calendar{openDay: cfg.OpenDay, deadlineDays: cfg.DeadlineDays, remindDays: cfg.RemindDays, location: time.UTC}
+	if cal.openDay == 0 {
+		cal.openDay = defaultOpenDay
+	}
+	if cal.deadlineDays == 0 {
+		cal.deadlineDays = defaultDeadlineDays
+	}
+	if cal.remindDays == 0 {
+		cal.remindDays = defaultRemindDays
+	}
+	if cal.openDay < 1 || cal.openDay > 28 {
+		return Calendar{}, fmt.Errorf("reporting open-day must be between 1 and 28, got %d", cal.openDay)
+	}
+	if cal.deadlineDays < 1 {
+		return Calendar{}, fmt.Errorf("reporting deadline-days must be positive, got %d", cal.deadlineDays)
+	}
+	if cfg.Timezone != "" {
+		location, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return Calendar{}, fmt.Errorf("reporting timezone: %w", err)
+		}
+		cal.location = location
+	}
+	return cal, nil
+}
+
+// period returns the reporting period of the quarter that ends when the
+// quarter starting at start begins.
+func (c Calendar) period(start time.Time) Period {
+	ended := start.AddDate(0, -3, 0)
+	opensAt := start.AddDate(0, 0, c.openDay-1)
+	return Period{
+		Quarter:  fmt.Sprintf("Q%d", (int(ended.Month())-1)/3+1),
+		Year:     uint(ended.Year()),
+		OpensAt:  opensAt,
+		Deadline: opensAt.AddDate(0, 0, c.deadlineDays),
+	}
+}
+
+// Recent returns the periods of the last two quarters that ended, oldest
+// first. A long deadline can keep the older one open past the start of the
+// newer one.
+func (c Calendar) Recent(now time.Time) []Period {
+	local := now.In(c.location)
+	start := time.Date(local.Year(), time.Month((int(local.Month())-1)/3*3+1), 1, 0, 0, 0, 0, c.location)
+	return []Period{c.period(start.AddDate(0, -3, 0)), c.period(start)}
+}
+
+// Next returns the next period that opens after now.
+func (c Calendar) Next(now time.Time) Period {
+	local := now.In(c.location)
+	start := time.Date(local.Year(), time.Month((int(local.Month())-1)/3*3+1), 1, 0, 0, 0, 0, c.location)
+	for {
+		if p := c.period(start); p.OpensAt.After(now) {
+			return p
+		}
+		start = start.AddDate(0, 3, 0)
+	}
+}
+
+// local returns the time in the timezone of the calendar.
+func (c Calendar) local(t time.Time) time.Time {
+	return t.In(c.location)
+}
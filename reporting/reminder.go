@@ -0,0 +1,64 @@
+package reporting
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/mailer"
+	"github.com/vnestcc/dashboard/models"
+	"gorm.io/gorm"
+)
+
+// SendDeadlineReminders mails the founders of quarters still in draft whose
+// deadline is at most the configured number of days away. Each deadline is
+// reminded of once, moving it sends a new reminder.
+func SendDeadlineReminders(ctx context.Context, db *gorm.DB, mail *mailer.Mailer, cal Calendar, now time.Time, log *logrus.Entry) error {
+	if cal.remindDays < 0 {
+		return nil
+	}
+	var quarters []models.Quarter
+	if err := db.Where("status = ? AND reminder_sent_at IS NULL AND deadline > ? AND deadline <= ?", models.QuarterDraft, now, now.AddDate(0, 0, cal.remindDays)).
+		Find(&quarters).Error; err != nil {
+		return err
+	}
+	for _, quarter := range quarters {
+		recipients, err := founders(db, quarter.CompanyID)
+		if err != nil {
+			return err
+		}
+		due := formatDeadline(cal.local(*quarter.Deadline))
+		failed := 0
+		for _, founder := range recipients {
+			err := mail.Enqueue(ctx, founder.Email, mailer.TemplateDeadlineReminder, mailer.DeadlineReminderData{
+				Name:     founder.Name,
+				Company:  founder.Company,
+				Quarter:  quarter.Quarter,
+				Year:     quarter.Year,
+				Deadline: due,
+				Link:     mail.Link(""),
+			})
+			if err != nil {
+				failed++
+				log.WithFields(logrus.Fields{
+					"status":     "failure",
+					"reason":     "mail_queue_failed",
+					"company_id": quarter.CompanyID,
+					"email":      founder.Email,
+					"error":      err.Error(),
+				}).Error("Failed to queue deadline reminder")
+			}
+		}
+		if err := db.Model(&models.Quarter{}).Where("id = ?", quarter.ID).Update("reminder_sent_at", now).Error; err != nil {
+			return err
+		}
+		log.WithFields(logrus.Fields{
+			"status":     "success",
+			"company_id": quarter.CompanyID,
+			"quarter":    quarter.Quarter,
+			"year":       quarter.Year,
+			"recipients": len(recipients) - failed,
+		}).Info("Founders reminded of the deadline")
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package reporting
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/mailer"
+	"github.com/vnestcc/dashboard/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeadlineFormat is how deadlines are written in mails.
+const DeadlineFormat = "January 2, 2006"
+
+// Run opens the periods of the calendar that are due and closes the ones past
+// their deadline. Running it again changes nothing, so it can run as often as
+// wanted and on more than one instance.
+func Run(ctx context.Context, db *gorm.DB, mail *mailer.Mailer, cal Calendar, now time.Time, log *logrus.Entry) error {
+	for _, p := range cal.Recent(now) {
+		if now.Before(p.OpensAt) {
+			continue
+		}
+		var period models.ReportingPeriod
+		err := db.Where("quarter = ? AND year = ?", p.Quarter, p.Year).First(&period).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// a calendar enabled after the deadline leaves the quarter alone
+			if !now.Before(p.Deadline) {
+				continue
+			}
+			period = models.ReportingPeriod{Quarter: p.Quarter, Year: p.Year, OpensAt: p.OpensAt, Deadline: p.Deadline, OpenedAt: now}
+			if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&period).Error; err != nil {
+				return err
+			}
+			err = db.Where("quarter = ? AND year = ?", p.Quarter, p.Year).First(&period).Error
+		}
+		if err != nil {
+			return err
+		}
+		if period.ClosedAt != nil {
+			continue
+		}
+		periodLog := log.WithFields(logrus.Fields{"quarter": period.Quarter, "year": period.Year})
+		if now.Before(period.Deadline) {
+			err = openPeriod(ctx, db, mail, cal, &period, now, periodLog)
+		} else {
+			err = closePeriod(db, &period, now, periodLog)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openPeriod creates the quarter of the period for every company that has
+// none yet, which are all of them on the first run and new companies after.
+func openPeriod(ctx context.Context, db *gorm.DB, mail *mailer.Mailer, cal Calendar, period *models.ReportingPeriod, now time.Time, log *logrus.Entry) error {
+	var companyIDs []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// soft deleted quarters count too, they still hold the unique index
+		if err := tx.Model(&models.Company{}).
+			Where("NOT EXISTS (SELECT 1 FROM quarters WHERE quarters.company_id = companies.id AND quarters.quarter = ? AND quarters.year = ?)", period.Quarter, period.Year).
+			Pluck("id", &companyIDs).Error; err != nil {
+			return err
+		}
+		if len(companyIDs) == 0 {
+			return nil
+		}
+		deadline := period.Deadline
+		quarters := make([]models.Quarter, 0, len(companyIDs))
+		for _, companyID := range companyIDs {
+			quarters = append(quarters, models.Quarter{
+				CompanyID: companyID,
+				Quarter:   period.Quarter,
+				Year:      period.Year,
+				Date:      now,
+				Status:    models.QuarterDraft,
+				Deadline:  &deadline,
+			})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&quarters).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Company{}).Where("id IN ?", companyIDs).Updates(map[string]any{
+			"planned_quarter": period.Quarter,
+			"planned_year":    period.Year,
+		}).Error
+	})
+	if err != nil || len(companyIDs) == 0 {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"status":    "success",
+		"companies": len(companyIDs),
+		"deadline":  period.Deadline.Format(time.RFC3339),
+	}).Info("Reporting quarter opened")
+	deadline := cal.local(period.Deadline)
+	NotifyQuarterOpened(ctx, db, mail, log, period.Quarter, period.Year, &deadline, companyIDs...)
+	return nil
+}
+
+// closePeriod stops offering the period to companies once its deadline passed.
+// Companies a moderator opened the quarter for by hand keep it.
+func closePeriod(db *gorm.DB, period *models.ReportingPeriod, now time.Time, log *logrus.Entry) error {
+	result := db.Model(&models.Company{}).
+		Where("planned_quarter = ? AND planned_year = ?", period.Quarter, period.Year).
+		Where("NOT EXISTS (SELECT 1 FROM quarters WHERE quarters.company_id = companies.id AND quarters.quarter = ? AND quarters.year = ? AND quarters.deadline IS NULL AND quarters.deleted_at IS NULL)", period.Quarter, period.Year).
+		Updates(map[string]any{
+			"planned_quarter": nil,
+			"planned_year":    nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if err := db.Model(period).Update("closed_at", now).Error; err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"status":    "success",
+		"companies": result.RowsAffected,
+	}).Info("Reporting quarter closed")
+	return nil
+}
+
+type founderRecipient struct {
+	Name    string
+	Email   string
+	Company string
+}
+
+// founders returns the members of the companies, or of every company without
+// company IDs.
+func founders(db *gorm.DB, companyIDs ...uint) ([]founderRecipient, error) {
+	query := db.Table("users").
+		Select("users.name, users.email, companies.name AS company").
+		Joins("JOIN companies ON companies.id = users.startup_id AND companies.deleted_at IS NULL").
+		Where("users.role = ? AND users.deleted_at IS NULL", "user")
+	if len(companyIDs) > 0 {
+		query = query.Where("companies.id IN ?", companyIDs)
+	}
+	var recipients []founderRecipient
+	err := query.Scan(&recipients).Error
+	return recipients, err
+}
+
+// formatDeadline writes the last day before the deadline, deadlines are the
+// start of the day after it.
+func formatDeadline(deadline time.Time) string {
+	return deadline.Add(-time.Second).Format(DeadlineFormat)
+}
+
+// NotifyQuarterOpened queues an email to the founders of the companies that
+// can now fill in the quarter. Without company IDs every company is notified.
+// Failures are only logged, the quarter is open either way.
+func NotifyQuarterOpened(ctx context.Context, db *gorm.DB, mail *mailer.Mailer, log *logrus.Entry, quarter string, year uint, deadline *time.Time, companyIDs ...uint) {
+	recipients, err := founders(db, companyIDs...)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_query_failed",
+			"error":  err.Error(),
+		}).Error("Failed to find founders to notify")
+		return
+	}
+	due := ""
+	if deadline != nil {
+		due = formatDeadline(*deadline)
+	}
+	failed := 0
+	for _, founder := range recipients {
+		err := mail.Enqueue(ctx, founder.Email, mailer.TemplateQuarterOpened, mailer.QuarterOpenedData{
+			Name:     founder.Name,
+			Company:  founder.Company,
+			Quarter:  quarter,
+			Year:     year,
+			Deadline: due,
+			Link:     mail.Link(""),
+		})
+		if err != nil {
+			failed++
+			log.WithFields(logrus.Fields{
+				"status": "failure",
+				"reason": "mail_queue_failed",
+				"email":  founder.Email,
+				"error":  err.Error(),
+			}).Error("Failed to queue quarter opened mail")
+		}
+	}
+	log.WithFields(logrus.Fields{
+		"status":     "success",
+		"recipients": len(recipients) - failed,
+	}).Info("Founders notified of the opened quarter")
+}
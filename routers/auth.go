@@ -3,18 +3,45 @@ package routers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/vnestcc/dashboard/handlers"
+	middleware "github.com/vnestcc/dashboard/utils/middlewares"
 )
 
 func loadAuth(r *gin.RouterGroup) {
 	authRouter := r.Group("/auth")
 	authRouter.POST("/forgot-password", handlers.ForgotPassword)
 	authRouter.POST("/reset-password/:token", handlers.ResetPassword)
+	authRouter.POST("/verify-email", handlers.VerifyEmail)
+	authRouter.POST("/verify-email/resend", handlers.ResendVerification)
+	authRouter.POST("/refresh", handlers.RefreshTokenHandler)
+	authRouter.POST("/logout", middleware.JWTVerifyHandler, handlers.LogoutHandler)
+	authRouter.POST("/logout-all", middleware.JWTVerifyHandler, handlers.LogoutAllHandler)
+
+	loadTwoFactor(authRouter)
+	loadSSO(authRouter)
 
 	loadUserAuth(authRouter)
 	loadVCAuth(authRouter)
+	loadModeratorAuth(authRouter)
 	loadAdminAuth(authRouter)
 }
 
+func loadTwoFactor(r *gin.RouterGroup) {
+	authRouter := r.Group("/2fa")
+	authRouter.POST("/verify", handlers.VerifyTwoFactor)
+	authRouter.GET("/setup", middleware.JWTVerifyHandler, handlers.TwoFactorSetup)
+	authRouter.POST("/enable", middleware.JWTVerifyHandler, handlers.EnableTwoFactor)
+	authRouter.POST("/disable", middleware.JWTVerifyHandler, handlers.DisableTwoFactor)
+	authRouter.GET("/backup-codes", middleware.JWTVerifyHandler, handlers.GetBackupCodes)
+	authRouter.POST("/backup-codes", middleware.JWTVerifyHandler, handlers.RegenerateBackupCodes)
+}
+
+func loadSSO(r *gin.RouterGroup) {
+	authRouter := r.Group("/sso")
+	authRouter.GET("", handlers.GetSSOProviders)
+	authRouter.GET("/:provider", handlers.StartSSO)
+	authRouter.POST("/:provider/callback", handlers.SSOCallback)
+}
+
 func loadUserAuth(r *gin.RouterGroup) {
 	authRouter := r.Group("/user")
 	authRouter.POST("/signup", handlers.UserSignupHandler)
@@ -27,6 +54,11 @@ func loadVCAuth(r *gin.RouterGroup) {
 	authRouter.POST("/login", handlers.VCLoginHandler)
 }
 
+func loadModeratorAuth(r *gin.RouterGroup) {
+	authRouter := r.Group("/moderator")
+	authRouter.POST("/signup", handlers.ModeratorSignupHandler)
+}
+
 func loadAdminAuth(r *gin.RouterGroup) {
 	authRouter := r.Group("/admin")
 	authRouter.POST("/login", handlers.AdminLoginHandler)
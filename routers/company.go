@@ -3,23 +3,39 @@ package routers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/vnestcc/dashboard/handlers/company"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/rbac"
 	middleware "github.com/vnestcc/dashboard/utils/middlewares"
 )
 
 func loadCompanies(r *gin.RouterGroup) {
 	companyRouter := r.Group("/company")
 
-	companyRouter.GET("/me", append(middleware.UserMiddleware, company.UserCompany)...)
-	companyRouter.GET("/:id", middleware.JWTVerifyHandler, company.GetCompanyByID)
+	companyRouter.GET("/me", append(middleware.Require(rbac.CompanyOwnManage), company.UserCompany)...)
+	companyRouter.GET("/:id", append(middleware.RequireScoped(rbac.CompanyRead, models.ScopeCompanyRead), company.GetCompanyByID)...)
 	companyRouter.GET("/list", company.ListCompany)
+	companyRouter.GET("/taxonomy", company.GetTaxonomy)
 	companyRouter.GET("/quarters/:id", company.ListQuater)
-	companyRouter.POST("/quarters/add", append(middleware.UserMiddleware, company.AddQuarter)...)
-	companyRouter.POST("/create", append(middleware.UserMiddleware, company.CreateCompany)...)
-	companyRouter.PUT("/edit", append(middleware.UserMiddleware, company.EditCompany)...)
-	companyRouter.DELETE("/delete", append(middleware.UserMiddleware, company.DeleteCompany)...)
-	companyRouter.POST("/join/:id", append(middleware.UserMiddleware, company.JoinCompany)...)
-	companyRouter.GET("/perms/:id/visible")
-	companyRouter.GET("/perms/editable")
+	companyRouter.POST("/quarters/add", append(middleware.Require(rbac.CompanyOwnManage), company.AddQuarter)...)
+	companyRouter.POST("/quarters/submit", append(middleware.Require(rbac.CompanyOwnManage), company.SubmitQuarter)...)
+	companyRouter.GET("/quarters/transitions", append(middleware.Require(rbac.CompanyOwnManage), company.ListQuarterTransitions)...)
+	companyRouter.POST("/create", append(middleware.Require(rbac.CompanyOwnManage), company.CreateCompany)...)
+	companyRouter.PUT("/edit", append(middleware.Require(rbac.CompanyOwnManage), company.EditCompany)...)
+	companyRouter.DELETE("/delete", append(middleware.Require(rbac.CompanyOwnManage), company.DeleteCompany)...)
+	companyRouter.POST("/join/:id", append(middleware.Require(rbac.CompanyOwnManage), company.JoinCompany)...)
+	companyRouter.GET("/codes", append(middleware.Require(rbac.CompanyOwnManage), company.ListJoinCodes)...)
+	companyRouter.POST("/codes", append(middleware.Require(rbac.CompanyOwnManage), company.CreateJoinCode)...)
+	companyRouter.POST("/codes/:id/rotate", append(middleware.Require(rbac.CompanyOwnManage), company.RotateJoinCode)...)
+	companyRouter.DELETE("/codes/:id", append(middleware.Require(rbac.CompanyOwnManage), company.RevokeJoinCode)...)
+	companyRouter.GET("/members", append(middleware.Require(rbac.CompanyOwnManage), company.ListMembers)...)
+	companyRouter.DELETE("/members/:id", append(middleware.Require(rbac.CompanyOwnManage), company.RemoveMember)...)
+	companyRouter.POST("/attachments/:field", append(middleware.Require(rbac.CompanyOwnManage), company.UploadAttachment)...)
+	companyRouter.GET("/attachments/:id/:field", append(middleware.Require(rbac.CompanyRead), company.DownloadAttachment)...)
+	companyRouter.GET("/perms/:id/visible", append(middleware.Require(rbac.CompanyRead), company.GetVisiblePerms)...)
+	companyRouter.GET("/perms/editable", append(middleware.Require(rbac.CompanyOwnManage), company.GetEditablePerms)...)
+	companyRouter.GET("/history/:id", append(middleware.RequireScoped(rbac.CompanyRead, models.ScopeCompanyRead), company.ListVersions)...)
+	companyRouter.GET("/history/:id/diff", append(middleware.RequireScoped(rbac.CompanyRead, models.ScopeCompanyRead), company.DiffVersions)...)
+	companyRouter.GET("/history/:id/version/:version", append(middleware.RequireScoped(rbac.CompanyRead, models.ScopeCompanyRead), company.GetVersion)...)
 
-	companyRouter.GET("/metrics/:id", middleware.JWTVerifyHandler, company.CompanyMetrics)
+	companyRouter.GET("/metrics/:id", append(middleware.RequireScoped(rbac.MetricsRead, models.ScopeMetricsRead), company.CompanyMetrics)...)
 }
@@ -4,30 +4,64 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/vnestcc/dashboard/handlers"
 	"github.com/vnestcc/dashboard/handlers/company"
+	"github.com/vnestcc/dashboard/rbac"
 	middleware "github.com/vnestcc/dashboard/utils/middlewares"
 )
 
 func loadManage(r *gin.RouterGroup) {
 	manageRouter := r.Group("/manage")
-	manageRouter.GET("/company/list", append(middleware.ModeratorMiddleware, company.ListCompany)...)
-	manageRouter.GET("/company/:id", append(middleware.ModeratorMiddleware, company.GetCompanyByID)...)
-	//	manageRouter.POST("/company/set", append(middleware.ModeratorMiddleware, handlers.SetCompanyParams)...)           // set visible/editable fields
-	manageRouter.PUT("/company/edit/:id", append(middleware.ModeratorMiddleware, company.EditCompanyByID)...)
-	manageRouter.DELETE("/company/delete/:id", append(middleware.ModeratorMiddleware, company.DeleteCompanyByID)...)
-	manageRouter.GET("/company/perms/:id/visible")
-	manageRouter.GET("/company/perms/:id/editable")
-	manageRouter.POST("/company/perms/:id/visible")
-	manageRouter.POST("/company/perms/:id/editable")
-	manageRouter.POST("/company/quarters/:id/new", append(middleware.ModeratorMiddleware, company.AllowQuarterByID)...)
-	manageRouter.DELETE("/company/quarters/:id/remove", append(middleware.ModeratorMiddleware, company.RemoveQuarterByID)...)
-	manageRouter.POST("/company/quarters/new", append(middleware.ModeratorMiddleware, company.AllowQuarter)...)
-	manageRouter.DELETE("/company/quarters/remove", append(middleware.ModeratorMiddleware, company.RemoveQuarter)...)
+	manageRouter.GET("/company/list", append(middleware.Require(rbac.CompanyManage), company.ListCompany)...)
+	manageRouter.GET("/company/:id", append(middleware.Require(rbac.CompanyManage), company.GetCompanyByID)...)
+	manageRouter.PUT("/company/edit/:id", append(middleware.Require(rbac.CompanyManage), company.EditCompanyByID)...)
+	manageRouter.DELETE("/company/delete/:id", append(middleware.Require(rbac.CompanyManage), company.DeleteCompanyByID)...)
+	manageRouter.GET("/company/perms/:id/visible", append(middleware.Require(rbac.CompanyManage), company.GetVisiblePerms)...)
+	manageRouter.GET("/company/perms/:id/editable", append(middleware.Require(rbac.CompanyManage), company.GetEditablePerms)...)
+	manageRouter.POST("/company/perms/:id/visible", append(middleware.Require(rbac.CompanyManage), company.SetVisiblePerms)...)
+	manageRouter.POST("/company/perms/:id/editable", append(middleware.Require(rbac.CompanyManage), company.SetEditablePerms)...)
+	manageRouter.GET("/company/history/:id", append(middleware.Require(rbac.CompanyManage), company.ListVersions)...)
+	manageRouter.GET("/company/history/:id/diff", append(middleware.Require(rbac.CompanyManage), company.DiffVersions)...)
+	manageRouter.GET("/company/history/:id/version/:version", append(middleware.Require(rbac.CompanyManage), company.GetVersion)...)
+	manageRouter.POST("/company/history/:id/rollback", append(middleware.Require(rbac.CompanyManage), company.RollbackVersion)...)
+	manageRouter.POST("/company/quarters/:id/new", append(middleware.Require(rbac.QuarterOpen), company.AllowQuarterByID)...)
+	manageRouter.DELETE("/company/quarters/:id/remove", append(middleware.Require(rbac.QuarterOpen), company.RemoveQuarterByID)...)
+	manageRouter.POST("/company/quarters/new", append(middleware.Require(rbac.QuarterOpen), company.AllowQuarter)...)
+	manageRouter.DELETE("/company/quarters/remove", append(middleware.Require(rbac.QuarterOpen), company.RemoveQuarter)...)
+	manageRouter.POST("/company/quarters/:id/backfill", append(middleware.Require(rbac.QuarterOpen), company.BackfillQuarters)...)
+	manageRouter.PUT("/company/quarters/deadline", append(middleware.Require(rbac.QuarterOpen), company.SetQuarterDeadline)...)
+	manageRouter.GET("/reporting", append(middleware.Require(rbac.QuarterOpen), company.GetReportingCalendar)...)
+	manageRouter.GET("/compliance", append(middleware.Require(rbac.ComplianceRead), company.GetCompliance)...)
+	manageRouter.GET("/company/quarters/:id/transitions", append(middleware.Require(rbac.QuarterReview), company.ListQuarterTransitions)...)
+	manageRouter.POST("/company/quarters/:id/review", append(middleware.Require(rbac.QuarterReview), company.StartQuarterReview)...)
+	manageRouter.POST("/company/quarters/:id/request-changes", append(middleware.Require(rbac.QuarterReview), company.RequestQuarterChanges)...)
+	manageRouter.POST("/company/quarters/:id/approve", append(middleware.Require(rbac.QuarterReview), company.ApproveQuarter)...)
+	manageRouter.POST("/company/quarters/:id/reopen", append(middleware.Require(rbac.QuarterUnlock), company.ReopenQuarter)...)
 
-	manageRouter.GET("/vc/list", append(middleware.AdminMiddleware, handlers.GetVCList)...)
-	manageRouter.PUT("/vc/:id/approve", append(middleware.AdminMiddleware, handlers.ApproveVC)...)
-	manageRouter.PUT("/vc/:id/remove", append(middleware.AdminMiddleware, handlers.RemoveVC)...)
-	manageRouter.DELETE("/vc/:id", append(middleware.AdminMiddleware, handlers.DeleteVC)...)
+	manageRouter.GET("/vc/list", append(middleware.Require(rbac.VCApprove), handlers.GetVCList)...)
+	manageRouter.PUT("/vc/:id/approve", append(middleware.Require(rbac.VCApprove), handlers.ApproveVC)...)
+	manageRouter.PUT("/vc/:id/remove", append(middleware.Require(rbac.VCApprove), handlers.RemoveVC)...)
+	manageRouter.DELETE("/vc/:id", append(middleware.Require(rbac.VCApprove), handlers.DeleteVC)...)
+	manageRouter.GET("/vc/:id/companies", append(middleware.Require(rbac.VCAssign), handlers.GetVCAssignments)...)
+	manageRouter.POST("/vc/:id/companies", append(middleware.Require(rbac.VCAssign), handlers.AssignVCCompany)...)
+	manageRouter.DELETE("/vc/:id/companies/:company_id", append(middleware.Require(rbac.VCAssign), handlers.UnassignVCCompany)...)
 
-	manageRouter.GET("/users", append(middleware.AdminMiddleware, handlers.GetUserList)...)
-	manageRouter.DELETE("/users/:id", append(middleware.AdminMiddleware, handlers.DeleteUserByID)...)
+	manageRouter.GET("/users", append(middleware.Require(rbac.UserManage), handlers.GetUserList)...)
+	manageRouter.DELETE("/users/:id", append(middleware.Require(rbac.UserManage), handlers.DeleteUserByID)...)
+
+	manageRouter.GET("/moderators", append(middleware.Require(rbac.StaffManage), handlers.GetModerators)...)
+	manageRouter.POST("/moderators/invite", append(middleware.Require(rbac.StaffManage), handlers.InviteModerator)...)
+	manageRouter.DELETE("/moderators/invites/:id", append(middleware.Require(rbac.StaffManage), handlers.CancelModeratorInvite)...)
+	manageRouter.DELETE("/moderators/:id", append(middleware.Require(rbac.StaffManage), handlers.RevokeModerator)...)
+
+	manageRouter.GET("/audit", append(middleware.Require(rbac.AuditRead), handlers.GetAuditLog)...)
+	manageRouter.GET("/2fa", append(middleware.Require(rbac.SecurityManage), handlers.GetTwoFactorPolicies)...)
+	manageRouter.PUT("/2fa/:role", append(middleware.Require(rbac.SecurityManage), handlers.SetTwoFactorPolicy)...)
+	manageRouter.GET("/tokens", append(middleware.Require(rbac.TokenAdmin), handlers.GetAllAPITokens)...)
+	manageRouter.DELETE("/tokens/:id", append(middleware.Require(rbac.TokenAdmin), handlers.RevokeAnyAPIToken)...)
+	manageRouter.GET("/service-accounts", append(middleware.Require(rbac.TokenAdmin), handlers.GetServiceAccounts)...)
+	manageRouter.POST("/service-accounts", append(middleware.Require(rbac.TokenAdmin), handlers.CreateServiceAccount)...)
+	manageRouter.DELETE("/service-accounts/:id", append(middleware.Require(rbac.TokenAdmin), handlers.DeleteServiceAccount)...)
+	manageRouter.POST("/service-accounts/:id/tokens", append(middleware.Require(rbac.TokenAdmin), handlers.CreateServiceAccountToken)...)
+	manageRouter.GET("/roles", append(middleware.Require(rbac.RBACRead), handlers.GetRoles)...)
+	manageRouter.GET("/lockouts", append(middleware.Require(rbac.SecurityManage), handlers.GetLockouts)...)
+	manageRouter.DELETE("/lockouts", append(middleware.Require(rbac.SecurityManage), handlers.UnlockAccount)...)
 }
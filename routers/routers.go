@@ -23,6 +23,8 @@ func LoadRoutes(r *gin.Engine) {
 	loadCompanies(apiRouter)
 	loadManage(apiRouter)
 	loadUser(apiRouter)
+	loadVC(apiRouter)
+	loadTokens(apiRouter)
 
 	apiRouter.GET("/ping", handlers.PingHandler)
 	apiRouter.GET("/healthcheck", handlers.HealthcheckHandler)
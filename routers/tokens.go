@@ -0,0 +1,16 @@
+package routers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vnestcc/dashboard/handlers"
+	"github.com/vnestcc/dashboard/rbac"
+	middleware "github.com/vnestcc/dashboard/utils/middlewares"
+)
+
+func loadTokens(r *gin.RouterGroup) {
+	tokenRouter := r.Group("/tokens")
+	tokenRouter.Use(middleware.Require(rbac.TokenManage)...)
+	tokenRouter.GET("", handlers.ListAPITokens)
+	tokenRouter.POST("", handlers.CreateAPIToken)
+	tokenRouter.DELETE("/:id", handlers.RevokeAPIToken)
+}
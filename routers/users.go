@@ -3,15 +3,15 @@ package routers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/vnestcc/dashboard/handlers"
+	"github.com/vnestcc/dashboard/rbac"
 	middleware "github.com/vnestcc/dashboard/utils/middlewares"
 )
 
 func loadUser(r *gin.RouterGroup) {
 	userRouter := r.Group("/users")
-	userRouter.Use(middleware.UserMiddleware...)
+	userRouter.Use(middleware.Require(rbac.ProfileManage)...)
 	userRouter.PUT("", handlers.EditUser)
 	userRouter.DELETE("", handlers.DeleteUser)
 	userRouter.GET("/me", handlers.UserMe)
 	userRouter.GET("/totp-qr", handlers.UserTOTP)
-	userRouter.GET("/backup-code", handlers.UserBackupCode)
 }
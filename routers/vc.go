@@ -0,0 +1,16 @@
+package routers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vnestcc/dashboard/handlers/company"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/rbac"
+	middleware "github.com/vnestcc/dashboard/utils/middlewares"
+)
+
+func loadVC(r *gin.RouterGroup) {
+	vcRouter := r.Group("/vc")
+	vcRouter.Use(middleware.RequireScoped(rbac.PortfolioRead, models.ScopeCompanyRead)...)
+	vcRouter.GET("/companies", company.VCCompanies)
+	vcRouter.GET("/companies/:id", company.VCCompanyData)
+}
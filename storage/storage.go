@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/vnestcc/dashboard/config"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage is the backend used for attachment files. Keys are slash separated
+// paths and never start with a slash.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func New(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		path := cfg.Path
+		if path == "" {
+			path = "./uploads"
+		}
+		return NewLocal(path)
+	case "s3":
+		return NewS3(cfg.Endpoint, cfg.Bucket, cfg.Region, cfg.AccessKey, cfg.SecretKey)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/models"
+	"gorm.io/gorm"
+)
+
+const (
+	auditBuffer    = 1024
+	auditBatchSize = 100
+	auditFlush     = time.Second
+)
+
+// AuditHook stores every `type: audit` log entry in the audit_logs table.
+// Entries are written in batches from a background goroutine so logging never
+// waits on the database; when the buffer is full entries are only logged to stdout.
+type AuditHook struct {
+	db      *gorm.DB
+	entries chan models.AuditLog
+	done    chan struct{}
+
+	// mu keeps Close from closing entries while an entry is being sent
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewAuditHook(db *gorm.DB) *AuditHook {
+	hook := &AuditHook{
+		db:      db,
+		entries: make(chan models.AuditLog, auditBuffer),
+		done:    make(chan struct{}),
+	}
+	go hook.run()
+	return hook
+}
+
+func (h *AuditHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *AuditHook) Fire(entry *logrus.Entry) error {
+	if entry.Data["type"] != "audit" {
+		return nil
+	}
+	record := models.AuditLog{
+		LoggedAt:  entry.Time,
+		Level:     entry.Level.String(),
+		Event:     auditString(entry.Data["event"]),
+		Status:    auditString(entry.Data["status"]),
+		Reason:    auditString(entry.Data["reason"]),
+		UserID:    auditID(entry.Data["user_id"]),
+		Email:     auditString(entry.Data["email"]),
+		CompanyID: auditID(entry.Data["company_id"]),
+		IP:        auditString(entry.Data["ip"]),
+		Message:   entry.Message,
+		Fields:    auditFields(entry.Data),
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return nil
+	}
+	select {
+	case h.entries <- record:
+	default:
+		fmt.Fprintf(os.Stderr, "audit buffer full, dropped %q event\n", record.Event)
+	}
+	return nil
+}
+
+func (h *AuditHook) run() {
+	ticker := time.NewTicker(auditFlush)
+	defer ticker.Stop()
+	batch := make([]models.AuditLog, 0, auditBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := h.db.CreateInBatches(batch, auditBatchSize).Error; err != nil {
+			// not an audit entry, so this does not loop back into the hook
+			Logger.Errorf("failed to store %d audit entries: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case record, ok := <-h.entries:
+			if !ok {
+				flush()
+				close(h.done)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= auditBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close writes the entries still buffered and stops the writer. Short lived
+// commands call it before exiting so their audit entries are not lost.
+func (h *AuditHook) Close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	close(h.entries)
+	h.mu.Unlock()
+	<-h.done
+}
+
+func auditString(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case error:
+		return s.Error()
+	}
+	return fmt.Sprint(v)
+}
+
+// auditID reads an ID field, which handlers log as a number or as the raw path parameter.
+func auditID(v any) *uint {
+	var id uint64
+	switch n := v.(type) {
+	case uint:
+		id = uint64(n)
+	case uint32:
+		id = uint64(n)
+	case uint64:
+		id = n
+	case int:
+		if n < 0 {
+			return nil
+		}
+		id = uint64(n)
+	case int64:
+		if n < 0 {
+			return nil
+		}
+		id = uint64(n)
+	case *uint:
+		if n == nil {
+			return nil
+		}
+		id = uint64(*n)
+	case string:
+		parsed, err := strconv.ParseUint(n, 10, 32)
+		if err != nil {
+			return nil
+		}
+		id = parsed
+	default:
+		return nil
+	}
+	result := uint(id)
+	return &result
+}
+
+func auditFields(data logrus.Fields) string {
+	fields := make(map[string]any, len(data))
+	for k, v := range data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		} else if _, err := json.Marshal(v); err != nil {
+			v = fmt.Sprint(v)
+		}
+		fields[k] = v
+	}
+	raw, _ := json.Marshal(fields)
+	return string(raw)
+}
@@ -1,16 +1,84 @@
 package utils
 
 import (
+	"context"
 	"time"
 
 	"github.com/vnestcc/dashboard/models"
 	"github.com/vnestcc/dashboard/utils/values"
 )
 
+// UserCleanUp drops founder signups that never joined a company. Members who
+// left or were removed from one keep their account.
 func UserCleanUp() {
 	db := values.GetDB()
 	now := time.Now()
 	cutoff := now.Add(-6 * time.Hour)
-	db.Where("role = ? AND startup_id IS NULL AND created_at <= ?", "user", cutoff).Delete(&models.User{})
+	db.Where("role = ? AND startup_id IS NULL AND joined_at IS NULL AND created_at <= ?", "user", cutoff).Delete(&models.User{})
 	Logger.Trace("Scheduled cleanup ran at:", now.Format(time.RFC3339))
 }
+
+// SessionCleanUp drops sessions that ended more than a week ago.
+func SessionCleanUp() {
+	db := values.GetDB()
+	now := time.Now()
+	cutoff := now.Add(-7 * 24 * time.Hour)
+	db.Unscoped().Where("expires_at <= ? OR revoked_at <= ?", cutoff, cutoff).Delete(&models.Session{})
+	Logger.Trace("Scheduled session cleanup ran at:", now.Format(time.RFC3339))
+}
+
+// VerificationCleanUp drops email verification links that expired.
+func VerificationCleanUp() {
+	db := values.GetDB()
+	now := time.Now()
+	db.Where("expires_at <= ?", now).Delete(&models.EmailVerification{})
+	Logger.Trace("Scheduled verification cleanup ran at:", now.Format(time.RFC3339))
+}
+
+// ChallengeCleanUp drops login challenges that expired before a second factor
+// was sent.
+func ChallengeCleanUp() {
+	db := values.GetDB()
+	now := time.Now()
+	db.Where("expires_at <= ?", now).Delete(&models.LoginChallenge{})
+	Logger.Trace("Scheduled challenge cleanup ran at:", now.Format(time.RFC3339))
+}
+
+// JoinCodeCleanUp drops join codes that expired or were revoked more than 30
+// days ago, recent ones stay listed so founders can see what happened to them.
+func JoinCodeCleanUp() {
+	db := values.GetDB()
+	now := time.Now()
+	cutoff := now.Add(-30 * 24 * time.Hour)
+	db.Unscoped().Where("expires_at <= ? OR revoked_at <= ?", cutoff, cutoff).Delete(&models.JoinCode{})
+	Logger.Trace("Scheduled join code cleanup ran at:", now.Format(time.RFC3339))
+}
+
+// AttemptCleanUp forgets failed sign in attempts that are no longer relevant.
+func AttemptCleanUp() {
+	now := time.Now()
+	if attempts := values.GetLimiter(); attempts != nil {
+		if err := attempts.Prune(context.Background()); err != nil {
+			Logger.Errorf("Failed to prune sign in attempts: %v", err)
+		}
+	}
+	Logger.Trace("Scheduled attempt cleanup ran at:", now.Format(time.RFC3339))
+}
+
+// SSOCleanUp drops SSO sign ins that were started but never finished.
+func SSOCleanUp() {
+	now := time.Now()
+	if err := values.GetSSO().Prune(context.Background()); err != nil {
+		Logger.Errorf("Failed to prune SSO sign ins: %v", err)
+	}
+	Logger.Trace("Scheduled SSO cleanup ran at:", now.Format(time.RFC3339))
+}
+
+// MailCleanUp drops queued mails that were sent or given up more than 30 days ago.
+func MailCleanUp() {
+	now := time.Now()
+	if err := values.GetMailer().Prune(context.Background(), now.Add(-30*24*time.Hour)); err != nil {
+		Logger.Errorf("Failed to prune the mail queue: %v", err)
+	}
+	Logger.Trace("Scheduled mail cleanup ran at:", now.Format(time.RFC3339))
+}
@@ -0,0 +1,20 @@
+package utils
+
+import "strings"
+
+// CSVCell keeps a value from being read as a formula when the exported file
+// is opened in a spreadsheet, by quoting cells that start like one.
+func CSVCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// CSVRecord applies CSVCell to every cell of a record.
+func CSVRecord(record []string) []string {
+	for i, value := range record {
+		record[i] = CSVCell(value)
+	}
+	return record
+}
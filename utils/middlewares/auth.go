@@ -3,16 +3,41 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/vnestcc/dashboard/models"
+	"github.com/vnestcc/dashboard/rbac"
 	"github.com/vnestcc/dashboard/utils/values"
 )
 
 type Claims struct {
-	ID   uint   `json:"id"`
-	Role string `json:"roles"`
+	ID        uint   `json:"id"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid"`
 	jwt.RegisteredClaims
+
+	// set instead of SessionID when the request used an API token
+	TokenID          uint     `json:"-"`
+	ServiceAccountID uint     `json:"-"`
+	Scopes           []string `json:"-"`
+}
+
+// lastUsedInterval limits how often using an API token is written back.
+const lastUsedInterval = time.Minute
+
+// sessionActive checks the session a token was issued for on every request,
+// so signing out or removing an account ends access before the token expires.
+func sessionActive(claims *Claims) bool {
+	if claims.SessionID == 0 {
+		return false
+	}
+	var count int64
+	err := values.GetDB().Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", claims.SessionID, claims.ID, time.Now()).
+		Count(&count).Error
+	return err == nil && count > 0
 }
 
 var JWTVerifyHandler gin.HandlerFunc = func(ctx *gin.Context) {
@@ -27,6 +52,10 @@ var JWTVerifyHandler gin.HandlerFunc = func(ctx *gin.Context) {
 		return
 	}
 	tokenString := parts[1]
+	if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+		apiTokenAuth(ctx, tokenString)
+		return
+	}
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
 		return []byte(values.GetConfig().Server.JWTSecret), nil
@@ -36,11 +65,74 @@ var JWTVerifyHandler gin.HandlerFunc = func(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		return
 	}
+	if !sessionActive(claims) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
+		return
+	}
+	ctx.Set("claims", claims)
+	ctx.Next()
+}
+
+// TokenScope lets API tokens with the scope use the routes after it.
+// JWTVerifyHandler turns API tokens away on every route without a scope.
+func TokenScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set("token_scope", scope)
+		ctx.Next()
+	}
+}
+
+func apiTokenAuth(ctx *gin.Context, tokenString string) {
+	scope := ctx.GetString("token_scope")
+	if scope == "" {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API tokens cannot be used on this endpoint"})
+		return
+	}
+	db := values.GetDB()
+	now := time.Now()
+	var token models.APIToken
+	if err := db.Where("token_hash = ?", models.HashAPIToken(tokenString)).First(&token).Error; err != nil || !token.Active(now) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+	if !token.Scopes.Has(scope) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "The token does not have the " + scope + " scope"})
+		return
+	}
+	claims := &Claims{TokenID: token.ID, Scopes: token.Scopes}
+	switch {
+	case token.UserID != nil:
+		var user models.User
+		if err := db.First(&user, *token.UserID).Error; err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		if rbac.NeedsApproval(user.Role) && !user.Approved {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "This account is not approved"})
+			return
+		}
+		claims.ID, claims.Role = user.ID, user.Role
+	case token.ServiceAccountID != nil:
+		var count int64
+		if err := db.Model(&models.ServiceAccount{}).Where("id = ?", *token.ServiceAccountID).Count(&count).Error; err != nil || count == 0 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		claims.ServiceAccountID, claims.Role = *token.ServiceAccountID, rbac.RoleService
+	default:
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastUsedInterval {
+		db.Model(&token).UpdateColumn("last_used_at", now)
+	}
 	ctx.Set("claims", claims)
 	ctx.Next()
 }
 
-func RoleCheckHandler(roles ...string) gin.HandlerFunc {
+// PermissionCheckHandler lets the request through when the role of the caller
+// has the permission.
+func PermissionCheckHandler(perm rbac.Permission) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		claimsVal, exists := ctx.Get("claims")
 		if !exists {
@@ -52,28 +144,20 @@ func RoleCheckHandler(roles ...string) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid claims type"})
 			return
 		}
-		for _, required := range roles {
-			if claims.Role == required {
-				ctx.Next()
-				return
-			}
+		if !rbac.Can(claims.Role, perm) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Missing the " + string(perm) + " permission"})
+			return
 		}
+		ctx.Next()
 	}
 }
 
-var UserMiddleware gin.HandlersChain = gin.HandlersChain{
-	JWTVerifyHandler,
-	RoleCheckHandler("user"),
-}
-var AdminMiddleware gin.HandlersChain = gin.HandlersChain{
-	JWTVerifyHandler,
-	RoleCheckHandler("admin"),
+// Require is the chain of a route that needs the permission.
+func Require(perm rbac.Permission) gin.HandlersChain {
+	return gin.HandlersChain{JWTVerifyHandler, PermissionCheckHandler(perm)}
 }
-var ModeratorMiddleware gin.HandlersChain = gin.HandlersChain{
-	JWTVerifyHandler,
-	RoleCheckHandler("moderator", "admin"),
-}
-var VCMiddleware gin.HandlersChain = gin.HandlersChain{
-	JWTVerifyHandler,
-	RoleCheckHandler("vc"),
+
+// RequireScoped is Require for a route that API tokens with the scope may use too.
+func RequireScoped(perm rbac.Permission, scope string) gin.HandlersChain {
+	return gin.HandlersChain{TokenScope(scope), JWTVerifyHandler, PermissionCheckHandler(perm)}
 }
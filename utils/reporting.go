@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vnestcc/dashboard/reporting"
+	"github.com/vnestcc/dashboard/utils/values"
+)
+
+// ReportingCalendar opens and closes the quarters of the reporting calendar.
+func ReportingCalendar(cal reporting.Calendar) {
+	now := time.Now()
+	auditLog := Logger.WithFields(logrus.Fields{
+		"type":  "audit",
+		"event": "reporting_calendar",
+	})
+	if err := reporting.Run(context.Background(), values.GetDB(), values.GetMailer(), cal, now, auditLog); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_error",
+			"error":  err.Error(),
+		}).Error("Failed to run the reporting calendar")
+	}
+	Logger.Trace("Scheduled reporting calendar ran at:", now.Format(time.RFC3339))
+}
+
+// DeadlineReminders reminds founders of quarters due soon.
+func DeadlineReminders(cal reporting.Calendar) {
+	now := time.Now()
+	auditLog := Logger.WithFields(logrus.Fields{
+		"type":  "audit",
+		"event": "deadline_reminders",
+	})
+	if err := reporting.SendDeadlineReminders(context.Background(), values.GetDB(), values.GetMailer(), cal, now, auditLog); err != nil {
+		auditLog.WithFields(logrus.Fields{
+			"status": "failure",
+			"reason": "db_error",
+			"error":  err.Error(),
+		}).Error("Failed to send deadline reminders")
+	}
+	Logger.Trace("Scheduled deadline reminders ran at:", now.Format(time.RFC3339))
+}
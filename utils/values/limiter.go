@@ -0,0 +1,13 @@
+package values
+
+import "github.com/vnestcc/dashboard/limiter"
+
+var attempts *limiter.Limiter
+
+func GetLimiter() *limiter.Limiter {
+	return attempts
+}
+
+func SetLimiter(l *limiter.Limiter) {
+	attempts = l
+}
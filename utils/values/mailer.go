@@ -0,0 +1,13 @@
+package values
+
+import "github.com/vnestcc/dashboard/mailer"
+
+var mail *mailer.Mailer
+
+func GetMailer() *mailer.Mailer {
+	return mail
+}
+
+func SetMailer(m *mailer.Mailer) {
+	mail = m
+}
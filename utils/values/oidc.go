@@ -0,0 +1,13 @@
+package values
+
+import "github.com/vnestcc/dashboard/oidc"
+
+var sso *oidc.Registry
+
+func GetSSO() *oidc.Registry {
+	return sso
+}
+
+func SetSSO(r *oidc.Registry) {
+	sso = r
+}
@@ -0,0 +1,13 @@
+package values
+
+import "github.com/vnestcc/dashboard/storage"
+
+var store storage.Storage
+
+func GetStorage() storage.Storage {
+	return store
+}
+
+func SetStorage(s storage.Storage) {
+	store = s
+}